@@ -0,0 +1,49 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+)
+
+// ConstructApp returns an app running the commands Construct generates for
+// the item, printing to Config.Writer. Unknown commands print an error
+// along with the help of the command they were given to, instead of exiting
+// the process.
+func (c *constructor) ConstructApp(name, usage string, item interface{}) (*cli.App, error) {
+	cmds, err := c.Construct(item)
+	if err != nil {
+		return nil, err
+	}
+
+	app := cli.NewApp()
+	app.Name = name
+	app.Usage = usage
+	app.HideVersion = true
+	app.Commands = cmds
+	app.Writer = c.writer()
+	app.CommandNotFound = commandNotFound
+	if c.cfg.OutputFlag {
+		app.Flags = []cli.Flag{outputFlag}
+	}
+	return app, nil
+}
+
+// commandNotFound is inherited by the apps urfave/cli creates for the
+// subcommands, so it gets called at any level.
+func commandNotFound(ctx *cli.Context, command string) {
+	var w io.Writer = os.Stderr
+	if ctx.App.ErrWriter != nil {
+		w = ctx.App.ErrWriter
+	}
+	fmt.Fprintf(w, "unknown command %q\n\n", command)
+	_ = cli.ShowAppHelp(ctx)
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+type operation struct {
+	line int
+	name string
+	args []string
+}
+
+// operationArgs is the number of arguments each operation takes.
+var operationArgs = map[string]int{
+	"set":   2,
+	"unset": 1,
+	"add":   2,
+	"clear": 1,
+}
+
+// parseOperations parses a script of newline separated operations, skipping
+// blank lines and comments.
+func parseOperations(script string) ([]operation, error) {
+	var ops []operation
+	for i, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+
+		n, ok := operationArgs[args[0]]
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown operation %q", i+1, args[0])
+		}
+		if len(args)-1 != n {
+			return nil, fmt.Errorf("line %d: %s expects %d arguments, got %d", i+1, args[0], n, len(args)-1)
+		}
+
+		ops = append(ops, operation{i + 1, args[0], args[1:]})
+	}
+	return ops, nil
+}
+
+func (c *constructor) applyOperation(v reflect.Value, op operation, dryRun bool) error {
+	switch op.name {
+	case "set":
+		return c.pathSet(v, op.args[0], op.args[1], dryRun)
+	case "unset":
+		return c.pathUnset(v, op.args[0], dryRun)
+	case "add":
+		return c.pathAdd(v, op.args[0], op.args[1], dryRun)
+	case "clear":
+		return c.pathClear(v, op.args[0], dryRun)
+	}
+	return fmt.Errorf("unknown operation %q", op.name)
+}
+
+func (c *constructor) makeApplyCommand(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:      "apply",
+		Usage:     "Apply newline separated set, unset, add and clear operations on paths, with json values for anything but primitives",
+		ArgsUsage: "[script|@file|-]",
+		Category:  "ACTIONS",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Only check that the operations are valid",
+			},
+		},
+		Action: expectArgs(1, func(ctx *cli.Context) error {
+			data, err := readInput(ctx.Args().First())
+			if err != nil {
+				return err
+			}
+
+			ops, err := parseOperations(string(data))
+			if err != nil {
+				return err
+			}
+
+			for _, op := range ops {
+				if err := c.applyOperation(v, op, ctx.Bool("dry-run")); err != nil {
+					return fmt.Errorf("line %d: %v", op.line, err)
+				}
+			}
+			return nil
+		}),
+	}
+}
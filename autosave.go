@@ -0,0 +1,84 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// WithAutoSave wraps the actions of the commands and their subcommands, so
+// that once they succeed and have changed the target, it is written to the
+// json file at path, the way dump-json prints it. Changes are found by
+// comparing the json of the target before and after the action, so that it
+// does not matter what the actions are named, see Config.ActionNames. The
+// file is replaced atomically, so a failed write leaves the previous contents
+// intact, and the failure is returned from the command. The target is
+// marshaled without holding Config.Mutex.
+func WithAutoSave(cmds []cli.Command, target interface{}, path string) []cli.Command {
+	wrapped := make([]cli.Command, len(cmds))
+	copy(wrapped, cmds)
+	for i := range wrapped {
+		wrapped[i].Subcommands = WithAutoSave(wrapped[i].Subcommands, target, path)
+
+		action := wrapped[i].Action
+		if action == nil {
+			continue
+		}
+		wrapped[i].Action = func(ctx *cli.Context) error {
+			before, err := marshalJSONIndent(target)
+			if err != nil {
+				return err
+			}
+			if err := cli.HandleAction(action, ctx); err != nil {
+				return err
+			}
+			data, err := marshalJSONIndent(target)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(before, data) {
+				return nil
+			}
+			return errors.Wrap(writeFileAtomic(path, append(data, '\n')), "saving "+path)
+		}
+	}
+	return wrapped
+}
+
+// writeFileAtomic writes the data to a temporary file next to the path and
+// renames it over the path, so that the file is never seen half written.
+func writeFileAtomic(path string, data []byte) error {
+	fd, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		os.Remove(fd.Name())
+		return err
+	}
+	if err := os.Rename(fd.Name(), path); err != nil {
+		os.Remove(fd.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package cobracli provides the commands recli constructs as cobra commands.
+//
+// Like the v2cli package, the commands are converted from the urfave/cli v1
+// ones, so that both behave exactly the same. The actions parse their own
+// flags and arguments the v1 way, so cobra leaves the flags of the commands
+// running them unparsed, and the converted flags only serve the help output,
+// apart from the flags of the commands grouping other commands, such as
+// --output, which cobra needs to know about to find the commands after
+// them, and passes on to the actions.
+package cobracli
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/AudriusButkevicius/recli"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	v1 "github.com/urfave/cli"
+)
+
+// Construct returns a command without a name, having the commands the
+// constructor constructs for the item, converted to cobra, as subcommands.
+// Either set its Use and run it, or add its Commands to another command.
+func Construct(c recli.Constructor, item interface{}) (*cobra.Command, error) {
+	cmds, err := c.Construct(item)
+	if err != nil {
+		return nil, err
+	}
+	root := &cobra.Command{}
+	root.AddCommand(Commands(cmds)...)
+	return root, nil
+}
+
+// Commands converts urfave/cli v1 commands and their subcommands to cobra.
+func Commands(cmds []v1.Command) []*cobra.Command {
+	converted := make([]*cobra.Command, 0, len(cmds))
+	for _, cmd := range cmds {
+		converted = append(converted, command(cmd))
+	}
+	return converted
+}
+
+func command(cmd v1.Command) *cobra.Command {
+	use := cmd.Name
+	if cmd.ArgsUsage != "" {
+		use += " " + cmd.ArgsUsage
+	}
+	converted := &cobra.Command{
+		Use:     use,
+		Aliases: cmd.Aliases,
+		Short:   cmd.Usage,
+		Long:    cmd.Description,
+		Hidden:  cmd.Hidden,
+	}
+	for _, flag := range cmd.Flags {
+		addFlag(converted.Flags(), flag)
+	}
+	converted.AddCommand(Commands(cmd.Subcommands)...)
+	if cmd.Action != nil {
+		// The action parses the arguments itself
+		converted.DisableFlagParsing = true
+		converted.RunE = func(cc *cobra.Command, args []string) error {
+			return runAction(cc, cmd, args)
+		}
+	}
+	return converted
+}
+
+// runAction runs the v1 command with the arguments, in a v1 app printing
+// where the cobra command does. Flags given to the parents are left among
+// the arguments by cobra, and so reach the action.
+func runAction(cc *cobra.Command, cmd v1.Command, args []string) error {
+	app := v1.NewApp()
+	app.Name = cc.Root().Name()
+	app.HideVersion = true
+	app.Writer = cc.OutOrStdout()
+	app.ErrWriter = cc.ErrOrStderr()
+	app.Commands = []v1.Command{cmd}
+	return app.Run(append([]string{app.Name, cmd.Name}, args...))
+}
+
+// addFlag adds the flag types recli uses to the flag set, falling back to a
+// string flag for anything else. Only single letter aliases are kept, as
+// pflag shorthands.
+func addFlag(fs *pflag.FlagSet, flag v1.Flag) {
+	var name, shorthand string
+	for i, n := range strings.Split(flag.GetName(), ",") {
+		n = strings.TrimSpace(n)
+		switch {
+		case i == 0:
+			name = n
+		case len(n) == 1 && shorthand == "":
+			shorthand = n
+		}
+	}
+
+	var hidden bool
+	switch flag := flag.(type) {
+	case v1.BoolFlag:
+		fs.BoolP(name, shorthand, false, flag.Usage)
+		hidden = flag.Hidden
+	case v1.StringFlag:
+		fs.StringP(name, shorthand, flag.Value, flag.Usage)
+		hidden = flag.Hidden
+	case v1.IntFlag:
+		fs.IntP(name, shorthand, flag.Value, flag.Usage)
+		hidden = flag.Hidden
+	case v1.Int64Flag:
+		fs.Int64P(name, shorthand, flag.Value, flag.Usage)
+		hidden = flag.Hidden
+	case v1.Float64Flag:
+		fs.Float64P(name, shorthand, flag.Value, flag.Usage)
+		hidden = flag.Hidden
+	case v1.StringSliceFlag:
+		fs.StringSliceP(name, shorthand, nil, flag.Usage)
+		hidden = flag.Hidden
+	case v1.Int64SliceFlag:
+		fs.Int64SliceP(name, shorthand, nil, flag.Usage)
+		hidden = flag.Hidden
+	default:
+		// All the flag types of v1 have a usage, but not in their interface
+		var usage string
+		if v := reflect.Indirect(reflect.ValueOf(flag)); v.Kind() == reflect.Struct {
+			if field := v.FieldByName("Usage"); field.Kind() == reflect.String {
+				usage = field.String()
+			}
+		}
+		fs.StringP(name, shorthand, "", usage)
+	}
+	if hidden {
+		_ = fs.MarkHidden(name)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package cobracli
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AudriusButkevicius/recli"
+	"github.com/spf13/cobra"
+	v1 "github.com/urfave/cli"
+)
+
+type Backend struct {
+	Name  string `recli:"id"`
+	Port  int
+	Tags  []string
+	Ports []int
+	TLS   bool
+}
+
+type Config struct {
+	Name     string `usage:"Name of the server"`
+	Backends []Backend
+	Labels   map[string]string
+}
+
+func run(cfg recli.Config, item interface{}, args ...string) (string, error) {
+	var buf bytes.Buffer
+	cfg.Writer = &buf
+
+	root, err := Construct(recli.New(cfg), item)
+	if err != nil {
+		return "", err
+	}
+	root.Use = "test"
+	root.SilenceUsage = true
+	root.SilenceErrors = true
+	root.SetOut(&buf)
+	root.SetErr(&buf)
+	root.SetArgs(args)
+	err = root.Execute()
+	return buf.String(), err
+}
+
+func TestCobra(t *testing.T) {
+	x := &Config{
+		Name:     "a",
+		Backends: []Backend{{Name: "b", Port: 1}},
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"name", "set", "foo"}, ""},
+		{[]string{"name", "get"}, "foo\n"},
+		{[]string{"backends", "add", "--name", "c", "--port", "2", "--tags", "x", "--tags", "y", "--ports", "3", "--tls"}, ""},
+		{[]string{"backends", "list"}, "b\nc\n"},
+		{[]string{"backends", "c", "tags", "list"}, "0\n1\n"},
+		{[]string{"backends", "last", "port", "get"}, "2\n"},
+		{[]string{"labels", "set", "k", "v"}, ""},
+		{[]string{"labels", "get", "k"}, "v\n"},
+		{[]string{"backends", "b", "delete"}, ""},
+		{[]string{"backends", "count"}, "1\n"},
+	} {
+		out, err := run(recli.DefaultConfig, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if out != tc.expected {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+
+	expected := &Config{
+		Name:     "foo",
+		Backends: []Backend{{Name: "c", Port: 2, Tags: []string{"x", "y"}, Ports: []int{3}, TLS: true}},
+		Labels:   map[string]string{"k": "v"},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("unexpected value: %+v", x)
+	}
+
+	for _, args := range [][]string{
+		{"name", "set"},
+		{"backends", "add", "--port", "x"},
+		{"backends", "c", "port", "set", "x"},
+	} {
+		if _, err := run(recli.DefaultConfig, x, args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestCobraOutputFlag(t *testing.T) {
+	x := &Config{
+		Name:     "a",
+		Backends: []Backend{{Name: "b", Port: 1}},
+	}
+
+	cfg := recli.DefaultConfig
+	cfg.OutputFlag = true
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"name", "get"}, "a\n"},
+		{[]string{"name", "get", "--output", "json"}, "\"a\"\n"},
+		{[]string{"name", "--output", "json", "get"}, "\"a\"\n"},
+		{[]string{"backends", "--output", "json", "list"}, "[\"b\"]\n"},
+	} {
+		out, err := run(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if out != tc.expected {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+}
+
+func TestCobraTree(t *testing.T) {
+	x := &Config{Backends: []Backend{{Name: "b"}}}
+
+	cmds, err := recli.Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var compare func(path string, cmds []v1.Command, converted []*cobra.Command)
+	compare = func(path string, cmds []v1.Command, converted []*cobra.Command) {
+		if len(converted) != len(cmds) {
+			t.Fatalf("%s: %d commands, expected %d", path, len(converted), len(cmds))
+		}
+		for i, cmd := range cmds {
+			c := converted[i]
+			if c.Name() != cmd.Name || c.Short != cmd.Usage || c.Hidden != cmd.Hidden || (c.RunE != nil) != (cmd.Action != nil) {
+				t.Errorf("%s %s: converted to %+v", path, cmd.Name, c)
+			}
+			compare(path+" "+cmd.Name, cmd.Subcommands, c.Commands())
+		}
+	}
+	cobra.EnableCommandSorting = false
+	defer func() {
+		cobra.EnableCommandSorting = true
+	}()
+	compare("", cmds, Commands(cmds))
+
+	out, err := run(recli.DefaultConfig, x, "help", "backends", "add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, flag := range []string{"--name string", "--tags strings", "--tls"} {
+		if !strings.Contains(out, flag) {
+			t.Errorf("%s missing from help: %s", flag, out)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/AudriusButkevicius/recli/cobracli
+
+go 1.17
+
+require (
+	github.com/AudriusButkevicius/recli v0.0.0-00010101000000-000000000000
+	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
+	github.com/urfave/cli v1.20.0
+)
+
+require (
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+)
+
+replace github.com/AudriusButkevicius/recli => ../
@@ -0,0 +1,142 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ColorMode selects whether human readable output is colorized.
+type ColorMode int
+
+const (
+	// ColorNever never colorizes the output.
+	ColorNever ColorMode = iota
+	// ColorAuto colorizes the output only when it is printed straight to
+	// a Writer which is a terminal, and not through any of the printers or
+	// value writers.
+	ColorAuto
+	// ColorAlways colorizes the output wherever it goes, including the
+	// values given to the printers.
+	ColorAlways
+)
+
+const (
+	colorReset   = "\x1b[0m"
+	colorKey     = "\x1b[36m"
+	colorString  = "\x1b[32m"
+	colorNumber  = "\x1b[33m"
+	colorLiteral = "\x1b[35m"
+	colorMarker  = "\x1b[2m"
+)
+
+func colorize(color, s string) string {
+	return color + s + colorReset
+}
+
+// isTerminal returns whether the writer is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// useColor returns whether the human readable output should be colorized.
+func (c *constructor) useColor() bool {
+	switch c.cfg.Color {
+	case ColorAlways:
+		return true
+	case ColorAuto:
+		return c.cfg.ValuePrinter == nil && c.cfg.KeyValuePrinter == nil &&
+			c.cfg.ValueWriter == nil && c.cfg.KeyValueWriter == nil &&
+			isTerminal(c.writer())
+	}
+	return false
+}
+
+// isMarker returns whether the value stands for the lack of a value.
+func isMarker(value interface{}) bool {
+	return value == nil || value == redactedValue
+}
+
+// colorValue colorizes a value printed next to its key, dimming unset and
+// redacted values.
+func colorValue(value interface{}) string {
+	if isMarker(value) {
+		return colorize(colorMarker, fmt.Sprint(value))
+	}
+	return colorize(colorString, fmt.Sprint(value))
+}
+
+// highlightJSON colorizes the keys, strings, numbers and literals of a json
+// document, leaving the structure as is. The redaction placeholder is
+// dimmed rather than highlighted as a string.
+func highlightJSON(data []byte) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(data); {
+		switch ch := data[i]; {
+		case ch == '"':
+			end := i + 1
+			for end < len(data) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(data) {
+				end++
+			}
+			token := string(data[i:end])
+
+			// A string followed by a colon is a key
+			next := end
+			for next < len(data) && (data[next] == ' ' || data[next] == '\n' || data[next] == '\t' || data[next] == '\r') {
+				next++
+			}
+			switch {
+			case next < len(data) && data[next] == ':':
+				buf.WriteString(colorize(colorKey, token))
+			case token == `"`+redactedValue+`"`:
+				buf.WriteString(colorize(colorMarker, token))
+			default:
+				buf.WriteString(colorize(colorString, token))
+			}
+			i = end
+
+		case ch == '-' || ch >= '0' && ch <= '9':
+			end := i + 1
+			for end < len(data) && bytes.IndexByte([]byte("0123456789+-.eE"), data[end]) >= 0 {
+				end++
+			}
+			buf.WriteString(colorize(colorNumber, string(data[i:end])))
+			i = end
+
+		case ch >= 'a' && ch <= 'z':
+			end := i + 1
+			for end < len(data) && data[end] >= 'a' && data[end] <= 'z' {
+				end++
+			}
+			color := colorLiteral
+			if string(data[i:end]) == "null" {
+				color = colorMarker
+			}
+			buf.WriteString(colorize(color, string(data[i:end])))
+			i = end
+
+		default:
+			buf.WriteByte(ch)
+			i++
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// defaultMutationMessage formats a confirmation such as "set gui.theme = dark"
+// or "delete devices.abcd".
+func defaultMutationMessage(op, path string, value interface{}) string {
+	msg := op
+	if path != "" {
+		msg += " " + path
+	}
+	if value != nil {
+		msg += fmt.Sprintf(" = %v", value)
+	}
+	return msg
+}
+
+// mutationPath returns the path of the value changed by the action, which
+// for the actions taking a key or a path as the first argument includes it.
+func (c *constructor) mutationPath(root reflect.Value, path []string, op string, ctx *cli.Context) []string {
+	if ctx.NArg() > 0 {
+		switch {
+		case len(path) == 0 && op == "set-pointer":
+			return []string{ctx.Args().First()}
+		case len(path) == 0 && op == "set" && ctx.NArg() == 2:
+			return strings.Split(ctx.Args().First(), ".")
+		case op == "set" || op == "unset":
+			if target, err := c.resolvePath(root, path); err == nil && deref(target.value).Kind() == reflect.Map {
+				path = appendPath(path, ctx.Args().First())
+			}
+		}
+	}
+	return path
+}
+
+// mutatedValue returns the value at the path if it is a primitive, redacted
+// if it is a secret, or nil otherwise. Missing map entries resolve to the
+// zero value, so this is not to be used for removals.
+func (c *constructor) mutatedValue(root reflect.Value, path []string) interface{} {
+	if len(path) == 0 {
+		return nil
+	}
+	target, err := c.resolvePath(root, path)
+	if err != nil || !isPrimitiveType(target.value.Type()) {
+		return nil
+	}
+	if target.field != nil && c.isSecret(*target.field) {
+		return redactedValue
+	}
+	v := deref(target.value)
+	if !v.IsValid() {
+		return nil
+	}
+	value, err := GetPrimitiveValue(v)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// confirmMutation prints the confirmation of the action changing the path.
+func (c *constructor) confirmMutation(ctx *cli.Context, root reflect.Value, op string, path []string) error {
+	format := c.cfg.MutationMessage
+	if format == nil {
+		format = defaultMutationMessage
+	}
+	var value interface{}
+	if op != "unset" && op != "delete" {
+		value = c.mutatedValue(root, path)
+	}
+	return c.printer(ctx).emitText(format(op, strings.Join(path, "."), value))
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// deprecation returns the note of a field tagged as deprecated, such as
+// recli:"deprecated=use foo instead". The note is the rest of the tag, so
+// that it can contain commas, and has to come last.
+func (c *constructor) deprecation(f reflect.StructField) (string, bool) {
+	if c.cfg.DeprecatedTag.Name == "" {
+		return "", false
+	}
+	tag := f.Tag.Get(c.cfg.DeprecatedTag.Name)
+	for _, option := range strings.Split(tag, ",") {
+		if option == c.cfg.DeprecatedTag.Value {
+			return "", true
+		}
+		if strings.HasPrefix(option, c.cfg.DeprecatedTag.Value+"=") {
+			return strings.SplitN(tag[strings.Index(tag, option):], "=", 2)[1], true
+		}
+	}
+	return "", false
+}
+
+// deprecatedUsage appends the deprecation note to the usage.
+func deprecatedUsage(usage, note string) string {
+	suffix := "(deprecated)"
+	if note != "" {
+		suffix = fmt.Sprintf("(deprecated: %s)", note)
+	}
+	if usage == "" {
+		return suffix
+	}
+	return usage + " " + suffix
+}
+
+// warnDeprecated prints a warning about the deprecated property.
+func (c *constructor) warnDeprecated(ctx *cli.Context, name, note string) {
+	msg := name + " is deprecated"
+	if note != "" {
+		msg += ": " + note
+	}
+	if c.cfg.WarningPrinter != nil {
+		c.cfg.WarningPrinter(msg)
+		return
+	}
+	var w io.Writer = os.Stderr
+	if ctx.App.ErrWriter != nil {
+		w = ctx.App.ErrWriter
+	}
+	fmt.Fprintln(w, "warning:", msg)
+}
+
+// deprecateCommands wraps the actions of the commands and their subcommands,
+// so that they warn about the deprecated property before running.
+func (c *constructor) deprecateCommands(cmds []cli.Command, name, note string) {
+	for i := range cmds {
+		c.deprecateCommands(cmds[i].Subcommands, name, note)
+
+		action := cmds[i].Action
+		if action == nil {
+			continue
+		}
+		cmds[i].Action = func(ctx *cli.Context) error {
+			c.warnDeprecated(ctx, name, note)
+			return cli.HandleAction(action, ctx)
+		}
+	}
+}
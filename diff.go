@@ -0,0 +1,247 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// orderedObject marshals as a json object, keeping the keys in order.
+type orderedObject []keyValuePair
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, kv := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := marshalJSON(fmt.Sprint(kv.key))
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalJSON(kv.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalJSON is like json.Marshal, but without escaping html characters.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// marshalJSONIndent is like marshalJSON, but indented the same way as
+// dump-json output.
+func marshalJSONIndent(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+var jsonMarshaler = reflect.TypeOf(new(json.Marshaler)).Elem()
+
+// pruneEqual returns a marshalable representation of v, leaving out the
+// struct fields which are deeply equal to the same field in base, along with
+// whether anything differed at all. Structs are compared field by field,
+// everything else as a whole.
+func (c *constructor) pruneEqual(v, base reflect.Value) (interface{}, bool, error) {
+	if v.CanInterface() && base.CanInterface() && reflect.DeepEqual(v.Interface(), base.Interface()) {
+		return nil, false, nil
+	}
+
+	dv, dbase := deref(v), deref(base)
+	if !dv.IsValid() || !dbase.IsValid() || dv.Kind() != reflect.Struct || isPrimitive(dv) || reflect.PtrTo(dv.Type()).Implements(jsonMarshaler) {
+		if !dv.IsValid() {
+			return nil, true, nil
+		}
+		vi, err := dumpable(dv)
+		return vi, true, err
+	}
+
+	t := dv.Type()
+	obj := orderedObject{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonFieldName(f)
+		if !ok || f.PkgPath != "" {
+			continue
+		}
+		value, differs, err := c.pruneEqual(dv.Field(i), dbase.Field(i))
+		if err != nil {
+			return nil, false, err
+		}
+		if differs {
+			obj = append(obj, keyValuePair{name, value})
+		}
+	}
+	return obj, len(obj) > 0, nil
+}
+
+// withoutDefaults returns v with all the fields equal to their defaults left
+// out.
+func (c *constructor) withoutDefaults(v reflect.Value) (interface{}, error) {
+	base := reflect.New(v.Type())
+	if err := setDefaults(c.defaults(), base.Interface()); err != nil {
+		return nil, err
+	}
+	vi, differs, err := c.pruneEqual(v, base.Elem())
+	if err != nil || !differs {
+		return orderedObject{}, err
+	}
+	return vi, nil
+}
+
+// diffChange is the old and new value of a property that differs, either of
+// which is absent if the property was added or removed.
+type diffChange struct {
+	old, new       interface{}
+	hasOld, hasNew bool
+}
+
+func (d diffChange) String() string {
+	old, new := "<none>", "<none>"
+	if d.hasOld {
+		old = fmt.Sprint(d.old)
+	}
+	if d.hasNew {
+		new = fmt.Sprint(d.new)
+	}
+	return old + " -> " + new
+}
+
+func (d diffChange) MarshalJSON() ([]byte, error) {
+	obj := orderedObject{}
+	if d.hasOld {
+		obj = append(obj, keyValuePair{"old", d.old})
+	}
+	if d.hasNew {
+		obj = append(obj, keyValuePair{"new", d.new})
+	}
+	return obj.MarshalJSON()
+}
+
+// leaves returns the paths of all the leaves under v in walk order, along
+// with their values.
+func (c *constructor) leaves(v reflect.Value) ([]string, map[string]interface{}, error) {
+	var paths []string
+	values := make(map[string]interface{})
+	err := c.walk(nil, v, func(path []string, v reflect.Value) error {
+		value, err := leafValue(v)
+		if err != nil {
+			return err
+		}
+		key := strings.Join(path, ".")
+		paths = append(paths, key)
+		values[key] = value
+		return nil
+	})
+	return paths, values, err
+}
+
+// diff returns the changes between the leaves of old and new, keyed by path.
+// Slice items are matched by their keys, so reordering items with an ID is
+// not a change. The shown values are printed in place of the compared ones,
+// so that secrets can be redacted.
+func (c *constructor) diff(old, new, oldShown, newShown reflect.Value) ([]keyValuePair, error) {
+	oldPaths, oldValues, err := c.leaves(old)
+	if err != nil {
+		return nil, err
+	}
+	newPaths, newValues, err := c.leaves(new)
+	if err != nil {
+		return nil, err
+	}
+	_, oldShownValues, err := c.leaves(oldShown)
+	if err != nil {
+		return nil, err
+	}
+	_, newShownValues, err := c.leaves(newShown)
+	if err != nil {
+		return nil, err
+	}
+
+	shown := func(values map[string]interface{}, path string) interface{} {
+		if value, ok := values[path]; ok {
+			return value
+		}
+		return redactedValue
+	}
+
+	var kvs []keyValuePair
+	for _, path := range oldPaths {
+		change := diffChange{old: shown(oldShownValues, path), hasOld: true}
+		if newValue, ok := newValues[path]; ok {
+			if reflect.DeepEqual(oldValues[path], newValue) {
+				continue
+			}
+			change.new, change.hasNew = shown(newShownValues, path), true
+		}
+		kvs = append(kvs, keyValuePair{path, change})
+	}
+	for _, path := range newPaths {
+		if _, ok := oldValues[path]; !ok {
+			kvs = append(kvs, keyValuePair{path, diffChange{new: shown(newShownValues, path), hasNew: true}})
+		}
+	}
+	return kvs, nil
+}
+
+func (c *constructor) makeJsonDiffer(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:      "diff-json",
+		Usage:     "Show the properties which differ from the json, failing if any do",
+		ArgsUsage: "[value|@file|-]",
+		Category:  "ACTIONS",
+		Flags:     c.revealFlags(v.Type()),
+		Action: expectArgs(1, func(ctx *cli.Context) error {
+			data, err := readInput(ctx.Args().First())
+			if err != nil {
+				return err
+			}
+			newValue := reflect.New(v.Type()).Elem()
+			if err := json.Unmarshal(data, newValue.Addr().Interface()); err != nil {
+				return err
+			}
+
+			kvs, err := c.diff(v, newValue, c.revealed(ctx, v), c.revealed(ctx, newValue))
+			if err != nil {
+				return err
+			}
+			if len(kvs) == 0 {
+				return nil
+			}
+			if err := c.printer(ctx).emitKeyValues(kvs); err != nil {
+				return err
+			}
+			return fmt.Errorf("%d properties differ", len(kvs))
+		}),
+	}
+}
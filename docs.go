@@ -0,0 +1,180 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// itemPlaceholder stands in for the keys of slice and map items in the docs.
+const itemPlaceholder = "<key>"
+
+// GenerateMarkdown returns the markdown reference of the commands Construct
+// generates for the item, as written by the GenerateMarkdown function.
+func (c *constructor) GenerateMarkdown(item interface{}) (string, error) {
+	cmds, err := c.Construct(item)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := GenerateMarkdown(cmds, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// GenerateMarkdown writes a markdown reference of the commands, with a
+// section for every command path in the order the commands are given. Items
+// of slices and maps are documented once under a generic <key>, based on the
+// first item, so empty collections have no item section. Hidden commands are
+// left out.
+func GenerateMarkdown(cmds []cli.Command, w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("# Commands\n")
+	writeMarkdown(&buf, nil, cmds, nil)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeMarkdown writes the sections of the commands and their subcommands.
+// Keys holds the quoted keys of the items documented generically so far,
+// which get replaced in the usages.
+func writeMarkdown(buf *bytes.Buffer, path []string, cmds []cli.Command, keys []string) {
+	for _, cmd := range documentedCommands(cmds) {
+		name := cmd.Name
+		cmdKeys := keys
+		if isItemCommand(cmd) {
+			name = itemPlaceholder
+			cmdKeys = append(append([]string(nil), keys...), strconv.Quote(cmd.Name), strconv.Quote(itemPlaceholder))
+		}
+		cmdPath := appendPath(path, name)
+		writeMarkdownSection(buf, cmdPath, cmd, strings.NewReplacer(cmdKeys...))
+		writeMarkdown(buf, cmdPath, cmd.Subcommands, cmdKeys)
+	}
+}
+
+func isItemCommand(cmd cli.Command) bool {
+	return cmd.Category == "ITEMS" && len(cmd.Subcommands) > 0
+}
+
+// documentedCommands returns the commands which are not hidden, with only the
+// first of the items standing in for all of them.
+func documentedCommands(cmds []cli.Command) []cli.Command {
+	var documented []cli.Command
+	items := false
+	for _, cmd := range cmds {
+		if cmd.Hidden {
+			continue
+		}
+		if isItemCommand(cmd) {
+			if items {
+				continue
+			}
+			items = true
+		}
+		documented = append(documented, cmd)
+	}
+	return documented
+}
+
+func writeMarkdownSection(buf *bytes.Buffer, path []string, cmd cli.Command, keys *strings.Replacer) {
+	fmt.Fprintf(buf, "\n## `%s`\n\n", strings.Join(path, " "))
+	if cmd.Usage != "" {
+		fmt.Fprintf(buf, "%s\n\n", keys.Replace(cmd.Usage))
+	}
+	if cmd.Category != "" {
+		fmt.Fprintf(buf, "Category: %s\n\n", cmd.Category)
+	}
+
+	usage := strings.Join(path, " ")
+	if len(cmd.Subcommands) > 0 {
+		usage += " [command]"
+	}
+	if len(cmd.Flags) > 0 {
+		usage += " [options]"
+	}
+	if cmd.ArgsUsage != "" {
+		usage += " " + cmd.ArgsUsage
+	}
+	fmt.Fprintf(buf, "```\n%s\n```\n", usage)
+
+	if len(cmd.Flags) > 0 {
+		buf.WriteString("\nOptions:\n\n")
+		for _, flag := range cmd.Flags {
+			fmt.Fprintf(buf, "- `%s`", flagNames(flag))
+			if usage := flagUsage(flag); usage != "" {
+				fmt.Fprintf(buf, ": %s", usage)
+			}
+			buf.WriteByte('\n')
+		}
+	}
+
+	if subcmds := documentedCommands(cmd.Subcommands); len(subcmds) > 0 {
+		buf.WriteString("\nCommands:\n\n")
+		for _, subcmd := range subcmds {
+			name := subcmd.Name
+			if isItemCommand(subcmd) {
+				name = itemPlaceholder
+			}
+			fmt.Fprintf(buf, "- `%s`", name)
+			if subcmd.Usage != "" && !isItemCommand(subcmd) {
+				fmt.Fprintf(buf, ": %s", keys.Replace(subcmd.Usage))
+			}
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+// flagNames returns the names of the flag as typed on the command line.
+func flagNames(flag cli.Flag) string {
+	names := strings.Split(flag.GetName(), ",")
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if len(name) == 1 {
+			names[i] = "-" + name
+		} else {
+			names[i] = "--" + name
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// flagUsage returns the usage of the flag, which all the flag types of
+// urfave/cli have as a field but not in their interface.
+func flagUsage(flag cli.Flag) string {
+	v := reflect.Indirect(reflect.ValueOf(flag))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if usage := v.FieldByName("Usage"); usage.Kind() == reflect.String {
+		return usage.String()
+	}
+	return ""
+}
+
+func (c *constructor) makeDocsCommand(cmds *[]cli.Command) cli.Command {
+	return cli.Command{
+		Name:     "docs",
+		Usage:    "Print the markdown reference of all commands",
+		Category: "ACTIONS",
+		Hidden:   true,
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			var buf bytes.Buffer
+			if err := GenerateMarkdown(*cmds, &buf); err != nil {
+				return err
+			}
+			return c.printer(ctx).emitText(strings.TrimSuffix(buf.String(), "\n"))
+		}),
+	}
+}
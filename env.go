@@ -0,0 +1,96 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/urfave/cli"
+)
+
+// envKey formats a path as an environment variable name, upper-casing the
+// segments and replacing anything but letters and digits with underscores.
+func envKey(prefix string, path []string) string {
+	key := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, strings.Join(path, "_"))
+	return prefix + key
+}
+
+// shellQuote single quotes the value, so that it is taken literally by the
+// shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func (c *constructor) makeEnvDumper(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:     "dump-env",
+		Usage:    "Dump all properties as KEY=VALUE environment variable lines",
+		Category: "ACTIONS",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "prefix",
+				Usage: "Prefix to prepend to every key",
+			},
+			outputFileFlag(c.cfg),
+		}, c.revealFlags(v.Type())...),
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			errWriter := ctx.App.ErrWriter
+			if errWriter == nil {
+				errWriter = cli.ErrWriter
+			}
+
+			// Maps of structs have no sensible flat representation
+			filter := func(path []string, v reflect.Value) bool {
+				if v.Kind() == reflect.Map && derefType(v.Type().Elem()).Kind() == reflect.Struct {
+					fmt.Fprintf(errWriter, "warning: skipping %s: maps of structs cannot be represented as environment variables\n", strings.Join(path, "."))
+					return false
+				}
+				return true
+			}
+
+			prefix := ctx.String("prefix")
+			var lines []string
+			err := c.walkFiltered(nil, c.revealed(ctx, v), func(path []string, v reflect.Value) error {
+				value, err := leafValue(v)
+				if err != nil {
+					return err
+				}
+				str := ""
+				if value != nil {
+					str = fmt.Sprint(value)
+				}
+				lines = append(lines, envKey(prefix, path)+"="+shellQuote(str))
+				return nil
+			}, filter)
+			if err != nil {
+				return err
+			}
+
+			var data []byte
+			for _, line := range lines {
+				data = append(data, line+"\n"...)
+			}
+			p := c.printer(ctx)
+			return p.emitDump(ctx, data, func() error {
+				for _, line := range lines {
+					if err := p.emitText(line); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}),
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// scriptExporter produces the apply operations turning the defaults into the
+// current value.
+type scriptExporter struct {
+	c      *constructor
+	reveal bool
+	lines  []string
+}
+
+// leaveOutSecret adds a comment in place of the operations for a value which
+// is or contains secrets, unless they are to be revealed.
+func (e *scriptExporter) leaveOutSecret(path []string, secret bool) bool {
+	if e.reveal || !secret {
+		return false
+	}
+	e.lines = append(e.lines, fmt.Sprintf("# %s left out as it is secret, use --reveal to include it", strings.Join(path, ".")))
+	return true
+}
+
+func (e *scriptExporter) add(op string, path []string, args ...string) {
+	line := op + " " + scriptQuote(strings.Join(path, "."))
+	for _, arg := range args {
+		line += " " + scriptQuote(arg)
+	}
+	e.lines = append(e.lines, line)
+}
+
+// scriptQuote shell quotes the argument, unless it is made of characters
+// which need no quoting.
+func scriptQuote(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._-:/", r))
+	}) >= 0 {
+		return shellQuote(s)
+	}
+	return s
+}
+
+// jsonArg returns the value json encoded, as taken by apply for anything but
+// primitives.
+func jsonArg(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Interface {
+		value, err := interfaceValue(v)
+		return string(value), err
+	}
+	vi, err := dumpable(v)
+	if err != nil {
+		return "", err
+	}
+	bs, err := marshalJSON(vi)
+	return string(bs), err
+}
+
+// primitiveArg returns the value formatted the way set parses it.
+func primitiveArg(v reflect.Value) (string, bool, error) {
+	v = deref(v)
+	if !v.IsValid() {
+		return "", false, nil
+	}
+	value, err := GetPrimitiveValue(v)
+	return fmt.Sprint(value), true, err
+}
+
+// export adds the operations for the differences between v and base, which
+// is invalid if there is nothing to compare against.
+func (e *scriptExporter) export(path []string, v, base reflect.Value) error {
+	if base.IsValid() && reflect.DeepEqual(v.Interface(), base.Interface()) {
+		return nil
+	}
+
+	if isPrimitiveType(v.Type()) {
+		value, ok, err := primitiveArg(v)
+		if err != nil || !ok {
+			// Pointers cannot be set back to nil
+			return err
+		}
+		e.add("set", path, value)
+		return nil
+	}
+
+	dv, dbase := deref(v), deref(base)
+	if !dv.IsValid() {
+		return nil
+	}
+
+	// Things without a counterpart cannot be addressed by their paths yet,
+	// so are set as a whole
+	if !dbase.IsValid() && len(path) > 0 || dv.Kind() == reflect.Interface {
+		if e.leaveOutSecret(path, e.c.hasSecrets(dv.Type())) {
+			return nil
+		}
+		value, err := jsonArg(dv)
+		if err != nil {
+			return err
+		}
+		e.add("set", path, value)
+		return nil
+	}
+
+	switch dv.Kind() {
+	case reflect.Struct:
+		t := dv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if e.c.isSkipped(f) {
+				continue
+			}
+			fieldPath := appendPath(path, e.c.fieldName(f))
+			if e.c.isSecret(f) && reflect.DeepEqual(dv.Field(i).Interface(), dbase.Field(i).Interface()) {
+				continue
+			}
+			if e.leaveOutSecret(fieldPath, e.c.isSecret(f)) {
+				continue
+			}
+			if err := e.export(fieldPath, dv.Field(i), dbase.Field(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice:
+		if e.leaveOutSecret(path, e.c.hasSecrets(dv.Type().Elem())) {
+			return nil
+		}
+		if dbase.Len() > 0 {
+			e.add("clear", path)
+		}
+		for i := 0; i < dv.Len(); i++ {
+			value, err := e.itemArg(dv.Index(i))
+			if err != nil {
+				return err
+			}
+			e.add("add", path, value)
+		}
+
+	case reflect.Array:
+		keyer := e.c.makeKeyer(dv)
+		for i := 0; i < dv.Len(); i++ {
+			key, err := keyer(i)
+			if err != nil {
+				return err
+			}
+			if err := e.export(appendPath(path, key), dv.Index(i), dbase.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		keys, err := sortedMapKeys(dv)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			var baseEntry reflect.Value
+			if !dbase.IsNil() {
+				baseEntry = dbase.MapIndex(key.value)
+			}
+			if err := e.export(appendPath(path, key.name), dv.MapIndex(key.value), baseEntry); err != nil {
+				return err
+			}
+		}
+		baseKeys, err := sortedMapKeys(dbase)
+		if err != nil {
+			return err
+		}
+		for _, key := range baseKeys {
+			if !dv.MapIndex(key.value).IsValid() {
+				e.add("unset", appendPath(path, key.name))
+			}
+		}
+	}
+	return nil
+}
+
+func (e *scriptExporter) itemArg(v reflect.Value) (string, error) {
+	if isPrimitiveType(v.Type()) {
+		value, _, err := primitiveArg(v)
+		return value, err
+	}
+	return jsonArg(v)
+}
+
+type mapKey struct {
+	name  string
+	value reflect.Value
+}
+
+// sortedMapKeys returns the formatted keys of the map in sorted order.
+func sortedMapKeys(v reflect.Value) ([]mapKey, error) {
+	keys := make([]mapKey, 0, v.Len())
+	for _, keyValue := range v.MapKeys() {
+		key, err := GetPrimitiveValue(keyValue)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, mapKey{fmt.Sprint(key), keyValue})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].name < keys[j].name
+	})
+	return keys, nil
+}
+
+// makeScriptExporter returns the export-script command, printing the apply
+// script which turns the defaults into the current value.
+func (c *constructor) makeScriptExporter(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:     "export-script",
+		Usage:    "Print the apply script recreating the current values from the defaults",
+		Category: "ACTIONS",
+		Flags:    append(c.revealFlags(v.Type()), outputFileFlag(c.cfg)),
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			base := reflect.New(v.Type())
+			if err := setDefaults(c.defaults(), base.Interface()); err != nil {
+				return err
+			}
+
+			e := &scriptExporter{c: c, reveal: ctx.Bool("reveal")}
+			if err := e.export(nil, v, base.Elem()); err != nil {
+				return err
+			}
+
+			var data []byte
+			for _, line := range e.lines {
+				data = append(data, line+"\n"...)
+			}
+			p := c.printer(ctx)
+			return p.emitDump(ctx, data, func() error {
+				for _, line := range e.lines {
+					if err := p.emitText(line); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}),
+	}
+}
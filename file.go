@@ -0,0 +1,165 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// fileFormat converts between json and the format of a file, so that files
+// go through the same marshaling as dump-json and set-json.
+type fileFormat struct {
+	fromJSON func([]byte) ([]byte, error)
+	toJSON   func([]byte) ([]byte, error)
+}
+
+func noConversion(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// fileFormats are the supported formats keyed by file extension. Yaml is
+// added by the yamlfiles package.
+var fileFormats = map[string]fileFormat{
+	".json": {noConversion, noConversion},
+}
+
+// RegisterFileFormat adds a file format to export and import, used for the
+// files with the extension, such as ".yaml". fromJSON converts the json of a
+// value to the format, and toJSON converts back. Importing
+// github.com/AudriusButkevicius/recli/yamlfiles registers yaml.
+func RegisterFileFormat(ext string, fromJSON, toJSON func([]byte) ([]byte, error)) {
+	fileFormats[strings.ToLower(ext)] = fileFormat{fromJSON, toJSON}
+}
+
+func fileFormatFor(path string) (fileFormat, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if format, ok := fileFormats[ext]; ok {
+		return format, nil
+	}
+	exts := make([]string, 0, len(fileFormats))
+	for ext := range fileFormats {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return fileFormat{}, fmt.Errorf("%s: unsupported file extension %q, expected one of: %s", path, ext, strings.Join(exts, ", "))
+}
+
+// writeFile creates or truncates the file, readable only by the owner as it
+// might hold secrets.
+func writeFile(path string, data []byte) error {
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+func (c *constructor) makeFileExporter(v reflect.Value, dumpable dumpFunc) cli.Command {
+	return cli.Command{
+		Name:      "export",
+		Usage:     "Write the value to a file, in the format chosen by the extension",
+		ArgsUsage: "[path]",
+		Category:  "ACTIONS",
+		Flags:     c.revealFlags(v.Type()),
+		Action: expectArgs(1, func(ctx *cli.Context) error {
+			path := ctx.Args().First()
+			format, err := fileFormatFor(path)
+			if err != nil {
+				return err
+			}
+			vi, err := dumpable(c.revealed(ctx, v))
+			if err != nil {
+				return err
+			}
+			data, err := marshalJSONIndent(vi)
+			if err != nil {
+				return err
+			}
+			if data, err = format.fromJSON(append(data, '\n')); err != nil {
+				return err
+			}
+			if err := writeFile(path, data); err != nil {
+				return err
+			}
+			return c.printer(ctx).emitText(fmt.Sprintf("wrote %d bytes to %s", len(data), path))
+		}),
+	}
+}
+
+func (c *constructor) makeFileImporter(v reflect.Value) cli.Command {
+	cmd := cli.Command{
+		Name:      "import",
+		Usage:     "Replace the value with the contents of a file, in the format chosen by the extension",
+		ArgsUsage: "[path]",
+		Category:  "ACTIONS",
+		Action: expectArgs(1, func(ctx *cli.Context) error {
+			path := ctx.Args().First()
+			format, err := fileFormatFor(path)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if data, err = format.toJSON(data); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+
+			// Unmarshal into a temporary, so that a bad file does not leave
+			// the value half set
+			newValue := reflect.New(v.Type()).Elem()
+			if err := json.Unmarshal(data, newValue.Addr().Interface()); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			if ctx.Bool("append") {
+				newValue = reflect.AppendSlice(v, newValue)
+			}
+			if err := validate(newValue); err != nil {
+				return err
+			}
+			v.Set(newValue)
+			return nil
+		}),
+	}
+	if v.Kind() == reflect.Slice {
+		cmd.Usage = "Replace or append to the items with the contents of a json or yaml file, chosen by the extension"
+		cmd.Flags = []cli.Flag{
+			cli.BoolFlag{
+				Name:  "append",
+				Usage: "Append the items instead of replacing the existing ones",
+			},
+		}
+	}
+	return cmd
+}
+
+// makeFileCommands returns the export command, and the import command if the
+// value can be set, unless Config.FileCommands is off.
+func (c *constructor) makeFileCommands(v reflect.Value, dumpable dumpFunc) []cli.Command {
+	if !c.cfg.FileCommands {
+		return nil
+	}
+	cmds := []cli.Command{c.makeFileExporter(v, dumpable)}
+	if v.CanSet() {
+		cmds = append(cmds, c.makeFileImporter(v))
+	}
+	return cmds
+}
@@ -0,0 +1,50 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"github.com/urfave/cli"
+)
+
+// ConstructFlat returns the commands Construct generates for the item as a
+// flat list, with one command per action named after its path joined by
+// Config.FlatSeparator, such as device.name.get. The commands of the first
+// and last items stay commands taking the rest of the path as arguments,
+// such as devices.last name get. Commands are hidden if any of their parents
+// is.
+func (c *constructor) ConstructFlat(item interface{}) ([]cli.Command, error) {
+	cmds, err := c.Construct(item)
+	if err != nil {
+		return nil, err
+	}
+
+	sep := c.cfg.FlatSeparator
+	if sep == "" {
+		sep = "."
+	}
+	var flat []cli.Command
+	var flatten func(prefix string, hidden bool, cmds []cli.Command)
+	flatten = func(prefix string, hidden bool, cmds []cli.Command) {
+		for _, cmd := range cmds {
+			name := prefix + cmd.Name
+			if cmd.Action != nil {
+				cmd.Name = name
+				cmd.Hidden = cmd.Hidden || hidden
+				if prefix != "" {
+					// The aliases only apply to the last segment
+					cmd.Aliases = nil
+				}
+				flat = append(flat, cmd)
+				continue
+			}
+			flatten(name+sep, hidden || cmd.Hidden, cmd.Subcommands)
+		}
+	}
+	flatten("", false, cmds)
+
+	return flat, validateCommandNames(flat)
+}
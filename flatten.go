@@ -0,0 +1,137 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Flatten flattens the item using the default constructor, see
+// Constructor.Flatten.
+func Flatten(item interface{}) (map[string]interface{}, error) {
+	return Default.Flatten(item)
+}
+
+// Unflatten applies the values using the default constructor, see
+// Constructor.Unflatten.
+func Unflatten(values map[string]interface{}, target interface{}) error {
+	return Default.Unflatten(values, target)
+}
+
+// Flatten returns the leaves Walk visits keyed by their dot separated paths.
+// Primitives are given the way get prints them, nil pointers as nil, slices
+// of primitives as a []interface{} of their items and interface values as
+// they are.
+func (c *constructor) Flatten(item interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	err := c.Walk(item, func(path []string, v reflect.Value) error {
+		value, err := flatValue(v)
+		if err != nil {
+			return errors.Wrap(err, strings.Join(path, "."))
+		}
+		values[strings.Join(path, ".")] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func flatValue(v reflect.Value) (interface{}, error) {
+	v = deref(v)
+	switch {
+	case !v.IsValid():
+		return nil, nil
+	case v.Kind() == reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return v.Elem().Interface(), nil
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && !isPrimitive(v):
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := flatValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return GetPrimitiveValue(v)
+}
+
+// Unflatten sets the values of the target, which has to be a pointer, keyed
+// by the paths Flatten produces, in sorted order. Values are converted the
+// way set parses them from their default formatting, slices of primitives
+// may be given as any slice, and nil zeroes the value. New map entries are
+// added, unless their keys contain dots, while slice items and pointers to
+// structs have to exist already.
+// Either all values are applied, or the target is left untouched.
+func (c *constructor) Unflatten(values map[string]interface{}, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("expected a non-nil pointer, got %T", target)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Apply to a copy, so that a bad value does not leave the target half
+	// set, and copy the result back in place
+	newValue := deepCopy(v.Elem())
+	for _, key := range keys {
+		resolved, err := c.resolvePath(newValue, strings.Split(key, "."))
+		if err != nil {
+			return err
+		}
+		if err := setFlatValue(resolved.value, values[key]); err != nil {
+			return errors.Wrap(err, key)
+		}
+		resolved.commit()
+	}
+	copyInPlace(v.Elem(), newValue, make(map[seenPointer]reflect.Value))
+	return nil
+}
+
+func setFlatValue(v reflect.Value, value interface{}) error {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	if v.Kind() == reflect.Interface {
+		if !reflect.TypeOf(value).AssignableTo(v.Type()) {
+			return fmt.Errorf("%T is not assignable to %s", value, v.Type())
+		}
+		v.Set(reflect.ValueOf(value))
+		return nil
+	}
+
+	v = derefAndInit(v)
+	if (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && !isPrimitive(v) {
+		items := reflect.ValueOf(value)
+		if items.Kind() != reflect.Slice && items.Kind() != reflect.Array {
+			return fmt.Errorf("expected a slice, got %T", value)
+		}
+		args := make([]string, items.Len())
+		for i := range args {
+			args[i] = fmt.Sprint(items.Index(i).Interface())
+		}
+		return setSliceValueFromStrings(v, args)
+	}
+	return SetPrimitiveValueFromString(v, fmt.Sprint(value))
+}
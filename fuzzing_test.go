@@ -0,0 +1,87 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+//go:build go1.18
+// +build go1.18
+
+package recli
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var fuzzSeeds = []string{
+	"", "-", "+", "0x", "0b", "0o", "_", "NaN", "nan", "+Inf", "-Inf", "inf",
+	"0", "-0", "1", "-1", "1e308", "1e309", "-1e309", "0x1p-2", "1_000",
+	"127", "128", "-129", "255", "256", "65536", "4294967296",
+	"9223372036854775807", "9223372036854775808", "-9223372036854775809",
+	"18446744073709551615", "18446744073709551616",
+	"true", "false", "TRUE", "t", "F", "yes",
+	"\x00", "1\x00", "\xff\xfe", "1+2i", strings.Repeat("9", 10000),
+}
+
+// fuzzSetPrimitive sets values of the types from the fuzzed strings, failing
+// on panics, and calls check with the values set successfully.
+func fuzzSetPrimitive(f *testing.F, types []reflect.Type, check func(t *testing.T, arg string, v reflect.Value)) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, arg string) {
+		for _, typ := range types {
+			v := reflect.New(typ).Elem()
+			if err := SetPrimitiveValueFromString(v, arg); err == nil {
+				check(t, arg, v)
+			}
+		}
+	})
+}
+
+func FuzzSetPrimitiveInt(f *testing.F) {
+	types := []reflect.Type{
+		reflect.TypeOf(int(0)), reflect.TypeOf(int8(0)), reflect.TypeOf(int16(0)),
+		reflect.TypeOf(int32(0)), reflect.TypeOf(int64(0)),
+		reflect.TypeOf(uint(0)), reflect.TypeOf(uint8(0)), reflect.TypeOf(uint16(0)),
+		reflect.TypeOf(uint32(0)), reflect.TypeOf(uint64(0)),
+	}
+	fuzzSetPrimitive(f, types, func(t *testing.T, arg string, v reflect.Value) {
+		bits := v.Type().Bits()
+		if isUnsignedKind(v.Kind()) {
+			if cv, err := strconv.ParseUint(arg, 0, bits); err != nil || cv != v.Uint() {
+				t.Errorf("%q set %s to %d", arg, v.Type(), v.Uint())
+			}
+		} else if cv, err := strconv.ParseInt(arg, 0, bits); err != nil || cv != v.Int() {
+			t.Errorf("%q set %s to %d", arg, v.Type(), v.Int())
+		}
+	})
+}
+
+func FuzzSetPrimitiveBool(f *testing.F) {
+	fuzzSetPrimitive(f, []reflect.Type{reflect.TypeOf(false)}, func(t *testing.T, arg string, v reflect.Value) {
+		if cv, err := strconv.ParseBool(arg); err != nil || cv != v.Bool() {
+			t.Errorf("%q set bool to %t", arg, v.Bool())
+		}
+	})
+}
+
+func FuzzSetPrimitiveFloat(f *testing.F) {
+	types := []reflect.Type{reflect.TypeOf(float32(0)), reflect.TypeOf(float64(0))}
+	fuzzSetPrimitive(f, types, func(t *testing.T, arg string, v reflect.Value) {
+		if _, err := strconv.ParseFloat(arg, v.Type().Bits()); err != nil {
+			t.Errorf("%q set %s to %v", arg, v.Type(), v.Float())
+		}
+	})
+}
+
+func FuzzSetPrimitiveString(f *testing.F) {
+	fuzzSetPrimitive(f, []reflect.Type{reflect.TypeOf("")}, func(t *testing.T, arg string, v reflect.Value) {
+		if v.String() != arg {
+			t.Errorf("%q set string to %q", arg, v.String())
+		}
+	})
+}
@@ -1,8 +1,9 @@
 module github.com/AudriusButkevicius/recli
 
-go 1.15
+go 1.17
 
 require (
 	github.com/pkg/errors v0.8.1
+	github.com/spf13/pflag v1.0.5
 	github.com/urfave/cli v1.20.0
 )
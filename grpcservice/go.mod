@@ -0,0 +1,22 @@
+module github.com/AudriusButkevicius/recli/grpcservice
+
+go 1.17
+
+require (
+	github.com/AudriusButkevicius/recli v0.0.0-00010101000000-000000000000
+	google.golang.org/grpc v1.36.0
+)
+
+require (
+	github.com/golang/protobuf v1.4.2 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/urfave/cli v1.20.0 // indirect
+	golang.org/x/net v0.0.0-20190311183353-d8887717615a // indirect
+	golang.org/x/sys v0.0.0-20190215142949-d0b11bdaac8a // indirect
+	golang.org/x/text v0.3.0 // indirect
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
+)
+
+replace github.com/AudriusButkevicius/recli => ../
@@ -0,0 +1,249 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package grpcservice serves an item as a gRPC service, with methods getting
+// and changing its properties the same way as the REST API of
+// Constructor.ConstructHTTP does.
+//
+// It is a module of its own, so that the gRPC dependency is opt in.
+package grpcservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/AudriusButkevicius/recli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// ContentSubtype is the content subtype of the json codec the services use,
+// registered under a name of its own so that it does not replace any other
+// json codec. Clients pick it by calling with
+// grpc.CallContentSubtype(ContentSubtype), which sends the
+// application/grpc+recli-json content type.
+const ContentSubtype = "recli-json"
+
+// itemPlaceholder is the path segment of slice items and map entries, as
+// passed by Constructor.WalkType.
+const itemPlaceholder = "<key>"
+
+// codec encodes the messages of the services as json.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return ContentSubtype
+}
+
+// Request is the request message of the methods.
+type Request struct {
+	// Keys are the keys of the slice items and map entries along the path
+	// to the property, outermost first.
+	Keys []string `json:"keys,omitempty"`
+	// Value is the json value to set or add.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// method is an http request on the property at a path, where each <key> is
+// filled in from Request.Keys.
+type method struct {
+	name       string
+	httpMethod string
+	path       []string
+}
+
+// New returns a gRPC service for the item using the default constructor,
+// see NewWith.
+func New(item interface{}) (*grpc.ServiceDesc, error) {
+	return NewWith(recli.Default, item)
+}
+
+// NewWith returns a gRPC service named after the type of the item, with
+// methods named after the Go fields, such as GetName and SetName for
+// properties, and ListBackends, AddBackends and DeleteBackends for slices
+// and maps, whose Get and Set methods take the key of an item. The methods
+// take a json encoded Request and return the json encoded value, so clients
+// have to call them with grpc.CallContentSubtype(ContentSubtype). Register
+// the service with grpc.Server.RegisterService, with a nil implementation.
+// Secrets, Config.Mutex, Config.Validate and Config.OnMutation apply as they
+// do for Constructor.ConstructHTTP. The item has to be a pointer to a
+// struct.
+func NewWith(c recli.Constructor, item interface{}) (*grpc.ServiceDesc, error) {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a non-nil pointer to a struct, got %T", item)
+	}
+	mux := http.NewServeMux()
+	if err := c.ConstructHTTP(item, mux); err != nil {
+		return nil, err
+	}
+
+	var methods []method
+	prefixes := make(map[string]string)
+	err := c.WalkType(item, func(path []string, t reflect.Type, field *reflect.StructField) error {
+		// Items share the name of their slice or map
+		var prefix string
+		if len(path) > 0 {
+			prefix = prefixes[strings.Join(path[:len(path)-1], ".")]
+			if path[len(path)-1] != itemPlaceholder {
+				prefix += field.Name
+			}
+		}
+		prefixes[strings.Join(path, ".")] = prefix
+
+		switch kind := t.Kind(); {
+		case recli.IsPrimitiveType(t), kind == reflect.Interface, kind == reflect.Struct:
+		case (kind == reflect.Slice || kind == reflect.Array) && recli.IsPrimitiveType(t.Elem()):
+		default:
+			methods = append(methods, method{"List" + prefix, http.MethodGet, path})
+			if kind == reflect.Slice {
+				methods = append(methods, method{"Add" + prefix, http.MethodPost, path})
+			}
+			if kind != reflect.Array {
+				methods = append(methods, method{"Delete" + prefix, http.MethodDelete, append(path[:len(path):len(path)], itemPlaceholder)})
+			}
+			return nil
+		}
+		methods = append(methods,
+			method{"Get" + prefix, http.MethodGet, path},
+			method{"Set" + prefix, http.MethodPut, path},
+		)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &grpc.ServiceDesc{
+		ServiceName: v.Elem().Type().String(),
+		HandlerType: (*interface{})(nil),
+		Metadata:    "recli",
+	}
+	seen := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		if seen[m.name] {
+			return nil, fmt.Errorf("duplicate method name: %s", m.name)
+		}
+		seen[m.name] = true
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: m.name,
+			Handler:    handler(mux, desc.ServiceName, m),
+		})
+	}
+	return desc, nil
+}
+
+// handler returns the handler of the method, filling in the keys of the
+// request and converting the http statuses to gRPC codes.
+func handler(h http.Handler, service string, m method) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	call := func(ctx context.Context, req interface{}) (interface{}, error) {
+		request := req.(*Request)
+		path := make([]string, len(m.path))
+		keys := request.Keys
+		for i, segment := range m.path {
+			if segment == itemPlaceholder {
+				if len(keys) == 0 {
+					return nil, status.Errorf(codes.InvalidArgument, "%s: missing key", m.name)
+				}
+				segment, keys = keys[0], keys[1:]
+			}
+			path[i] = segment
+		}
+		if len(keys) > 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: too many keys", m.name)
+		}
+
+		r, err := http.NewRequestWithContext(ctx, m.httpMethod, "/", bytes.NewReader(request.Value))
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		r.URL = &url.URL{Path: "/" + strings.Join(path, "/")}
+		w := &responseWriter{header: make(http.Header), status: http.StatusOK}
+		h.ServeHTTP(w, r)
+
+		body := bytes.TrimSpace(w.body.Bytes())
+		if w.status >= http.StatusBadRequest {
+			return nil, status.Error(code(w.status), string(body))
+		}
+		if len(body) == 0 {
+			return json.RawMessage("null"), nil
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, body); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return json.RawMessage(compact.Bytes()), nil
+	}
+
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		request := new(Request)
+		if err := dec(request); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if interceptor == nil {
+			return call(ctx, request)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + service + "/" + m.name,
+		}
+		return interceptor(ctx, request, info, call)
+	}
+}
+
+// code converts the status of a failed http request to a gRPC code.
+func code(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusMethodNotAllowed:
+		return codes.Unimplemented
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+	return codes.InvalidArgument
+}
+
+// responseWriter records the response of the REST API.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
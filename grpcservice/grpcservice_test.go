@@ -0,0 +1,109 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package grpcservice
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type Backend struct {
+	Name string `recli:"id"`
+	Port int
+}
+
+type Config struct {
+	Name     string
+	Key      string `recli:"secret"`
+	Labels   map[string]string
+	Tags     []string
+	Backends []Backend
+}
+
+func TestNew(t *testing.T) {
+	x := &Config{
+		Name:     "a",
+		Key:      "hunter2",
+		Labels:   map[string]string{"env": "prod"},
+		Backends: []Backend{{Name: "b", Port: 1}},
+	}
+
+	desc, err := New(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.ServiceName != "grpcservice.Config" {
+		t.Errorf("unexpected service name: %s", desc.ServiceName)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	srv.RegisterService(desc, nil)
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, tc := range []struct {
+		method   string
+		keys     []string
+		value    string
+		code     codes.Code
+		expected string
+	}{
+		{"GetName", nil, "", codes.OK, `"a"`},
+		{"SetName", nil, `"c"`, codes.OK, `null`},
+		{"GetName", nil, "", codes.OK, `"c"`},
+		{"GetKey", nil, "", codes.PermissionDenied, ""},
+		{"GetBackendsPort", []string{"b"}, "", codes.OK, `1`},
+		{"SetBackendsPort", []string{"b"}, `2`, codes.OK, `null`},
+		{"AddBackends", nil, `{"Name": "d", "Port": 3}`, codes.OK, `"d"`},
+		{"ListBackends", nil, "", codes.OK, `[{"Name":"b","Port":2},{"Name":"d","Port":3}]`},
+		{"GetBackends", []string{"d"}, "", codes.OK, `{"Name":"d","Port":3}`},
+		{"DeleteBackends", []string{"b"}, "", codes.OK, `null`},
+		{"DeleteBackends", []string{"b"}, "", codes.NotFound, ""},
+		{"SetLabels", []string{"team"}, `"infra"`, codes.OK, `null`},
+		{"ListLabels", nil, "", codes.OK, `{"env":"prod","team":"infra"}`},
+		{"DeleteLabels", []string{"env"}, "", codes.OK, `null`},
+		{"GetLabels", []string{"env"}, "", codes.NotFound, ""},
+		{"SetTags", nil, `["x","y"]`, codes.OK, `null`},
+		{"GetTags", nil, "", codes.OK, `["x","y"]`},
+		{"SetBackendsPort", []string{"d"}, `"x"`, codes.InvalidArgument, ""},
+		{"GetBackendsPort", nil, "", codes.InvalidArgument, ""},
+		{"GetName", []string{"a"}, "", codes.InvalidArgument, ""},
+	} {
+		var resp json.RawMessage
+		req := &Request{Keys: tc.keys, Value: json.RawMessage(tc.value)}
+		err := conn.Invoke(context.Background(), "/"+desc.ServiceName+"/"+tc.method, req, &resp, grpc.CallContentSubtype(ContentSubtype))
+		if code := status.Code(err); code != tc.code {
+			t.Errorf("%s %v: unexpected code %s: %v", tc.method, tc.keys, code, err)
+			continue
+		}
+		if err == nil && string(resp) != tc.expected {
+			t.Errorf("%s %v: unexpected response: %s", tc.method, tc.keys, resp)
+		}
+	}
+
+	if x.Name != "c" || len(x.Backends) != 1 || x.Backends[0].Name != "d" || x.Labels["team"] != "infra" || len(x.Labels) != 1 {
+		t.Errorf("unexpected value: %+v", x)
+	}
+}
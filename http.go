@@ -0,0 +1,259 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// httpError is an error along with the status code to respond with.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func httpErrorf(status int, format string, args ...interface{}) error {
+	return &httpError{status, fmt.Errorf(format, args...)}
+}
+
+type httpHandler struct {
+	c    *constructor
+	root reflect.Value
+}
+
+// ConstructHTTP registers a handler on the mux at /, serving the item as a
+// REST API of json values. The URL paths are the paths of command names,
+// separated by slashes, such as /backends/a/port. GET returns the value at
+// the path, PUT replaces it, or adds a new map entry, POST appends an item
+// to a slice, responding with its key, and DELETE removes a slice item or a
+// map entry. Secrets are redacted, and secret primitives cannot be read.
+// Config.Mutex, Config.Validate and Config.OnMutation apply as they do for
+// the commands. The item has to be a pointer to a struct, slice or map.
+func (c *constructor) ConstructHTTP(item interface{}, mux *http.ServeMux) error {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("expected a non-nil pointer, got %T", item)
+	}
+	switch v.Elem().Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map:
+	default:
+		return fmt.Errorf("expected pointer to a struct, slice or map got a pointer to: %s", v.Elem().Kind())
+	}
+	mux.Handle("/", &httpHandler{c, v.Elem()})
+	return nil
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var path []string
+	for _, segment := range strings.Split(r.URL.Path, "/") {
+		if segment != "" {
+			path = append(path, segment)
+		}
+	}
+
+	var body interface{}
+	var err error
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		body, err = h.read(path)
+	case http.MethodPut, http.MethodPost, http.MethodDelete:
+		data, readErr := ioutil.ReadAll(r.Body)
+		if readErr != nil {
+			http.Error(w, readErr.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err = h.write(path, func() (interface{}, error) {
+			switch r.Method {
+			case http.MethodPut:
+				status = http.StatusNoContent
+				return nil, h.put(path, data)
+			case http.MethodPost:
+				status = http.StatusCreated
+				return h.post(path, data)
+			default:
+				status = http.StatusNoContent
+				return nil, h.delete(path)
+			}
+		})
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST, DELETE")
+		err = httpErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+
+	if err != nil {
+		status = http.StatusBadRequest
+		var herr *httpError
+		if errors.As(err, &herr) {
+			status = herr.status
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	data, err := marshalJSONIndent(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(data, '\n'))
+}
+
+// read returns the value at the path, holding Config.Mutex for reading.
+func (h *httpHandler) read(path []string) (interface{}, error) {
+	if mut := h.c.cfg.Mutex; mut != nil {
+		mut.RLock()
+		defer mut.RUnlock()
+	}
+	return h.get(path)
+}
+
+// write runs the change to the value at the path, holding Config.Mutex, and
+// rolls it back if it fails, or if Config.Validate or Config.OnMutation do.
+func (h *httpHandler) write(path []string, change func() (interface{}, error)) (interface{}, error) {
+	if mut := h.c.cfg.Mutex; mut != nil {
+		mut.Lock()
+		defer mut.Unlock()
+	}
+	var body interface{}
+	_, err := h.c.mutate(h.root, path, func() (bool, error) {
+		var err error
+		body, err = change()
+		return true, err
+	})
+	return body, err
+}
+
+func (h *httpHandler) resolve(path []string) (pathTarget, error) {
+	target, err := h.c.resolvePath(h.root, path)
+	if err != nil {
+		return pathTarget{}, &httpError{http.StatusNotFound, err}
+	}
+	return target, nil
+}
+
+func (h *httpHandler) get(path []string) (interface{}, error) {
+	target, err := h.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	if target.missing {
+		return nil, httpErrorf(http.StatusNotFound, "%s: no such key", strings.Join(path, "/"))
+	}
+	if target.field != nil && h.c.isSecret(*target.field) {
+		return nil, httpErrorf(http.StatusForbidden, "%s: value is secret", strings.Join(path, "/"))
+	}
+	v := deref(target.value)
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if h.c.hasSecrets(v.Type()) {
+		v = deepCopy(v)
+		h.c.redact(v, make(map[uintptr]bool))
+	}
+	if isPrimitive(v) {
+		return GetPrimitiveValue(v)
+	}
+	return v.Interface(), nil
+}
+
+// decode unmarshals the json into a new value of the type, validating it.
+func decode(data []byte, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	if err := json.Unmarshal(data, v.Addr().Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v, validate(v)
+}
+
+func (h *httpHandler) put(path []string, data []byte) error {
+	target, err := h.resolve(path)
+	if err != nil {
+		return err
+	}
+	v, err := decode(data, target.value.Type())
+	if err != nil {
+		return err
+	}
+	if target.field != nil {
+		if err := h.c.validateField(*target.field, deref(v)); err != nil {
+			return err
+		}
+	}
+	target.value.Set(v)
+	target.commit()
+	return nil
+}
+
+func (h *httpHandler) post(path []string, data []byte) (interface{}, error) {
+	target, err := h.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	v := deref(target.value)
+	if v.Kind() != reflect.Slice || isPrimitive(v) {
+		return nil, httpErrorf(http.StatusMethodNotAllowed, "%s: not a slice", strings.Join(path, "/"))
+	}
+	item, err := decode(data, v.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	v.Set(reflect.Append(v, item))
+	target.commit()
+	return h.c.makeKeyer(v)(v.Len() - 1)
+}
+
+func (h *httpHandler) delete(path []string) error {
+	if len(path) == 0 {
+		return httpErrorf(http.StatusMethodNotAllowed, "cannot delete the root")
+	}
+	target, err := h.resolve(path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	key := path[len(path)-1]
+	v := deref(target.value)
+	switch {
+	case v.Kind() == reflect.Slice && !isPrimitive(v):
+		keyer := h.c.makeKeyer(v)
+		for i := 0; i < v.Len(); i++ {
+			if itemKey, err := keyer(i); err == nil && itemKey == key {
+				v.Set(reflect.AppendSlice(v.Slice(0, i), v.Slice(i+1, v.Len())))
+				target.commit()
+				return nil
+			}
+		}
+	case v.Kind() == reflect.Map:
+		keyValue, err := stringToPrimitiveValue(key, v.Type().Key())
+		if err != nil {
+			return &httpError{http.StatusNotFound, err}
+		}
+		if v.MapIndex(keyValue).IsValid() {
+			v.SetMapIndex(keyValue, reflect.Value{})
+			target.commit()
+			return nil
+		}
+	default:
+		return httpErrorf(http.StatusMethodNotAllowed, "%s: not a slice item or map entry", strings.Join(path, "/"))
+	}
+	return httpErrorf(http.StatusNotFound, "%s: no such key", strings.Join(path, "/"))
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/urfave/cli"
+)
+
+// rawJSON is json encoded text, which prints as is and marshals verbatim.
+type rawJSON string
+
+func (r rawJSON) MarshalJSON() ([]byte, error) {
+	return []byte(r), nil
+}
+
+// interfaceValue returns the json encoding of an interface value, whose
+// dynamic type is not known up front.
+func interfaceValue(v reflect.Value) (rawJSON, error) {
+	var vi interface{}
+	if v.IsValid() && !v.IsNil() {
+		vi = v.Interface()
+	}
+	bs, err := marshalJSON(vi)
+	return rawJSON(bs), err
+}
+
+// setMapJSON unmarshals the json into a new value and stores it under the key.
+func setMapJSON(v, keyValue reflect.Value, data []byte) error {
+	value := reflect.New(v.Type().Elem())
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return err
+	}
+	if v.IsNil() {
+		if !v.CanSet() {
+			return fmt.Errorf("cannot set key in nil %s", v.Type())
+		}
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	v.SetMapIndex(keyValue, value.Elem())
+	return nil
+}
+
+// makeInterfaceMapCommands handles maps of interface values, such as
+// map[string]interface{}, whose values are read and written as json.
+func (c *constructor) makeInterfaceMapCommands(v reflect.Value) ([]cli.Command, error) {
+	actions := []cli.Command{
+		c.makeCountCommand(v),
+		c.makeJsonDumper(v, "Dump all keys and their values as a json object", mapDumpable),
+		{
+			Name:     "dump",
+			Usage:    "Dump all keys and their values as json",
+			Category: "ACTIONS",
+			Action: expectArgs(0, func(ctx *cli.Context) error {
+				kvs := make([]keyValuePair, 0, v.Len())
+				for _, keyValue := range v.MapKeys() {
+					key, err := GetPrimitiveValue(keyValue)
+					if err != nil {
+						return err
+					}
+					value, err := interfaceValue(v.MapIndex(keyValue))
+					if err != nil {
+						return err
+					}
+					kvs = append(kvs, keyValuePair{key, value})
+				}
+				return c.printer(ctx).emitKeyValues(kvs)
+			}),
+		},
+		{
+			Name:      "get",
+			ArgsUsage: "[key]",
+			Usage:     "Get the value of a given key as json",
+			Category:  "ACTIONS",
+			Action: expectArgs(1, func(ctx *cli.Context) error {
+				keyValue, err := stringToPrimitiveValue(ctx.Args().First(), v.Type().Key())
+				if err != nil {
+					return err
+				}
+				return c.printer(ctx).printJSONIndent(v.MapIndex(keyValue))
+			}),
+		},
+		{
+			Name:      "set",
+			ArgsUsage: "[key] [value|@file|-]",
+			Usage:     "Set the key to the given json value",
+			Category:  "ACTIONS",
+			Action: expectArgs(2, func(ctx *cli.Context) error {
+				keyValue, err := stringToPrimitiveValue(ctx.Args().First(), v.Type().Key())
+				if err != nil {
+					return err
+				}
+				data, err := readInput(ctx.Args().Get(1))
+				if err != nil {
+					return err
+				}
+				return setMapJSON(v, keyValue, data)
+			}),
+		},
+		{
+			Name:      "unset",
+			ArgsUsage: "[key]",
+			Usage:     "Remove the key from the map",
+			Category:  "ACTIONS",
+			Action: expectArgs(1, func(ctx *cli.Context) error {
+				keyValue, err := stringToPrimitiveValue(ctx.Args().First(), v.Type().Key())
+				if err != nil {
+					return err
+				}
+				v.SetMapIndex(keyValue, reflect.Value{})
+				return nil
+			}),
+		},
+	}
+	actions = append(actions, c.makeExtraDumpers(v, mapDumpable)...)
+	actions = append(actions, c.makeFileCommands(v, mapDumpable)...)
+
+	names := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		names[action.Name] = true
+	}
+
+	type entry struct {
+		key      string
+		keyValue reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	for _, keyValue := range v.MapKeys() {
+		key, err := GetPrimitiveValue(keyValue)
+		if err != nil {
+			return nil, err
+		}
+		// Keys clashing with the actions remain reachable through get and set
+		if name := fmt.Sprint(key); !names[name] {
+			entries = append(entries, entry{name, keyValue})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	cmds := make([]cli.Command, 0, len(entries)+len(actions))
+	for _, e := range entries {
+		keyValue := e.keyValue
+		cmds = append(cmds, cli.Command{
+			Name:     e.key,
+			Category: "ITEMS",
+			Subcommands: []cli.Command{
+				{
+					Name:     "get-json",
+					Usage:    "Get the value as json",
+					Category: "ACTIONS",
+					Action: expectArgs(0, func(ctx *cli.Context) error {
+						return c.printer(ctx).printJSONIndent(v.MapIndex(keyValue))
+					}),
+				},
+				{
+					Name:      "set-json",
+					Usage:     "Set the value from json",
+					ArgsUsage: "[value|@file|-]",
+					Category:  "ACTIONS",
+					Action: expectArgs(1, func(ctx *cli.Context) error {
+						data, err := readInput(ctx.Args().First())
+						if err != nil {
+							return err
+						}
+						return setMapJSON(v, keyValue, data)
+					}),
+				},
+			},
+		})
+	}
+	return append(cmds, actions...), nil
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// readOnlyActions are the actions that only read the value, and so only take
+// the read lock. Everything else is assumed to mutate.
+var readOnlyActions = map[string]bool{
+	"get":           true,
+	"get-pointer":   true,
+	"dump":          true,
+	"show":          true,
+	"diff-json":     true,
+	"export-script": true,
+	"export":        true,
+	"list":          true,
+	"slice":         true,
+	"table":         true,
+	"count":         true,
+	"explain":       true,
+	"paths":         true,
+	"schema":        true,
+	"tree":          true,
+	"docs":          true,
+	"validate":      true,
+}
+
+func isReadOnlyAction(name string) bool {
+	return readOnlyActions[name] || strings.HasPrefix(name, "dump-")
+}
+
+// lockCommands wraps the actions of the commands and their subcommands, so
+// that they hold Config.Mutex while running.
+func (c *constructor) lockCommands(cmds []cli.Command) {
+	mut := c.cfg.Mutex
+	for i := range cmds {
+		c.lockCommands(cmds[i].Subcommands)
+
+		action := cmds[i].Action
+		if action == nil {
+			continue
+		}
+		if isReadOnlyAction(cmds[i].Name) {
+			cmds[i].Action = func(ctx *cli.Context) error {
+				mut.RLock()
+				defer mut.RUnlock()
+				return cli.HandleAction(action, ctx)
+			}
+		} else {
+			cmds[i].Action = func(ctx *cli.Context) error {
+				mut.Lock()
+				defer mut.Unlock()
+				return cli.HandleAction(action, ctx)
+			}
+		}
+	}
+}
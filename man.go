@@ -0,0 +1,134 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// manPage collects the sections of a man page while walking the command tree.
+type manPage struct {
+	name     string
+	commands bytes.Buffer
+	options  bytes.Buffer
+	examples []string
+	// exampled is the property of the examples.
+	exampled string
+	// get and set are the names of the actions used as examples.
+	get, set string
+}
+
+// GenerateManPage returns a troff man page in the given section, documenting
+// the commands Construct generates for the item. The page is named after the
+// type of the item, converted like the field names. Like the markdown
+// reference, items of slices and maps are documented once under a generic
+// <key>.
+func (c *constructor) GenerateManPage(item interface{}, section int) (string, error) {
+	tree, err := c.BuildCommandTree(item)
+	if err != nil {
+		return "", err
+	}
+
+	t := reflect.TypeOf(item).Elem()
+	page := &manPage{
+		name: c.cfg.FieldNameConverter(t.Name()),
+		get:  c.actionName("get"),
+		set:  c.actionName("set"),
+	}
+	page.walk(nil, tree.Children, nil)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, ".TH %s %d\n", strings.ToUpper(manEscape(page.name)), section)
+	fmt.Fprintf(&buf, ".SH NAME\n%s \\- manage %s through its properties\n", manEscape(page.name), manEscape(t.String()))
+	fmt.Fprintf(&buf, ".SH SYNOPSIS\n.B %s\n[\\fIproperty\\fR...] \\fIaction\\fR [\\fIoptions\\fR] [\\fIarguments\\fR]\n", manEscape(page.name))
+	fmt.Fprintf(&buf, ".SH DESCRIPTION\n.B %s\n"+
+		"has a command for every property, grouping the commands of any nested properties "+
+		"and the actions on the property, such as get and set. "+
+		"Items of collections are addressed by their keys, shown as <key> below.\n", manEscape(page.name))
+	buf.WriteString(".SH COMMANDS\n")
+	buf.Write(page.commands.Bytes())
+	if page.options.Len() > 0 {
+		buf.WriteString(".SH OPTIONS\n")
+		buf.Write(page.options.Bytes())
+	}
+	if len(page.examples) > 0 {
+		buf.WriteString(".SH EXAMPLES\n.PP\n.nf\n")
+		for _, example := range page.examples {
+			fmt.Fprintf(&buf, "%s\n", manEscape(example))
+		}
+		buf.WriteString(".fi\n")
+	}
+	return buf.String(), nil
+}
+
+// walk adds the commands and their options to the page, along with examples
+// of the first get and set actions found.
+func (m *manPage) walk(path []string, trees []*CommandTree, keys []string) {
+	items := false
+	for _, tree := range trees {
+		if tree.Hidden {
+			continue
+		}
+		name := tree.Name
+		treeKeys := keys
+		if tree.Category == "ITEMS" && len(tree.Children) > 0 {
+			if items {
+				continue
+			}
+			items = true
+			name = itemPlaceholder
+			treeKeys = append(append([]string(nil), keys...), strconv.Quote(tree.Name), strconv.Quote(itemPlaceholder))
+		}
+		treePath := appendPath(path, name)
+		replacer := strings.NewReplacer(treeKeys...)
+
+		synopsis := m.name + " " + strings.Join(treePath, " ")
+		if tree.ArgsUsage != "" {
+			synopsis += " " + tree.ArgsUsage
+		}
+		fmt.Fprintf(&m.commands, ".TP\n.B %s\n", manEscape(synopsis))
+		if tree.Usage != "" {
+			fmt.Fprintf(&m.commands, "%s\n", manEscape(replacer.Replace(tree.Usage)))
+		}
+
+		if len(tree.Flags) > 0 {
+			fmt.Fprintf(&m.options, ".SS %s\n", manEscape(strings.Join(treePath, " ")))
+			for _, flag := range tree.Flags {
+				fmt.Fprintf(&m.options, ".TP\n.B %s\n", manEscape(flagNames(flag)))
+				if usage := flagUsage(flag); usage != "" {
+					fmt.Fprintf(&m.options, "%s\n", manEscape(usage))
+				}
+			}
+		}
+
+		if tree.IsAction && len(path) > 0 {
+			property := strings.Join(path, " ")
+			switch {
+			case tree.Name == m.get && len(m.examples) == 0:
+				m.examples = append(m.examples, synopsis)
+				m.exampled = property
+			case tree.Name == m.set && len(m.examples) == 1 && m.exampled == property:
+				m.examples = append(m.examples, synopsis)
+			}
+		}
+
+		m.walk(treePath, tree.Children, treeKeys)
+	}
+}
+
+// manEscape escapes text for troff, so that it is printed as is.
+func manEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/urfave/cli"
+)
+
+var jsonUnmarshaler = reflect.TypeOf(new(json.Unmarshaler)).Elem()
+
+// mergePatch applies a json merge patch (RFC 7396) onto v: objects are merged
+// recursively, nulls reset fields to their zero values and remove map
+// entries, and everything else, including arrays, replaces the value.
+func (c *constructor) mergePatch(v reflect.Value, patch json.RawMessage) error {
+	patch = bytes.TrimSpace(patch)
+	if string(patch) == "null" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if len(patch) == 0 || patch[0] != '{' {
+		return unmarshalReplace(v, patch)
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return c.mergePatch(v.Elem(), patch)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	switch {
+	case v.Kind() == reflect.Struct && !isPrimitive(v) && !reflect.PtrTo(v.Type()).Implements(jsonUnmarshaler):
+		for _, name := range names {
+			i, ok := c.jsonField(v.Type(), name)
+			if !ok {
+				return fmt.Errorf("unknown field %q", name)
+			}
+			if err := c.mergePatch(v.Field(i), fields[name]); err != nil {
+				return errors.Wrap(err, name)
+			}
+		}
+		return nil
+
+	case v.Kind() == reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, name := range names {
+			key, err := stringToPrimitiveValue(name, v.Type().Key())
+			if err != nil {
+				return errors.Wrap(err, name)
+			}
+			if string(bytes.TrimSpace(fields[name])) == "null" {
+				v.SetMapIndex(key, reflect.Value{})
+				continue
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if existing := v.MapIndex(key); existing.IsValid() {
+				value.Set(existing)
+			}
+			if err := c.mergePatch(value, fields[name]); err != nil {
+				return errors.Wrap(err, name)
+			}
+			v.SetMapIndex(key, value)
+		}
+		return nil
+	}
+
+	return unmarshalReplace(v, patch)
+}
+
+// unmarshalReplace replaces v with the json value, rather than unmarshaling
+// on top of it.
+func unmarshalReplace(v reflect.Value, data []byte) error {
+	newValue := reflect.New(v.Type())
+	if err := json.Unmarshal(data, newValue.Interface()); err != nil {
+		return err
+	}
+	v.Set(newValue.Elem())
+	return nil
+}
+
+func (c *constructor) makeJsonMerger(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:      "merge-json",
+		Usage:     "Update only the properties present in the json merge patch, null resets a property",
+		ArgsUsage: "[value|@file|-]",
+		Category:  "ACTIONS",
+		Action: expectArgs(1, func(ctx *cli.Context) error {
+			data, err := readInput(ctx.Args().First())
+			if err != nil {
+				return err
+			}
+
+			// Patch a copy, so that a bad patch does not half apply, and
+			// copy the result back in place
+			newValue := deepCopy(v)
+			if err := c.mergePatch(newValue, data); err != nil {
+				return err
+			}
+			if err := validate(newValue); err != nil {
+				return err
+			}
+			copyInPlace(v, newValue, make(map[seenPointer]reflect.Value))
+			return nil
+		}),
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"reflect"
+
+	"github.com/urfave/cli"
+)
+
+// mutationCommands wraps the actions of the commands and their subcommands
+// which mutate the value, so that once they succeed the value is checked by
+// Config.Validate, and the change is reported to Config.OnMutation and
+// confirmed if Config.ConfirmMutations is set. Path is the path of the
+// commands, starting from root.
+func (c *constructor) mutationCommands(root reflect.Value, path []string, cmds []cli.Command) {
+	for i := range cmds {
+		if isLiveItemCommand(cmds[i]) {
+			// The item is only known once the command runs, so the command
+			// is recreated to report under the key of the item
+			target, err := c.resolvePath(root, path)
+			if err != nil {
+				continue
+			}
+			for _, item := range liveItems {
+				if item.name == cmds[i].Name {
+					cmds[i] = c.makeLiveItemCommand(item, deref(target.value), root, path)
+				}
+			}
+			continue
+		}
+
+		c.mutationCommands(root, appendPath(path, cmds[i].Name), cmds[i].Subcommands)
+
+		action := cmds[i].Action
+		if action == nil || isReadOnlyAction(cmds[i].Name) {
+			continue
+		}
+		cmds[i].Action = c.wrapMutation(root, path, cmds[i].Name, action)
+	}
+}
+
+func (c *constructor) wrapMutation(root reflect.Value, path []string, op string, action interface{}) func(*cli.Context) error {
+	return func(ctx *cli.Context) error {
+		changed := c.mutationPath(root, path, op, ctx)
+		hookPath := changed
+		if op == "set-pointer" {
+			// Json pointers don't use the command names, so the change is
+			// reported for the whole value
+			hookPath = nil
+		}
+
+		applied, err := c.mutate(root, hookPath, func() (bool, error) {
+			if err := cli.HandleAction(action, ctx); err != nil {
+				return false, err
+			}
+			return !ctx.Bool("dry-run"), nil
+		})
+		if err != nil || !applied {
+			return err
+		}
+		if c.cfg.ConfirmMutations {
+			return c.confirmMutation(ctx, root, op, changed)
+		}
+		return nil
+	}
+}
+
+// mutate calls apply, which returns whether it changed the value, and then
+// checks the value with Config.Validate and reports the change of the path to
+// Config.OnMutation, rolling the value back if either fails. The value is
+// rolled back in place, so pointers into it held elsewhere stay valid.
+func (c *constructor) mutate(root reflect.Value, path []string, apply func() (bool, error)) (bool, error) {
+	var scope, snapshot reflect.Value
+	if c.cfg.Validate != nil || c.cfg.OnMutation != nil {
+		scope = c.mutationScope(root, path)
+		snapshot = deepCopy(scope)
+	}
+	var oldValue interface{}
+	if c.cfg.OnMutation != nil {
+		oldValue = c.currentValue(root, path)
+	}
+
+	if applied, err := apply(); err != nil || !applied {
+		return false, err
+	}
+
+	if c.cfg.Validate != nil {
+		if err := c.cfg.Validate(root.Addr().Interface()); err != nil {
+			copyInPlace(scope, snapshot, make(map[seenPointer]reflect.Value))
+			return false, err
+		}
+	}
+	if c.cfg.OnMutation != nil {
+		if err := c.cfg.OnMutation(path, oldValue, c.currentValue(root, path)); err != nil {
+			copyInPlace(scope, snapshot, make(map[seenPointer]reflect.Value))
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// mutationScope returns the value a change to the path is contained in, which
+// is the value at the path, unless it is a slice item or within a map entry,
+// in which case it is the slice or the map holding it.
+func (c *constructor) mutationScope(root reflect.Value, path []string) reflect.Value {
+	for n := len(path); n > 0; n-- {
+		target, err := c.resolvePath(root, path[:n])
+		if err == nil && !target.missing && !target.element {
+			return target.value
+		}
+	}
+	return root
+}
+
+// currentValue returns a copy of the value at the path, dereferenced, or nil
+// if there is no such value.
+func (c *constructor) currentValue(root reflect.Value, path []string) interface{} {
+	target, err := c.resolvePath(root, path)
+	if err != nil || target.missing {
+		return nil
+	}
+	v := deref(target.value)
+	if !v.IsValid() {
+		return nil
+	}
+	return deepCopy(v).Interface()
+}
@@ -0,0 +1,274 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+)
+
+// OutputMode selects how generated commands format their output.
+type OutputMode int
+
+const (
+	// OutputHuman prints values as they are, and key value pairs through the
+	// KeyValuePrinter.
+	OutputHuman OutputMode = iota
+	// OutputJSON prints exactly one json value per line through the
+	// ValuePrinter: lists become arrays and key value pairs become objects.
+	OutputJSON
+)
+
+// printer prints the output of a single command invocation, in the output
+// mode selected for it.
+type printer struct {
+	*constructor
+	mode OutputMode
+	// color is set if human readable output gets colorized.
+	color bool
+}
+
+// printer returns the printer for the invocation, using the mode given by
+// the --output flag of the command or any of its parents if there is one.
+func (c *constructor) printer(ctx *cli.Context) printer {
+	p := printer{c, c.cfg.Output, false}
+	switch outputFlagValue(ctx) {
+	case "text":
+		p.mode = OutputHuman
+	case "json":
+		p.mode = OutputJSON
+	}
+	// Machine readable output is never colorized
+	p.color = p.mode == OutputHuman && c.useColor()
+	return p
+}
+
+type keyValuePair struct {
+	key   interface{}
+	value interface{}
+}
+
+// logError reports an error that does not stop the command through the
+// ErrorLogger, falling back to printing it to stderr.
+func (c *constructor) logError(err error) {
+	if c.cfg.ErrorLogger != nil {
+		c.cfg.ErrorLogger(err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "recli:", err)
+}
+
+// skipKeyError returns whether the slice item whose key could not be
+// produced should be skipped, logging the error if so.
+func (c *constructor) skipKeyError(err error) bool {
+	if !c.cfg.SkipInvalidKeys {
+		return false
+	}
+	c.logError(err)
+	return true
+}
+
+func (c *constructor) writer() io.Writer {
+	if c.cfg.Writer != nil {
+		return c.cfg.Writer
+	}
+	return os.Stdout
+}
+
+// writeValue prints a value through the ValueWriter or the ValuePrinter,
+// falling back to printing it on a line of its own.
+func (p printer) writeValue(value interface{}) error {
+	switch {
+	case p.cfg.ValueWriter != nil:
+		return p.cfg.ValueWriter(p.writer(), value)
+	case p.cfg.ValuePrinter != nil:
+		p.cfg.ValuePrinter(value)
+		return nil
+	}
+	_, err := fmt.Fprintln(p.writer(), value)
+	return err
+}
+
+// writeKeyValue prints a key value pair through the KeyValueWriter or the
+// KeyValuePrinter, falling back to printing it on a line of its own.
+func (p printer) writeKeyValue(key, value interface{}) error {
+	switch {
+	case p.cfg.KeyValueWriter != nil:
+		return p.cfg.KeyValueWriter(p.writer(), key, value)
+	case p.cfg.KeyValuePrinter != nil:
+		p.cfg.KeyValuePrinter(key, value)
+		return nil
+	}
+	_, err := fmt.Fprintln(p.writer(), key, " = ", value)
+	return err
+}
+
+// outputFlag selects the output mode of a single invocation, see
+// Config.OutputFlag.
+var outputFlag = cli.StringFlag{
+	Name:  "output",
+	Usage: "Output format, text or json",
+}
+
+// outputFlagValue returns the value of the nearest --output flag given to the
+// command or any of its parents.
+func outputFlagValue(ctx *cli.Context) string {
+	for ; ctx != nil; ctx = ctx.Parent() {
+		if ctx.IsSet(outputFlag.Name) {
+			return ctx.String(outputFlag.Name)
+		}
+	}
+	return ""
+}
+
+// addOutputFlag adds the --output flag to the commands and their
+// subcommands, rejecting unknown formats before running the actions.
+func addOutputFlag(cmds []cli.Command) {
+	for i := range cmds {
+		addOutputFlag(cmds[i].Subcommands)
+		if cmds[i].SkipFlagParsing {
+			// The flags are handled by whatever the arguments are given to
+			continue
+		}
+		cmds[i].Flags = append(cmds[i].Flags, outputFlag)
+		action := cmds[i].Action
+		if action == nil {
+			continue
+		}
+		cmds[i].Action = func(ctx *cli.Context) error {
+			switch format := outputFlagValue(ctx); format {
+			case "", "text", "json":
+			default:
+				return fmt.Errorf("unknown output format %q, expected text or json", format)
+			}
+			return cli.HandleAction(action, ctx)
+		}
+	}
+}
+
+// outputFileFlag makes the dump commands write to a file instead. It is named
+// --output, or --file if Config.OutputFlag takes that name.
+func outputFileFlag(cfg Config) cli.StringFlag {
+	name := "output"
+	if cfg.OutputFlag {
+		name = "file"
+	}
+	return cli.StringFlag{
+		Name:  name + ", o",
+		Usage: "Write the dump to the file, or to stdout if -",
+	}
+}
+
+// emitDump writes the data to the file given by --output and prints a
+// confirmation, or calls emit to print it as usual if no file was given.
+func (p printer) emitDump(ctx *cli.Context, data []byte, emit func() error) error {
+	path := ctx.String("o")
+	if path == "" {
+		return emit()
+	}
+
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+
+	if path == "-" {
+		_, err := p.writer().Write(data)
+		return err
+	}
+
+	if err := writeFile(path, data); err != nil {
+		return err
+	}
+	return p.emitText(fmt.Sprintf("wrote %d bytes to %s", len(data), path))
+}
+
+// emit prints a single value.
+func (p printer) emit(value interface{}) error {
+	if p.mode == OutputJSON {
+		return p.emitJSONValue(value)
+	}
+	if p.color && isMarker(value) {
+		return p.writeValue(colorize(colorMarker, fmt.Sprint(value)))
+	}
+	return p.writeValue(value)
+}
+
+// emitJSONValue prints a value json encoded, regardless of the output mode.
+func (p printer) emitJSONValue(value interface{}) error {
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return p.writeValue(string(bs))
+}
+
+// emitJSON prints an already encoded json document, compacting it to a single
+// line in json mode.
+func (p printer) emitJSON(data []byte) error {
+	if p.mode == OutputJSON {
+		if len(data) == 0 {
+			data = []byte("null")
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, data); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	} else if p.color {
+		return p.writeValue(highlightJSON(data))
+	}
+	return p.writeValue(string(data))
+}
+
+// emitText prints preformatted text, which is the same in every mode.
+func (p printer) emitText(s string) error {
+	return p.writeValue(s)
+}
+
+// emitList prints every item on its own, or a single array in json mode.
+func (p printer) emitList(items []interface{}) error {
+	if p.mode == OutputJSON {
+		if items == nil {
+			items = []interface{}{}
+		}
+		return p.emitJSONValue(items)
+	}
+	for _, item := range items {
+		if err := p.writeValue(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitKeyValues prints every pair through the KeyValuePrinter, or a single
+// object preserving the order of the pairs in json mode.
+func (p printer) emitKeyValues(kvs []keyValuePair) error {
+	if p.mode != OutputJSON {
+		for _, kv := range kvs {
+			key, value := kv.key, kv.value
+			if p.color {
+				key, value = colorize(colorKey, fmt.Sprint(key)), colorValue(value)
+			}
+			if err := p.writeKeyValue(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	bs, err := orderedObject(kvs).MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return p.writeValue(string(bs))
+}
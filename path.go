@@ -0,0 +1,322 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// pathTarget is a value resolved from a path.
+type pathTarget struct {
+	value reflect.Value
+	field *reflect.StructField
+	// commit stores the value back into any maps on the path, as map
+	// entries are not addressable and are resolved through copies.
+	commit func()
+	// missing is set if the path ends at a map key which does not exist.
+	missing bool
+	// element is set if the value is a slice item, which removals move, or
+	// a copy of a map entry or of a value within one.
+	element bool
+}
+
+// resolvePath resolves the path of command names, starting from v.
+func (c *constructor) resolvePath(v reflect.Value, path []string) (pathTarget, error) {
+	return c.resolvePathFrom(v, nil, path, 0, func() {})
+}
+
+func (c *constructor) resolvePathFrom(v reflect.Value, field *reflect.StructField, path []string, pos int, commit func()) (pathTarget, error) {
+	if pos == len(path) {
+		return pathTarget{value: v, field: field, commit: commit}, nil
+	}
+
+	// Pointers to primitives are leaves, and are allocated when set.
+	if v.Kind() == reflect.Ptr && isPrimitiveType(v.Type()) {
+		return pathTarget{}, c.pathError(path, pos, nil)
+	}
+
+	v = deref(v)
+	if !v.IsValid() {
+		return pathTarget{}, fmt.Errorf("%s: value is nil", strings.Join(path[:pos], "."))
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if isPrimitive(v) {
+			break
+		}
+		t := v.Type()
+		var valid []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if c.isSkipped(f) {
+				continue
+			}
+			name := c.fieldName(f)
+			if name == path[pos] {
+				return c.resolvePathFrom(v.Field(i), &f, path, pos+1, commit)
+			}
+			valid = append(valid, name)
+		}
+		return pathTarget{}, c.pathError(path, pos, valid)
+
+	case reflect.Slice, reflect.Array:
+		keyer := c.makeKeyer(v)
+		var valid []string
+		for i := 0; i < v.Len(); i++ {
+			key, err := keyer(i)
+			if err != nil {
+				if c.skipKeyError(err) {
+					continue
+				}
+				return pathTarget{}, err
+			}
+			// Keys might contain dots themselves
+			if n := matchSegments(path[pos:], key); n > 0 {
+				target, err := c.resolvePathFrom(v.Index(i), field, path, pos+n, commit)
+				target.element = target.element || pos+n == len(path)
+				return target, err
+			}
+			valid = append(valid, key)
+		}
+		return pathTarget{}, c.pathError(path, pos, valid)
+
+	case reflect.Map:
+		var valid []string
+		for _, keyValue := range v.MapKeys() {
+			key, err := GetPrimitiveValue(keyValue)
+			if err != nil {
+				return pathTarget{}, err
+			}
+			valid = append(valid, fmt.Sprint(key))
+		}
+
+		// Keys might contain dots themselves, so prefer the longest match
+		// with an existing key, and fall back to a single segment for new
+		// keys.
+		n := 1
+		for _, key := range valid {
+			if m := matchSegments(path[pos:], key); m > n {
+				n = m
+			}
+		}
+		keyValue, err := stringToPrimitiveValue(strings.Join(path[pos:pos+n], "."), v.Type().Key())
+		if err != nil {
+			return pathTarget{}, err
+		}
+
+		entry := reflect.New(v.Type().Elem()).Elem()
+		existing := v.MapIndex(keyValue)
+		if existing.IsValid() {
+			entry.Set(existing)
+		} else if pos+n < len(path) {
+			// Only allow new keys at the end of the path
+			return pathTarget{}, c.pathError(path, pos, valid)
+		}
+
+		target, err := c.resolvePathFrom(entry, field, path, pos+n, func() {
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(keyValue, entry)
+			commit()
+		})
+		target.missing = !existing.IsValid()
+		target.element = true
+		return target, err
+	}
+
+	return pathTarget{}, c.pathError(path, pos, nil)
+}
+
+// matchSegments returns the number of segments at the start of path which
+// joined with dots make up the key, or 0 if they don't.
+func matchSegments(path []string, key string) int {
+	for n := 1; n <= len(path); n++ {
+		if strings.Join(path[:n], ".") == key {
+			return n
+		}
+	}
+	return 0
+}
+
+func (c *constructor) pathError(path []string, pos int, valid []string) error {
+	prefix := strings.Join(path[:pos+1], ".")
+	if len(valid) == 0 {
+		return fmt.Errorf("%s: unknown path segment %q", prefix, path[pos])
+	}
+	return fmt.Errorf("%s: unknown path segment %q, expected one of: %s", prefix, path[pos], strings.Join(valid, ", "))
+}
+
+func (c *constructor) pathGet(p printer, v reflect.Value, path string, reveal bool) error {
+	target, err := c.resolvePath(v, strings.Split(path, "."))
+	if err != nil {
+		return err
+	}
+	if !isPrimitiveType(target.value.Type()) {
+		return fmt.Errorf("%s: not a primitive value", path)
+	}
+	if !reveal && target.field != nil && c.isSecret(*target.field) {
+		return errSecret
+	}
+	return p.printValue(target.value, false)
+}
+
+// pathSet sets the value addressed by the path, parsing the value as json if
+// it is not a primitive.
+func (c *constructor) pathSet(v reflect.Value, path, value string, dryRun bool) error {
+	target, err := c.resolvePath(v, strings.Split(path, "."))
+	if err != nil {
+		return err
+	}
+	if !isPrimitiveType(target.value.Type()) {
+		newValue := reflect.New(target.value.Type())
+		if err := json.Unmarshal([]byte(value), newValue.Interface()); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if !dryRun {
+			target.value.Set(newValue.Elem())
+			target.commit()
+		}
+		return nil
+	}
+	// Parse into a temporary, so that nil pointers are only allocated once
+	// the value is known to be valid
+	newValue, err := stringToPrimitiveValue(value, derefType(target.value.Type()))
+	if err != nil {
+		return err
+	}
+	if target.field != nil {
+		if err := c.validateField(*target.field, newValue); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	derefAndInit(target.value).Set(newValue)
+	target.commit()
+	return nil
+}
+
+// pathUnset removes the map entry addressed by the path.
+func (c *constructor) pathUnset(v reflect.Value, path string, dryRun bool) error {
+	segments := strings.Split(path, ".")
+	// Map keys might contain dots, so try the longest possible key first
+	var lastErr error
+	for i := 1; i < len(segments); i++ {
+		target, err := c.resolvePath(v, segments[:i])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		container := deref(target.value)
+		if container.Kind() != reflect.Map {
+			lastErr = fmt.Errorf("%s: not a map", strings.Join(segments[:i], "."))
+			continue
+		}
+		keyValue, err := stringToPrimitiveValue(strings.Join(segments[i:], "."), container.Type().Key())
+		if err != nil {
+			return err
+		}
+		if !dryRun {
+			container.SetMapIndex(keyValue, reflect.Value{})
+			target.commit()
+		}
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%s: not a map entry", path)
+	}
+	return lastErr
+}
+
+// pathAdd appends a value to the slice addressed by the path, parsing the
+// value as json if the items are not primitives.
+func (c *constructor) pathAdd(v reflect.Value, path, value string, dryRun bool) error {
+	target, err := c.resolvePath(v, strings.Split(path, "."))
+	if err != nil {
+		return err
+	}
+	container := deref(target.value)
+	if container.Kind() != reflect.Slice || isPrimitive(container) {
+		return fmt.Errorf("%s: not a slice", path)
+	}
+	var newValue reflect.Value
+	if isPrimitiveType(container.Type().Elem()) {
+		newValue, err = stringToPrimitiveValue(value, container.Type().Elem())
+	} else {
+		newValue = reflect.New(container.Type().Elem()).Elem()
+		err = json.Unmarshal([]byte(value), newValue.Addr().Interface())
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if dryRun {
+		return nil
+	}
+	container.Set(reflect.Append(container, newValue))
+	target.commit()
+	return nil
+}
+
+// pathClear removes all the items of the slice or map addressed by the path.
+func (c *constructor) pathClear(v reflect.Value, path string, dryRun bool) error {
+	target, err := c.resolvePath(v, strings.Split(path, "."))
+	if err != nil {
+		return err
+	}
+	container := deref(target.value)
+	if (container.Kind() != reflect.Slice && container.Kind() != reflect.Map) || isPrimitive(container) {
+		return fmt.Errorf("%s: not a slice or map", path)
+	}
+	if dryRun {
+		return nil
+	}
+	if container.Kind() == reflect.Slice {
+		container.Set(reflect.MakeSlice(container.Type(), 0, 0))
+	} else {
+		container.Set(reflect.MakeMap(container.Type()))
+	}
+	target.commit()
+	return nil
+}
+
+// withPathArgs dispatches to pathAction when called with n arguments, and to
+// action otherwise.
+func withPathArgs(n int, pathAction cli.ActionFunc, action interface{}) cli.ActionFunc {
+	return func(ctx *cli.Context) error {
+		if ctx.NArg() == n {
+			return pathAction(ctx)
+		}
+		return cli.HandleAction(action, ctx)
+	}
+}
+
+// addPathCommands extends the root get and set commands to also accept a
+// dotted path to a property.
+func (c *constructor) addPathCommands(v reflect.Value, actions []cli.Command) {
+	for i := range actions {
+		switch actions[i].Name {
+		case "get":
+			actions[i].ArgsUsage = "[path]"
+			actions[i].Action = withPathArgs(1, func(ctx *cli.Context) error {
+				return c.pathGet(c.printer(ctx), v, ctx.Args().First(), ctx.Bool("reveal"))
+			}, actions[i].Action)
+		case "set":
+			actions[i].ArgsUsage = "-attribute=value | [path] [value]"
+			actions[i].Action = withPathArgs(2, func(ctx *cli.Context) error {
+				return c.pathSet(v, ctx.Args().First(), ctx.Args().Get(1), false)
+			}, actions[i].Action)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// BindFlags binds the target using the default constructor, see
+// Constructor.BindFlags.
+func BindFlags(fs *pflag.FlagSet, target interface{}, prefix string) error {
+	return Default.BindFlags(fs, target, prefix)
+}
+
+// BindFlags registers a flag on the flag set for every primitive and slice of
+// primitives in the target, which has to be a pointer to a struct. The flags
+// are named by the dot separated path of the field, starting with the prefix
+// if it is not empty, and write the parsed values straight into the target.
+// Zero fields get their defaults first, so that the flags show them, and nil
+// pointers to structs get allocated. Fields of other kinds are skipped,
+// logging them through Config.ErrorLogger, or fail the binding with
+// Config.StrictBindFlags.
+func (c *constructor) BindFlags(fs *pflag.FlagSet, target interface{}, prefix string) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a non-nil pointer to a struct, got %T", target)
+	}
+	if _, err := applyDefaults(c.defaults(), target, nil, true); err != nil {
+		return err
+	}
+	var path []string
+	if prefix != "" {
+		path = []string{prefix}
+	}
+	return c.bindStructFlags(fs, path, v.Elem())
+}
+
+func (c *constructor) bindStructFlags(fs *pflag.FlagSet, path []string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if c.isSkipped(f) {
+			continue
+		}
+		fieldPath := appendPath(path, c.fieldName(f))
+		name := strings.Join(fieldPath, ".")
+		usage := f.Tag.Get(c.cfg.UsageTagName)
+		fv := v.Field(i)
+
+		switch ft := derefType(f.Type); {
+		case isPrimitiveType(f.Type):
+			flag := fs.VarPF(&fieldFlag{fv}, name, "", usage)
+			if ft.Kind() == reflect.Bool {
+				flag.NoOptDefVal = "true"
+			}
+
+		case ft.Kind() == reflect.Slice && isPrimitiveType(ft.Elem()):
+			fs.Var(&sliceFlag{v: fv}, name, usage)
+
+		case ft.Kind() == reflect.Struct:
+			if err := c.bindStructFlags(fs, fieldPath, derefAndInit(fv)); err != nil {
+				return errors.Wrap(err, f.Name)
+			}
+
+		default:
+			if c.cfg.StrictBindFlags {
+				return fmt.Errorf("%s: %s cannot be bound to a flag", name, ft.Kind())
+			}
+			c.logError(fmt.Errorf("skipping %s: %s cannot be bound to a flag", name, ft.Kind()))
+		}
+	}
+	return nil
+}
+
+// flagType returns the type name pflag would use for the kind.
+func flagType(t reflect.Type) string {
+	if k := derefType(t).Kind(); isPrimitiveKind(k) {
+		return k.String()
+	}
+	return "value"
+}
+
+// fieldFlag is a pflag.Value setting a primitive field.
+type fieldFlag struct {
+	v reflect.Value
+}
+
+func (f *fieldFlag) String() string {
+	value, err := leafValue(f.v)
+	if err != nil || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func (f *fieldFlag) Set(s string) error {
+	return SetPrimitiveValueFromString(derefAndInit(f.v), s)
+}
+
+func (f *fieldFlag) Type() string {
+	return flagType(f.v.Type())
+}
+
+// sliceFlag is a pflag.Value setting a slice of primitives, taking comma
+// separated items which replace the existing ones the first time it is set
+// and get appended afterwards, the way the slice flags of pflag work.
+type sliceFlag struct {
+	v       reflect.Value
+	changed bool
+}
+
+func (f *sliceFlag) String() string {
+	value, err := leafValue(f.v)
+	if err != nil || value == nil {
+		return "[]"
+	}
+	return "[" + fmt.Sprint(value) + "]"
+}
+
+func (f *sliceFlag) Set(s string) error {
+	items, err := csv.NewReader(strings.NewReader(s)).Read()
+	if err != nil {
+		return err
+	}
+	slice := derefAndInit(f.v)
+	if !f.changed {
+		slice.Set(reflect.MakeSlice(slice.Type(), 0, len(items)))
+		f.changed = true
+	}
+	for _, item := range items {
+		value, err := stringToPrimitiveValue(item, slice.Type().Elem())
+		if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, value))
+	}
+	return nil
+}
+
+func (f *sliceFlag) Type() string {
+	return flagType(derefType(f.v.Type()).Elem()) + "Slice"
+}
@@ -0,0 +1,21 @@
+module github.com/AudriusButkevicius/recli/playground
+
+go 1.17
+
+require (
+	github.com/AudriusButkevicius/recli v0.0.0-00010101000000-000000000000
+	github.com/go-playground/validator/v10 v10.4.1
+	github.com/urfave/cli v1.20.0
+)
+
+require (
+	github.com/go-playground/locales v0.13.0 // indirect
+	github.com/go-playground/universal-translator v0.17.0 // indirect
+	github.com/leodido/go-urn v1.2.0 // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+)
+
+replace github.com/AudriusButkevicius/recli => ../
@@ -0,0 +1,24 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package playground provides github.com/go-playground/validator as the
+// validator of Config.UseGoPlaygroundValidator when imported.
+//
+//	import _ "github.com/AudriusButkevicius/recli/playground"
+//
+// It is a module of its own, so that the validator dependency is opt in.
+package playground
+
+import (
+	"github.com/AudriusButkevicius/recli"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	recli.RegisterPlaygroundValidator(func() recli.StructValidator {
+		return validator.New()
+	})
+}
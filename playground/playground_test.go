@@ -0,0 +1,45 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package playground
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/AudriusButkevicius/recli"
+	"github.com/urfave/cli"
+)
+
+type Config struct {
+	Name string `validate:"required"`
+	Port int    `validate:"min=1,max=65535"`
+}
+
+func run(cfg recli.Config, item interface{}, args ...string) error {
+	cmds, err := recli.New(cfg).Construct(item)
+	if err != nil {
+		return err
+	}
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = ioutil.Discard
+	return app.Run(append([]string{"test"}, args...))
+}
+
+func TestPlaygroundValidator(t *testing.T) {
+	x := &Config{Name: "a", Port: 80}
+
+	cfg := recli.DefaultConfig
+	cfg.UseGoPlaygroundValidator = true
+	if err := run(cfg, x, "validate"); err != nil {
+		t.Error(err)
+	}
+	x.Port = 0
+	if err := run(cfg, x, "validate"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer %q: must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// jsonFieldName returns the name encoding/json uses for the field, and false
+// if the field is excluded from json.
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	return f.Name, true
+}
+
+// jsonField returns the index of the field with the given json name, falling
+// back to a case insensitive match like encoding/json does.
+func (c *constructor) jsonField(t reflect.Type, name string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if fieldName, ok := jsonFieldName(f); ok && !c.isSkipped(f) && fieldName == name {
+			return i, true
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if fieldName, ok := jsonFieldName(f); ok && !c.isSkipped(f) && strings.EqualFold(fieldName, name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// resolvePointer resolves the JSON Pointer tokens starting from v. Struct
+// fields are matched by their json names, slices by index and maps by key.
+// If appendable is set, the "-" token appends a new item to a slice.
+func (c *constructor) resolvePointer(v reflect.Value, tokens []string, appendable bool) (pathTarget, error) {
+	return c.resolvePointerFrom(v, nil, tokens, 0, appendable, func() {})
+}
+
+func (c *constructor) resolvePointerFrom(v reflect.Value, field *reflect.StructField, tokens []string, pos int, appendable bool, commit func()) (pathTarget, error) {
+	if pos == len(tokens) {
+		return pathTarget{value: v, field: field, commit: commit}, nil
+	}
+
+	token := tokens[pos]
+	fail := func(reason string) (pathTarget, error) {
+		return pathTarget{}, fmt.Errorf("json pointer token %d (%q): %s", pos, token, reason)
+	}
+
+	if v.Kind() == reflect.Ptr && isPrimitiveType(v.Type()) {
+		return fail("value is not a container")
+	}
+
+	v = deref(v)
+	if !v.IsValid() {
+		return fail("value is nil")
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if isPrimitive(v) {
+			break
+		}
+		if i, ok := c.jsonField(v.Type(), token); ok {
+			f := v.Type().Field(i)
+			return c.resolvePointerFrom(v.Field(i), &f, tokens, pos+1, appendable, commit)
+		}
+		return fail("no such field")
+
+	case reflect.Slice, reflect.Array:
+		if token == "-" {
+			if !appendable || v.Kind() != reflect.Slice {
+				return fail("cannot append here")
+			}
+			item := reflect.New(v.Type().Elem()).Elem()
+			return c.resolvePointerFrom(item, field, tokens, pos+1, appendable, func() {
+				v.Set(reflect.Append(v, item))
+				commit()
+			})
+		}
+		idx, err := strconv.Atoi(token)
+		if err != nil || idx < 0 || (len(token) > 1 && token[0] == '0') {
+			return fail("invalid array index")
+		}
+		if idx >= v.Len() {
+			return fail("array index out of range")
+		}
+		return c.resolvePointerFrom(v.Index(idx), field, tokens, pos+1, appendable, commit)
+
+	case reflect.Map:
+		keyValue, err := stringToPrimitiveValue(token, v.Type().Key())
+		if err != nil {
+			return fail(err.Error())
+		}
+		entry := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(keyValue); existing.IsValid() {
+			entry.Set(existing)
+		} else if !appendable || pos+1 < len(tokens) || !isPrimitiveType(v.Type().Elem()) {
+			return fail("no such key")
+		}
+		return c.resolvePointerFrom(entry, field, tokens, pos+1, appendable, func() {
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(keyValue, entry)
+			commit()
+		})
+	}
+
+	return fail("value is not a container")
+}
+
+func (c *constructor) pointerGet(p printer, v reflect.Value, pointer string, reveal bool) error {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+	target, err := c.resolvePointer(v, tokens, false)
+	if err != nil {
+		return err
+	}
+	if !isPrimitiveType(target.value.Type()) {
+		return fmt.Errorf("%s: not a primitive value", pointer)
+	}
+	if !reveal && target.field != nil && c.isSecret(*target.field) {
+		return errSecret
+	}
+	return p.printValue(target.value, false)
+}
+
+func (c *constructor) pointerSet(v reflect.Value, pointer, value string) error {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+	target, err := c.resolvePointer(v, tokens, true)
+	if err != nil {
+		return err
+	}
+	if !isPrimitiveType(target.value.Type()) {
+		return fmt.Errorf("%s: not a primitive value", pointer)
+	}
+	newValue, err := stringToPrimitiveValue(value, derefType(target.value.Type()))
+	if err != nil {
+		return err
+	}
+	if target.field != nil {
+		if err := c.validateField(*target.field, newValue); err != nil {
+			return fmt.Errorf("%s: %v", pointer, err)
+		}
+	}
+	derefAndInit(target.value).Set(newValue)
+	target.commit()
+	return nil
+}
+
+func (c *constructor) makePointerCommands(v reflect.Value) []cli.Command {
+	return []cli.Command{
+		{
+			Name:      "get-pointer",
+			Usage:     "Get the value addressed by a json pointer",
+			ArgsUsage: "[pointer]",
+			Category:  "ACTIONS",
+			Flags:     c.revealFlags(v.Type()),
+			Action: expectArgs(1, func(ctx *cli.Context) error {
+				return c.pointerGet(c.printer(ctx), v, ctx.Args().First(), ctx.Bool("reveal"))
+			}),
+		},
+		{
+			Name:      "set-pointer",
+			Usage:     "Set the value addressed by a json pointer",
+			ArgsUsage: "[pointer] [value]",
+			Category:  "ACTIONS",
+			Action: expectArgs(2, func(ctx *cli.Context) error {
+				return c.pointerSet(v, ctx.Args().First(), ctx.Args().Get(1))
+			}),
+		},
+	}
+}
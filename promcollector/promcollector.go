@@ -0,0 +1,159 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package promcollector exposes the properties of an item as Prometheus
+// gauges.
+//
+// It is a module of its own, so that the Prometheus dependency is opt in.
+package promcollector
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/AudriusButkevicius/recli"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// itemPlaceholder is the path segment of slice items and map entries in
+// recli.FieldSchema.Path.
+const itemPlaceholder = "<key>"
+
+// collector collects the properties of the item as gauges whenever scraped.
+type collector struct {
+	cfg    recli.Config
+	c      recli.Constructor
+	item   interface{}
+	fields []field
+}
+
+// field is a property of the item that is collected.
+type field struct {
+	path []string
+	help string
+}
+
+// New returns a collector for the item using the default config, see
+// NewWith.
+func New(item interface{}) (prometheus.Collector, error) {
+	return NewWith(recli.DefaultConfig, item)
+}
+
+// NewWith returns a collector exposing the numeric and bool properties of
+// the item as gauges, named after their path of command names in snake
+// case, such as backends_port. Bools are 0 or 1, and strings, along with
+// other values printed as strings, are a gauge of 1 with the string as the
+// value label. Slice items and map entries are told apart by a label named
+// after the collection, holding their key. Secrets, nil pointers, interface
+// values and slices of primitives are left out. The values are read under
+// Config.Mutex at every scrape, and as the metrics depend on the contents of
+// the item, the collector is unchecked. The item has to be a pointer to a
+// struct.
+func NewWith(cfg recli.Config, item interface{}) (prometheus.Collector, error) {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a non-nil pointer to a struct, got %T", item)
+	}
+	c := recli.New(cfg)
+	schema, err := c.Schema(item)
+	if err != nil {
+		return nil, err
+	}
+	p := &collector{cfg: cfg, c: c, item: item}
+	for _, s := range schema {
+		if s.Secret || s.Kind == reflect.Interface.String() || s.Kind == reflect.Slice.String() || s.Kind == reflect.Array.String() {
+			continue
+		}
+		p.fields = append(p.fields, field{strings.Split(s.Path, "."), s.Usage})
+	}
+	return p, nil
+}
+
+// Describe sends no descriptors, making the collector unchecked.
+func (p *collector) Describe(chan<- *prometheus.Desc) {}
+
+func (p *collector) Collect(ch chan<- prometheus.Metric) {
+	if mut := p.cfg.Mutex; mut != nil {
+		mut.RLock()
+		defer mut.RUnlock()
+	}
+	err := p.c.Walk(p.item, func(path []string, v reflect.Value) error {
+		for _, f := range p.fields {
+			if name, labelNames, labelValues, ok := f.match(path); ok {
+				collect(ch, name, f.help, labelNames, labelValues, v)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(prometheus.NewDesc("recli_error", "Error walking the item", nil, nil), err)
+	}
+}
+
+// match returns the name and labels of the metric for the path, if it is a
+// path of the field.
+func (f field) match(path []string) (string, []string, []string, bool) {
+	if len(path) != len(f.path) {
+		return "", nil, nil, false
+	}
+	var name, labelNames, labelValues []string
+	for i, segment := range f.path {
+		if segment != itemPlaceholder {
+			if segment != path[i] {
+				return "", nil, nil, false
+			}
+			name = append(name, strings.ReplaceAll(segment, "-", "_"))
+			continue
+		}
+		labelNames = append(labelNames, name[len(name)-1])
+		labelValues = append(labelValues, path[i])
+	}
+	return strings.Join(name, "_"), labelNames, labelValues, true
+}
+
+func collect(ch chan<- prometheus.Metric, name, help string, labelNames, labelValues []string, v reflect.Value) {
+	if help == "" {
+		help = "Value of " + name
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	value, err := recli.GetPrimitiveValue(v)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(prometheus.NewDesc(name, help, nil, nil), err)
+		return
+	}
+	var gauge float64
+	switch pv := reflect.ValueOf(value); pv.Kind() {
+	case reflect.Bool:
+		if pv.Bool() {
+			gauge = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		gauge = float64(pv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		gauge = float64(pv.Uint())
+	case reflect.Float32, reflect.Float64:
+		gauge = pv.Float()
+	default:
+		labelNames = append(labelNames[:len(labelNames):len(labelNames)], "value")
+		labelValues = append(labelValues[:len(labelValues):len(labelValues)], fmt.Sprint(value))
+		gauge = 1
+	}
+
+	desc := prometheus.NewDesc(name, help, labelNames, nil)
+	metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, gauge, labelValues...)
+	if err != nil {
+		metric = prometheus.NewInvalidMetric(desc, err)
+	}
+	ch <- metric
+}
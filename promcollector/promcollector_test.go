@@ -0,0 +1,106 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package promcollector
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Backend struct {
+	Name   string `recli:"id"`
+	Port   uint16 `usage:"Port to connect to"`
+	Weight float32
+}
+
+type Config struct {
+	Name     string
+	Key      string `recli:"secret"`
+	Enabled  bool
+	MaxConns int
+	Tags     []string
+	Limits   map[string]int
+	Backends []Backend
+	Parent   *Config
+}
+
+func TestNew(t *testing.T) {
+	x := &Config{
+		Name:     "a",
+		Key:      "hunter2",
+		Enabled:  true,
+		MaxConns: 10,
+		Tags:     []string{"x"},
+		Limits:   map[string]int{"cpu": 2},
+		Backends: []Backend{{Name: "b", Port: 80, Weight: 0.5}},
+	}
+	x.Parent = x
+
+	collector, err := New(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(collector); err != nil {
+		t.Fatal(err)
+	}
+
+	gather := func() []string {
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				var labels []string
+				for _, label := range metric.GetLabel() {
+					labels = append(labels, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+				}
+				lines = append(lines, fmt.Sprintf("%s{%s} %v", family.GetName(), strings.Join(labels, ","), metric.GetGauge().GetValue()))
+			}
+		}
+		sort.Strings(lines)
+		return lines
+	}
+
+	expected := []string{
+		`backends_name{backends="b",value="b"} 1`,
+		`backends_port{backends="b"} 80`,
+		`backends_weight{backends="b"} 0.5`,
+		`enabled{} 1`,
+		`limits{limits="cpu"} 2`,
+		`max_conns{} 10`,
+		`name{value="a"} 1`,
+	}
+	if lines := gather(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("unexpected metrics:\n%s", strings.Join(lines, "\n"))
+	}
+
+	// The values are read at every scrape
+	x.Enabled = false
+	x.Backends = append(x.Backends, Backend{Name: "c", Port: 81})
+	lines := gather()
+	for _, line := range []string{`enabled{} 0`, `backends_port{backends="c"} 81`} {
+		found := false
+		for _, l := range lines {
+			found = found || l == line
+		}
+		if !found {
+			t.Errorf("%s missing from:\n%s", line, strings.Join(lines, "\n"))
+		}
+	}
+
+	if _, err := New(Config{}); err == nil {
+		t.Error("expected an error for a non-pointer")
+	}
+}
@@ -11,9 +11,17 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
 
 	"github.com/urfave/cli"
 )
@@ -31,10 +39,179 @@ type Config struct {
 	SkipTag            Tag
 	IDTag              Tag
 	UsageTagName       string
+	NameTagName        string
 	DefaultTagName     string
+	EnumTagName        string
+	MinTagName         string
+	MaxTagName         string
 	FieldNameConverter FieldNameConverter
 	ValuePrinter       ValuePrinter
 	KeyValuePrinter    KeyValuePrinter
+	SkipTypes          []reflect.Type
+	// UseJSONTagNames names the commands of fields after their json tag
+	// names, passed through FieldNameConverter, unless they have a
+	// NameTagName tag, and skips the fields excluded from json.
+	UseJSONTagNames bool
+	// SecretTag marks fields whose values are redacted from dumps, and only
+	// printed by get when --reveal is passed.
+	SecretTag Tag
+	// HiddenTag marks fields whose commands, and flags of the set and add
+	// commands, are hidden from the help, while still working as usual.
+	HiddenTag Tag
+	// DeprecatedTag marks fields, optionally followed by = and a note such
+	// as recli:"deprecated=use foo instead", whose commands keep working,
+	// but print a warning through WarningPrinter, and have the note added
+	// to their usage.
+	DeprecatedTag Tag
+	// WarningPrinter receives warnings, such as about deprecated
+	// properties being used. Defaults to printing to the ErrWriter of the
+	// app, or stderr.
+	WarningPrinter func(msg string)
+	// EnvTagName names the tag holding the name of an environment variable,
+	// such as env:"MYAPP_ADDRESS", which takes precedence over the default
+	// tag of the field wherever defaults are applied, when set. The value
+	// is parsed the same way as the default tag.
+	EnvTagName string
+	// EmptyEnvIsSet makes empty environment variables named by EnvTagName
+	// count as set, rather than falling back to the default tag.
+	EmptyEnvIsSet bool
+	// OnNameCollision, if set, returns a new command name for a field whose
+	// name collides with an action at the same level. Otherwise the field
+	// takes the name, and the action is left out at that level.
+	OnNameCollision func(fieldName, collidingName string) string
+	// StrictCommandNames makes fields whose names collide with actions at
+	// the same level fail Construct, rather than taking over the name.
+	StrictCommandNames bool
+	// TreeCommand adds a root level tree command printing the generated
+	// command hierarchy.
+	TreeCommand bool
+	// DocsCommand adds a hidden root level docs command printing the
+	// markdown reference produced by GenerateMarkdown.
+	DocsCommand bool
+	// ShowCommand adds a show command at every struct level, listing the
+	// leaf properties under it with their values.
+	ShowCommand bool
+	// ZeroCommand adds a zero command at every struct level, resetting the
+	// properties under it to their zero values.
+	ZeroCommand bool
+	// StructSetCommand adds a set command at every struct level, taking a
+	// flag for each of the properties under it.
+	StructSetCommand bool
+	// DumpEnvCommand adds a dump-env command at every struct level, printing
+	// the properties under it as shell variable assignments.
+	DumpEnvCommand bool
+	// PathsCommand adds a root level paths command listing the dot separated
+	// paths to every property.
+	PathsCommand bool
+	// SchemaCommand adds a root level schema command printing the json
+	// encoded result of Constructor.Schema.
+	SchemaCommand bool
+	// ExportScriptCommand adds a root level export-script command printing
+	// the path operations, as taken by the apply command of PathCommands,
+	// recreating the value from its defaults.
+	ExportScriptCommand bool
+	// FileCommands adds export and import commands at every struct, slice
+	// and map level, writing and reading the value as a file in the format
+	// chosen by its extension.
+	FileCommands bool
+	// PathCommands makes the root get and set commands also accept a dot
+	// separated path to a property, for example "backends.0.port", and adds
+	// get-pointer and set-pointer commands taking a json pointer instead,
+	// along with an apply command running a script of path operations.
+	PathCommands bool
+	// Output selects between human readable and json output.
+	Output OutputMode
+	// Color selects whether human readable output is colorized, which is
+	// never the case by default.
+	Color ColorMode
+	// OutputFlag adds an --output flag taking text or json to every command,
+	// overriding Output for the invocation. It applies to the subcommands
+	// too, so it can be given at any level of the hierarchy, and is also
+	// honoured if an application level flag of the same name is defined.
+	// The dump commands then take --file rather than --output for the file
+	// to write to.
+	OutputFlag bool
+	// ValueWriter and KeyValueWriter, if set, are used instead of the
+	// ValuePrinter and KeyValuePrinter, writing to Writer and allowing
+	// failures to be returned from the commands.
+	ValueWriter    func(w io.Writer, value interface{}) error
+	KeyValueWriter func(w io.Writer, key, value interface{}) error
+	// Mutex, if set, is read locked while constructing the commands and
+	// while running actions that only read the value, and write locked while
+	// running all other actions. This makes it safe to run commands from
+	// multiple goroutines, as long as everything else accessing the value
+	// holds the same lock. Without it, neither Construct nor the commands
+	// are safe for concurrent use on the same value.
+	Mutex *sync.RWMutex
+	// SliceKeyFormat is the fmt format of the keys of slice items without an
+	// ID, given the index shifted by SliceKeyBase. For example "%03d" with a
+	// base of 1 produces 001, 002 and so on.
+	SliceKeyFormat string
+	SliceKeyBase   int
+	// SkipInvalidKeys skips slice items whose key cannot be produced, for
+	// example due to a broken ID field, instead of failing.
+	SkipInvalidKeys bool
+	// ErrorLogger receives errors that do not fail the command, such as the
+	// skipped items. Defaults to printing to stderr.
+	ErrorLogger func(error)
+	// StrictBindFlags makes BindFlags fail on fields that cannot be bound to
+	// a flag, such as maps, rather than logging and skipping them.
+	StrictBindFlags bool
+	// Writer is where all output goes to, defaulting to os.Stdout. Printers
+	// left nil print one value or key value pair per line to it.
+	Writer io.Writer
+	// ConfirmMutations makes every action changing the value print a line
+	// confirming the change once it succeeds, for example
+	// "set gui.theme = dark".
+	ConfirmMutations bool
+	// MutationMessage, if set, formats the confirmations, given the action,
+	// the dot separated path of the changed value, and the new value if it
+	// is a primitive or nil otherwise.
+	MutationMessage func(op, path string, value interface{}) string
+	// OnMutation, if set, is called by every action changing the value once
+	// it succeeds, with the path of command names to the changed value and
+	// copies of the value before and after, which are nil if it did not
+	// exist. Actions changing many values, such as load-json, report the
+	// value they were run on. An error fails the action and rolls the whole
+	// value back to where it was before the action.
+	OnMutation func(path []string, oldValue, newValue interface{}) error
+	// Validate, if set, is called with a pointer to the whole value after
+	// every action changing it, before OnMutation, to check invariants
+	// spanning many fields. An error fails the action and rolls the value
+	// back to where it was before the action.
+	Validate func(root interface{}) error
+	// StructValidator, if set, adds a root validate command checking the
+	// whole value with it, along with Validator.
+	StructValidator StructValidator
+	// UseGoPlaygroundValidator uses github.com/go-playground/validator as
+	// the StructValidator, if none is set. The dependency lives in the
+	// github.com/AudriusButkevicius/recli/playground module, which has to
+	// be imported, and Construct fails without it.
+	UseGoPlaygroundValidator bool
+	// CommandPrefix is prepended to the names of all top level commands, so
+	// that commands constructed for different items can be used side by
+	// side, for example "device-" gives device-name and device-dump-json.
+	CommandPrefix string
+	// CommandDecorator, if set, is called for every command once it is
+	// fully constructed, subcommands first, to adjust it as needed, for
+	// example by adding flags or Before and After hooks. The commands of the
+	// first and last items are only constructed, and decorated, when run.
+	CommandDecorator func(cmd *cli.Command)
+	// ActionNames renames the generated actions everywhere, keyed by their
+	// default names, for example {"get": "show", "show": "view"}. Renamed
+	// actions colliding with fields or other commands fail Construct.
+	ActionNames map[string]string
+	// OnUnsupportedKind, if set, is called for values of kinds recli has no
+	// commands for, such as channels and functions, instead of failing.
+	// The commands returned are used for the value, and fields for which it
+	// returns neither commands nor an error are left out.
+	OnUnsupportedKind func(k reflect.Kind) ([]cli.Command, error)
+	// FlatSeparator joins the names of the commands ConstructFlat returns,
+	// defaulting to a dot.
+	FlatSeparator string
+	// ExtraDumpFormats adds a dump-<format> command for each entry at the
+	// struct, slice and map levels, for example {"yaml": yaml.Marshal}.
+	ExtraDumpFormats map[string]func(interface{}) ([]byte, error)
 }
 
 var (
@@ -47,14 +224,33 @@ var (
 			Name:  "recli",
 			Value: "id",
 		},
+		SecretTag: Tag{
+			Name:  "recli",
+			Value: "secret",
+		},
+		HiddenTag: Tag{
+			Name:  "recli",
+			Value: "hidden",
+		},
+		DeprecatedTag: Tag{
+			Name:  "recli",
+			Value: "deprecated",
+		},
+		SliceKeyFormat:     "%d",
 		UsageTagName:       "usage",
+		NameTagName:        "cli",
 		DefaultTagName:     "default",
-		FieldNameConverter: toLowerDashCase,
-		ValuePrinter: func(value interface{}) {
-			fmt.Println(value)
-		},
-		KeyValuePrinter: func(key interface{}, value interface{}) {
-			fmt.Println(key, " = ", value)
+		EnvTagName:         "env",
+		EnumTagName:        "enum",
+		MinTagName:         "min",
+		MaxTagName:         "max",
+		FieldNameConverter: ToLowerDashCase,
+		SkipTypes: []reflect.Type{
+			reflect.TypeOf(sync.Mutex{}),
+			reflect.TypeOf(sync.RWMutex{}),
+			reflect.TypeOf(sync.WaitGroup{}),
+			reflect.TypeOf(sync.Cond{}),
+			reflect.TypeOf(atomic.Value{}),
 		},
 	}
 	Default = New(DefaultConfig)
@@ -66,69 +262,341 @@ func New(config Config) Constructor {
 	}
 }
 
+// ConditionError is returned by conditional set commands when the condition
+// is not met and the value has been left untouched.
+type ConditionError struct {
+	Condition string
+	Current   interface{}
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf("condition %s not met, current value: %v", e.Condition, e.Current)
+}
+
 type Constructor interface {
 	Construct(item interface{}) ([]cli.Command, error)
+	Schema(item interface{}) ([]FieldSchema, error)
+	BuildCommandTree(item interface{}) (*CommandTree, error)
+	GenerateMarkdown(item interface{}) (string, error)
+	GenerateManPage(item interface{}, section int) (string, error)
+	ConstructApp(name, usage string, item interface{}) (*cli.App, error)
+	BindFlags(fs *pflag.FlagSet, target interface{}, prefix string) error
+	Walk(item interface{}, fn func(path []string, v reflect.Value) error) error
+	WalkType(item interface{}, fn func(path []string, t reflect.Type, field *reflect.StructField) error) error
+	Flatten(item interface{}) (map[string]interface{}, error)
+	Unflatten(values map[string]interface{}, target interface{}) error
+	ConstructFlat(item interface{}) ([]cli.Command, error)
+	ConstructHTTP(item interface{}, mux *http.ServeMux) error
 }
 
 type constructor struct {
 	cfg Config
 }
 
-func (c *constructor) printValue(v reflect.Value) error {
-	val, err := getPrimitiveValue(v)
+func (p printer) printValue(v reflect.Value, asJson bool) error {
+	v = deref(v)
+	if !v.IsValid() {
+		// A nil pointer that has not been set yet
+		return p.printInterface(nil, asJson)
+	}
+	val, err := GetPrimitiveValue(v)
 	if err != nil {
 		return err
 	}
-	c.cfg.ValuePrinter(val)
-	return nil
+	return p.printInterface(val, asJson)
+}
+
+func (p printer) printInterface(val interface{}, asJson bool) error {
+	if asJson {
+		return p.emitJSONValue(val)
+	}
+	return p.emit(val)
+}
+
+// defaults returns where the defaults of fields are taken from.
+func (c *constructor) defaults() defaultSource {
+	return defaultSource{c.cfg.DefaultTagName, c.cfg.EnvTagName, c.cfg.EmptyEnvIsSet}
 }
 
-func (c *constructor) makePrimitiveCommands(v reflect.Value) []cli.Command {
+// defaultValue returns the default value declared on the field, parsed as the
+// given type and formatted the same way as the value itself would be.
+func (c *constructor) defaultValue(field *reflect.StructField, t reflect.Type) (interface{}, bool, error) {
+	if field == nil {
+		return nil, false, nil
+	}
+	tag, env, ok := c.defaults().lookup(*field)
+	if !ok {
+		return nil, false, nil
+	}
+
+	v := reflect.New(derefType(t)).Elem()
+	var err error
+	if i, ok := v.Addr().Interface().(ParseDefaulter); ok {
+		err = i.ParseDefault(tag)
+	} else {
+		err = SetPrimitiveValueFromString(v, tag)
+	}
+	if err != nil && env != "" {
+		return nil, true, errors.Wrapf(err, "environment variable %s", env)
+	} else if err != nil {
+		return nil, true, err
+	}
+
+	val, err := GetPrimitiveValue(v)
+	return val, true, err
+}
+
+func (c *constructor) makePrimitiveCommands(v reflect.Value, field *reflect.StructField) []cli.Command {
+	secret := field != nil && c.isSecret(*field)
+	getFlags := []cli.Flag{
+		cli.BoolFlag{
+			Name:  "default",
+			Usage: "Get the default value instead",
+		},
+		cli.BoolFlag{
+			Name:  "both",
+			Usage: "Get both the current and the default value",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the value as json",
+		},
+	}
+	if secret {
+		getFlags = append(getFlags, cli.BoolFlag{
+			Name:  "reveal",
+			Usage: "Required to print the secret value",
+		})
+	}
+
 	cmds := []cli.Command{
 		{
 			Name:     "get",
 			Usage:    "Get the value",
 			Category: "ACTIONS",
+			Flags:    getFlags,
 			Action: expectArgs(0, func(ctx *cli.Context) error {
-				return c.printValue(v)
+				if secret && !ctx.Bool("reveal") && !ctx.Bool("default") {
+					return errSecret
+				}
+				p := c.printer(ctx)
+				if !ctx.Bool("default") && !ctx.Bool("both") {
+					return p.printValue(v, ctx.Bool("json"))
+				}
+
+				def, ok, err := c.defaultValue(field, v.Type())
+				if err != nil {
+					return err
+				}
+				if !ok {
+					def = "<no default>"
+				}
+
+				if !ctx.Bool("both") {
+					return p.printInterface(def, ctx.Bool("json"))
+				}
+
+				var current interface{}
+				if dv := deref(v); dv.IsValid() {
+					if current, err = GetPrimitiveValue(dv); err != nil {
+						return err
+					}
+				}
+				return p.emitKeyValues([]keyValuePair{
+					{"current", current},
+					{"default", def},
+				})
 			}),
 		},
 	}
 
-	if v.CanSet() {
+	cmds = append(cmds, c.makeExplainCommand(v, field))
+
+	if v.CanSet() || deref(v).CanSet() {
 		cmds = append(cmds, cli.Command{
 			Name:      "set",
 			ArgsUsage: "[value]",
 			Usage:     "Set the value",
 			Category:  "ACTIONS",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "if-unset",
+					Usage: "Only set the value if it is the zero or the default value",
+				},
+				cli.StringFlag{
+					Name:  "if-equals",
+					Usage: "Only set the value if it currently equals the given value",
+				},
+			},
 			Action: expectArgs(1, func(ctx *cli.Context) error {
-				return setPrimitiveValueFromString(v, ctx.Args().First())
+				if err := c.checkSetConditions(ctx, v, field); err != nil {
+					return err
+				}
+				// Parse into a temporary, so that nil pointers are only
+				// allocated once the value is known to be valid
+				newValue, err := stringToPrimitiveValue(ctx.Args().First(), derefType(v.Type()))
+				if err != nil {
+					return err
+				}
+				if field != nil {
+					if err := c.validateField(*field, newValue); err != nil {
+						return err
+					}
+				}
+				derefAndInit(v).Set(newValue)
+				return nil
 			}),
 		})
 	}
 	return cmds
 }
 
+func (c *constructor) makeExplainCommand(v reflect.Value, field *reflect.StructField) cli.Command {
+	return cli.Command{
+		Name:     "explain",
+		Usage:    "Describe the value",
+		Category: "ACTIONS",
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			var kvs []keyValuePair
+			if field != nil {
+				kvs = append(kvs, keyValuePair{"usage", field.Tag.Get(c.cfg.UsageTagName)})
+			}
+
+			def, ok, err := c.defaultValue(field, v.Type())
+			if err != nil {
+				return err
+			}
+			if !ok {
+				def = "<no default>"
+			}
+			kvs = append(kvs, keyValuePair{"default", def})
+
+			var current interface{}
+			if field != nil && c.isSecret(*field) {
+				current = redactedValue
+			} else if dv := deref(v); dv.IsValid() {
+				if current, err = GetPrimitiveValue(dv); err != nil {
+					return err
+				}
+			}
+			kvs = append(kvs, keyValuePair{"current", current}, keyValuePair{"type", v.Type().String()})
+
+			if field != nil {
+				if enum, ok := field.Tag.Lookup(c.cfg.EnumTagName); ok {
+					kvs = append(kvs, keyValuePair{"allowed", strings.Join(strings.Split(enum, ","), ", ")})
+				}
+			}
+			return c.printer(ctx).emitKeyValues(kvs)
+		}),
+	}
+}
+
+func (c *constructor) checkSetConditions(ctx *cli.Context, v reflect.Value, field *reflect.StructField) error {
+	current := deref(v)
+	var currentValue interface{}
+	if current.IsValid() {
+		var err error
+		if currentValue, err = GetPrimitiveValue(current); err != nil {
+			return err
+		}
+	}
+
+	if ctx.Bool("if-unset") {
+		isUnset := !current.IsValid() || current.IsZero()
+		if !isUnset {
+			def, ok, err := c.defaultValue(field, v.Type())
+			if err != nil {
+				return err
+			}
+			isUnset = ok && reflect.DeepEqual(def, currentValue)
+		}
+		if !isUnset {
+			if field != nil && c.isSecret(*field) {
+				currentValue = redactedValue
+			}
+			return &ConditionError{Condition: "if-unset", Current: currentValue}
+		}
+	}
+
+	if ctx.IsSet("if-equals") {
+		// Compare parsed values, so that different spellings of the same
+		// value are equal
+		expected, err := stringToPrimitiveValue(ctx.String("if-equals"), derefType(v.Type()))
+		if err != nil {
+			return err
+		}
+		expectedValue, err := GetPrimitiveValue(expected)
+		if err != nil {
+			return err
+		}
+		if !current.IsValid() || !reflect.DeepEqual(expectedValue, currentValue) {
+			if field != nil && c.isSecret(*field) {
+				currentValue = redactedValue
+			}
+			return &ConditionError{Condition: "if-equals", Current: currentValue}
+		}
+	}
+
+	return nil
+}
+
+func (c *constructor) makeCountCommand(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:     "count",
+		Aliases:  []string{"length"},
+		Usage:    "Print the number of items",
+		Category: "ACTIONS",
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			return c.printer(ctx).emit(v.Len())
+		}),
+	}
+}
+
+// mapDumpable returns the map in a form suitable for marshaling.
+func mapDumpable(v reflect.Value) (interface{}, error) {
+	if v.Type().Key().Kind() == reflect.String {
+		return v.Interface(), nil
+	}
+
+	// Key the object by the formatted keys
+	m := make(map[string]interface{}, v.Len())
+	for _, keyValue := range v.MapKeys() {
+		key, err := GetPrimitiveValue(keyValue)
+		if err != nil {
+			return nil, err
+		}
+		// Copy to an addressable value, so that pointer receiver
+		// marshalers get used
+		value := reflect.New(v.Type().Elem())
+		value.Elem().Set(v.MapIndex(keyValue))
+		m[fmt.Sprint(key)] = value.Interface()
+	}
+	return m, nil
+}
+
 func (c *constructor) makeMapCommands(v reflect.Value) []cli.Command {
-	return []cli.Command{
+	cmds := []cli.Command{
+		c.makeCountCommand(v),
+		c.makeJsonDumper(v, "Dump all keys and their values as a json object", mapDumpable),
 		{
 			Name:     "dump",
 			Usage:    "Dump all keys and their values",
 			Category: "ACTIONS",
 			Action: expectArgs(0, func(ctx *cli.Context) error {
+				kvs := make([]keyValuePair, 0, v.Len())
 				for _, keyValue := range v.MapKeys() {
 					valueValue := v.MapIndex(keyValue)
-					keyInterface, err := getPrimitiveValue(keyValue)
+					keyInterface, err := GetPrimitiveValue(keyValue)
 					if err != nil {
 						return err
 					}
-					valueInterface, err := getPrimitiveValue(valueValue)
+					valueInterface, err := GetPrimitiveValue(valueValue)
 					if err != nil {
 						return err
 					}
-					c.cfg.KeyValuePrinter(keyInterface, valueInterface)
+					kvs = append(kvs, keyValuePair{keyInterface, valueInterface})
 				}
-				return nil
+				return c.printer(ctx).emitKeyValues(kvs)
 			}),
 		},
 		{
@@ -136,13 +604,19 @@ func (c *constructor) makeMapCommands(v reflect.Value) []cli.Command {
 			ArgsUsage: "[key]",
 			Usage:     "Get the value of a given key",
 			Category:  "ACTIONS",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the value as json",
+				},
+			},
 			Action: expectArgs(1, func(ctx *cli.Context) error {
 				keyValue, err := stringToPrimitiveValue(ctx.Args().First(), v.Type().Key())
 				if err != nil {
 					return err
 				}
 				valueValue := v.MapIndex(keyValue)
-				return c.printValue(valueValue)
+				return c.printer(ctx).printValue(valueValue, ctx.Bool("json"))
 			}),
 		},
 		{
@@ -150,15 +624,30 @@ func (c *constructor) makeMapCommands(v reflect.Value) []cli.Command {
 			ArgsUsage: "[key] [value]",
 			Usage:     "Set the key to the given value",
 			Category:  "ACTIONS",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Parse the value as json, for values that are not primitive",
+				},
+			},
 			Action: expectArgs(2, func(ctx *cli.Context) error {
 				keyValue, err := stringToPrimitiveValue(ctx.Args().First(), v.Type().Key())
 				if err != nil {
 					return err
 				}
+				if ctx.Bool("json") {
+					return setMapJSON(v, keyValue, []byte(ctx.Args().Get(1)))
+				}
 				valueValue, err := stringToPrimitiveValue(ctx.Args().Get(1), v.Type().Elem())
 				if err != nil {
 					return err
 				}
+				if v.IsNil() {
+					if !v.CanSet() {
+						return fmt.Errorf("cannot set key in nil %s", v.Type())
+					}
+					v.Set(reflect.MakeMap(v.Type()))
+				}
 				v.SetMapIndex(keyValue, valueValue)
 				return nil
 			}),
@@ -178,25 +667,244 @@ func (c *constructor) makeMapCommands(v reflect.Value) []cli.Command {
 			}),
 		},
 	}
+	cmds = append(cmds, c.makeExtraDumpers(v, mapDumpable)...)
+	return append(cmds, c.makeFileCommands(v, mapDumpable)...)
 }
 
-func makeJsonDumper(v reflect.Value, printer func(string)) cli.Command {
+// dumpFunc returns the value in a form suitable for marshaling.
+type dumpFunc func(v reflect.Value) (interface{}, error)
+
+// makeExtraDumpers returns a dump-<format> command for every format in
+// Config.ExtraDumpFormats, marshaling whatever dumpable returns.
+func (c *constructor) makeExtraDumpers(v reflect.Value, dumpable dumpFunc) []cli.Command {
+	formats := make([]string, 0, len(c.cfg.ExtraDumpFormats))
+	for format := range c.cfg.ExtraDumpFormats {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	cmds := make([]cli.Command, 0, len(formats))
+	for _, format := range formats {
+		marshal := c.cfg.ExtraDumpFormats[format]
+		cmds = append(cmds, cli.Command{
+			Name:     "dump-" + format,
+			Usage:    fmt.Sprintf("Dump item as %s", format),
+			Category: "ACTIONS",
+			Flags:    append(c.revealFlags(v.Type()), outputFileFlag(c.cfg)),
+			Action: expectArgs(0, func(ctx *cli.Context) error {
+				vi, err := dumpable(c.revealed(ctx, v))
+				if err != nil {
+					return err
+				}
+				bytes, err := marshal(vi)
+				if err != nil {
+					return err
+				}
+				p := c.printer(ctx)
+				return p.emitDump(ctx, bytes, func() error {
+					return p.emitText(strings.TrimSuffix(string(bytes), "\n"))
+				})
+			}),
+		})
+	}
+	return cmds
+}
+
+// dumpable returns a pointer to the value, so that pointer receiver
+// marshalers get used, copying non-addressable values to a temporary.
+func dumpable(v reflect.Value) (interface{}, error) {
+	if v.CanAddr() && v.Addr().CanInterface() {
+		return v.Addr().Interface(), nil
+	} else if v.CanInterface() {
+		tmp := reflect.New(v.Type())
+		tmp.Elem().Set(v)
+		return tmp.Interface(), nil
+	}
+	return nil, fmt.Errorf("Cannot dump %s", v.Type())
+}
+
+func (c *constructor) makeJsonDumper(v reflect.Value, usage string, dumpable dumpFunc) cli.Command {
+	flags := append(c.revealFlags(v.Type()), outputFileFlag(c.cfg))
+	if v.Kind() == reflect.Struct {
+		flags = append(flags, cli.BoolFlag{
+			Name:  "omit-defaults",
+			Usage: "Leave out the properties equal to their default values",
+		})
+	}
+
 	return cli.Command{
 		Name:     "dump-json",
-		Usage:    "Dump item as json",
+		Usage:    usage,
 		Category: "ACTIONS",
+		Flags:    flags,
 		Action: expectArgs(0, func(ctx *cli.Context) error {
-			var vi interface{}
-			if v.CanAddr() && v.Addr().CanInterface() {
-				vi = v.Addr().Interface()
-			} else {
-				return fmt.Errorf("Cannot dump %s as json", v.Type())
+			dump := dumpable
+			if ctx.Bool("omit-defaults") {
+				dump = c.withoutDefaults
 			}
-			bytes, err := json.MarshalIndent(vi, "", "  ")
+			vi, err := dump(c.revealed(ctx, v))
 			if err != nil {
 				return err
 			}
-			printer(string(bytes))
+			bs, err := marshalJSONIndent(vi)
+			if err != nil {
+				return err
+			}
+			p := c.printer(ctx)
+			return p.emitDump(ctx, bs, func() error {
+				return p.emitJSON(bs)
+			})
+		}),
+	}
+}
+
+// printJSONIndent prints the value as indented json.
+func (p printer) printJSONIndent(v reflect.Value) error {
+	var vi interface{}
+	if v.IsValid() && v.CanInterface() {
+		vi = v.Interface()
+	}
+	bs, err := marshalJSONIndent(vi)
+	if err != nil {
+		return err
+	}
+	return p.emitJSON(bs)
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// makeRawMessageCommands treats json.RawMessage values as opaque json blobs
+// rather than byte slices.
+func (c *constructor) makeRawMessageCommands(v reflect.Value) []cli.Command {
+	cmds := []cli.Command{
+		{
+			Name:     "get",
+			Usage:    "Get the raw json value",
+			Category: "ACTIONS",
+			Action: expectArgs(0, func(ctx *cli.Context) error {
+				return c.printer(ctx).emitJSON(v.Bytes())
+			}),
+		},
+		c.makeJsonDumper(v, "Dump item as json", dumpable),
+	}
+
+	if v.CanSet() {
+		cmds = append(cmds, cli.Command{
+			Name:      "set",
+			ArgsUsage: "[value|@file|-]",
+			Usage:     "Set the raw json value",
+			Category:  "ACTIONS",
+			Action: expectArgs(1, func(ctx *cli.Context) error {
+				data, err := readInput(ctx.Args().First())
+				if err != nil {
+					return err
+				}
+				if !json.Valid(data) {
+					return fmt.Errorf("invalid json: %s", data)
+				}
+				v.SetBytes(append([]byte(nil), data...))
+				return nil
+			}),
+		})
+	}
+	return cmds
+}
+
+// sliceDumpable returns the slice in a form suitable for marshaling.
+func sliceDumpable(v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		// Always produce an array, never null
+		return reflect.MakeSlice(v.Type(), 0, 0).Interface(), nil
+	} else if v.CanAddr() {
+		return v.Addr().Interface(), nil
+	}
+	return v.Interface(), nil
+}
+
+func makeJsonLoader(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:      "set-json",
+		Usage:     "Set item from json",
+		ArgsUsage: "[value|@file|-]",
+		Category:  "ACTIONS",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "merge",
+				Usage: "Only overwrite the properties present in the json",
+			},
+		},
+		Action: expectArgs(1, func(ctx *cli.Context) error {
+			data, err := readInput(ctx.Args().First())
+			if err != nil {
+				return err
+			}
+
+			// Unmarshal into a temporary, so that bad input does not leave
+			// the value half set
+			if ctx.Bool("merge") {
+				newValue := deepCopy(v)
+				if err := json.Unmarshal(data, newValue.Addr().Interface()); err != nil {
+					return err
+				}
+				copyInPlace(v, newValue, make(map[seenPointer]reflect.Value))
+				return nil
+			}
+			newValue := reflect.New(v.Type()).Elem()
+			if err := json.Unmarshal(data, newValue.Addr().Interface()); err != nil {
+				return err
+			}
+			v.Set(newValue)
+			return nil
+		}),
+	}
+}
+
+// makeRootJsonLoader returns the load-json command, the inverse of the root
+// dump-json, replacing the whole value at once.
+func makeRootJsonLoader(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:      "load-json",
+		Usage:     "Replace everything with the given json document",
+		ArgsUsage: "[value|@file|-]",
+		Category:  "ACTIONS",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "validate-only",
+				Usage: "Only check that the document is valid",
+			},
+		},
+		Action: expectArgs(1, func(ctx *cli.Context) error {
+			data, err := readInput(ctx.Args().First())
+			if err != nil {
+				return err
+			}
+
+			newValue := reflect.New(v.Type()).Elem()
+			if err := json.Unmarshal(data, newValue.Addr().Interface()); err != nil {
+				return err
+			}
+			if err := validate(newValue); err != nil {
+				return err
+			}
+			if ctx.Bool("validate-only") {
+				return nil
+			}
+			v.Set(newValue)
+			return nil
+		}),
+	}
+}
+
+func makeZeroer(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:     "zero",
+		Usage:    "Reset all properties to their zero values",
+		Category: "ACTIONS",
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			if !v.CanSet() {
+				return fmt.Errorf("cannot zero %s: value is not settable", v.Type())
+			}
+			v.Set(reflect.Zero(v.Type()))
 			return nil
 		}),
 	}
@@ -207,10 +915,16 @@ func (c *constructor) makeSliceAccessorCommands(keyer func(int) (string, error),
 	for vi := 0; vi < v.Len(); vi++ {
 		idx := vi // Copy loop variable
 		key, err := keyer(idx)
+		if err != nil {
+			if c.skipKeyError(err) {
+				continue
+			}
+			return nil, err
+		}
+		keyCmds, err := c.getCommandsForValue(v.Index(idx), nil)
 		if err != nil {
 			return nil, err
 		}
-		keyCmds, err := c.getCommandsForValue(v.Index(idx))
 		keyCmds = append(keyCmds, cli.Command{
 			Name:     "delete",
 			Usage:    fmt.Sprintf("Delete item represented by key %q from the collection", key),
@@ -229,31 +943,193 @@ func (c *constructor) makeSliceAccessorCommands(keyer func(int) (string, error),
 	return cmds, nil
 }
 
+// sliceBound converts a python style index, which counts from the end if
+// negative, to a slice bound clamped to the length.
+func sliceBound(arg string, length int) (int, error) {
+	idx, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, err
+	}
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 {
+		return 0, nil
+	}
+	if idx > length {
+		return length, nil
+	}
+	return idx, nil
+}
+
+func (c *constructor) makeSubSliceCommand(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:      "slice",
+		Usage:     "Dump the items from start up to end as a json array, negative indexes count from the end",
+		ArgsUsage: "[--] [start] [end]",
+		Category:  "ACTIONS",
+		Flags:     c.revealFlags(v.Type()),
+		// Keep negative indexes after the start from being taken as flags
+		SkipArgReorder: true,
+		Action: func(ctx *cli.Context) error {
+			if ctx.NArg() < 1 || ctx.NArg() > 2 {
+				return fmt.Errorf("expected 1 or 2 arguments, got %d", ctx.NArg())
+			}
+			start, err := sliceBound(ctx.Args().Get(0), v.Len())
+			if err != nil {
+				return err
+			}
+			end := v.Len()
+			if ctx.NArg() == 2 {
+				if end, err = sliceBound(ctx.Args().Get(1), v.Len()); err != nil {
+					return err
+				}
+			}
+			if end < start {
+				end = start
+			}
+
+			items := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), 0, end-start)
+			items = reflect.AppendSlice(items, c.revealed(ctx, v).Slice(start, end))
+			bytes, err := json.MarshalIndent(items.Interface(), "", "  ")
+			if err != nil {
+				return err
+			}
+			return c.printer(ctx).emitJSON(bytes)
+		},
+	}
+}
+
+// liveItem is a command giving access to an item of a slice by position.
+type liveItem struct {
+	name  string
+	usage string
+	index func(v reflect.Value) int
+}
+
+var liveItems = []liveItem{
+	{"first", "Access the first item", func(reflect.Value) int {
+		return 0
+	}},
+	{"last", "Access the last item", func(v reflect.Value) int {
+		return v.Len() - 1
+	}},
+}
+
+func isLiveItemCommand(cmd cli.Command) bool {
+	return cmd.Category == "ITEMS" && cmd.SkipFlagParsing
+}
+
+// makeLiveItemCommand returns a command giving access to the item, which gets
+// resolved when the command runs rather than when it is constructed, so that
+// it tracks the live slice. The item commands report mutations under the
+// path, if the root is known.
+func (c *constructor) makeLiveItemCommand(item liveItem, v reflect.Value, root reflect.Value, path []string) cli.Command {
+	name, usage := item.name, item.usage
+	return cli.Command{
+		Name:            name,
+		Usage:           usage,
+		ArgsUsage:       "[command]",
+		Category:        "ITEMS",
+		SkipFlagParsing: true,
+		Action: func(ctx *cli.Context) error {
+			if v.Len() == 0 {
+				return errors.New("no items in the collection")
+			}
+			index := item.index(v)
+			itemCmds, err := c.getCommandsForValue(v.Index(index), nil)
+			if err != nil {
+				return err
+			}
+			if root.IsValid() {
+				key, err := c.makeKeyer(v)(index)
+				if err != nil {
+					return err
+				}
+				c.mutationCommands(root, appendPath(path, key), itemCmds)
+			}
+			if err := c.renameActions(itemCmds); err != nil {
+				return err
+			}
+
+			app := cli.NewApp()
+			app.Name = name
+			app.Usage = usage
+			if c.cfg.OutputFlag {
+				addOutputFlag(itemCmds)
+				app.Flags = []cli.Flag{outputFlag}
+			}
+			if c.cfg.CommandDecorator != nil {
+				c.decorateCommands(itemCmds)
+			}
+			app.Commands = itemCmds
+			app.Writer = ctx.App.Writer
+			app.ErrWriter = ctx.App.ErrWriter
+			return app.Run(append([]string{name}, ctx.Args()...))
+		},
+	}
+}
+
+// makeKeyer returns a function producing the key of the i-th item in the
+// slice, which is either the value of the field tagged as the ID or the index.
+func (c *constructor) makeKeyer(v reflect.Value) func(int) (string, error) {
+	member := v.Type().Elem()
+	if member.Kind() == reflect.Struct {
+		for mi := 0; mi < member.NumField(); mi++ {
+			if hasTag(member.Field(mi), c.cfg.IDTag) {
+				fieldIndex := mi // Copy loop variable
+				numeric := isNumericKind(member.Field(mi).Type.Kind())
+				return func(i int) (string, error) {
+					field := v.Index(i).Field(fieldIndex)
+					val, err := GetPrimitiveValue(field)
+					if err != nil {
+						return "", errors.Wrapf(err, "key of item %d", i)
+					}
+					key := fmt.Sprint(val)
+
+					// Zero IDs would collide with each other, and numeric
+					// looking IDs with indexes, so fall back to a key that
+					// can be neither
+					_, convErr := strconv.Atoi(key)
+					if field.IsZero() || key == "" || (!numeric && convErr == nil) {
+						fallback := fmt.Sprintf("_index_%d", i)
+						c.logError(fmt.Errorf("item %d has an unusable id %q, using key %q", i, key, fallback))
+						return fallback, nil
+					}
+					return key, nil
+				}
+			}
+		}
+	}
+
+	format := c.cfg.SliceKeyFormat
+	if format == "" {
+		format = "%d"
+	}
+	return func(i int) (string, error) {
+		return fmt.Sprintf(format, i+c.cfg.SliceKeyBase), nil
+	}
+}
+
 func (c *constructor) makeSliceCommands(v reflect.Value) ([]cli.Command, error) {
 	member := v.Type().Elem()
 
-	keyer := func(i int) (string, error) {
-		return fmt.Sprint(i), nil
-	}
-
-	primitive := isPrimitiveKind(member.Kind())
+	// Slices of text unmarshalers, such as []net.IP, hold primitive values
+	// even though the members are themselves slices.
+	primitive := isPrimitiveKind(member.Kind()) || member == hardwareAddrType || reflect.PtrTo(member).Implements(textUnmarshaler)
 
-	if !primitive && member.Kind() != reflect.Struct {
-		return nil, unsupportedKindErr(member.Kind())
+	if !primitive && member.Kind() != reflect.Struct && member.Kind() != reflect.Map {
+		return c.unsupportedKind(member.Kind())
 	}
-
-	if !primitive {
-		for mi := 0; mi < member.NumField(); mi++ {
-			if hasTag(member.Field(mi), c.cfg.IDTag) {
-				keyer = func(i int) (string, error) {
-					val, err := getPrimitiveValue(v.Index(i).Field(mi))
-					return fmt.Sprint(val), err
-				}
-				break
-			}
+	// The add flags exist even without any items to construct commands for
+	if member.Kind() == reflect.Struct && !primitive {
+		if err := c.checkFieldNames(member, make(map[reflect.Type]bool)); err != nil {
+			return nil, err
 		}
 	}
 
+	keyer := c.makeKeyer(v)
+
 	cmds := make([]cli.Command, 0, v.Len()+2)
 	if accessCmds, err := c.makeSliceAccessorCommands(keyer, v); err != nil {
 		return nil, err
@@ -261,23 +1137,42 @@ func (c *constructor) makeSliceCommands(v reflect.Value) ([]cli.Command, error)
 		cmds = append(cmds, accessCmds...)
 	}
 
-	cmds = append(cmds, cli.Command{
+	// Item keys take precedence over the convenience commands
+	taken := make(map[string]bool, len(cmds))
+	for _, cmd := range cmds {
+		taken[cmd.Name] = true
+	}
+	for _, item := range liveItems {
+		if !taken[item.name] {
+			cmds = append(cmds, c.makeLiveItemCommand(item, v, reflect.Value{}, nil))
+		}
+	}
+
+	cmds = append(cmds, c.makeCountCommand(v), c.makeJsonDumper(v, "Dump items as a json array", sliceDumpable), cli.Command{
 		Name:     "list",
 		Usage:    "List item keys in the collection",
 		Category: "ACTIONS",
 		Action: expectArgs(0, func(ctx *cli.Context) error {
+			keys := make([]interface{}, 0, v.Len())
 			for vi := 0; vi < v.Len(); vi++ {
 				idx := vi // Copy loop variable
 				key, err := keyer(idx)
 				if err != nil {
+					if c.skipKeyError(err) {
+						continue
+					}
 					return err
 				}
-				c.cfg.ValuePrinter(key)
+				keys = append(keys, key)
 			}
-			return nil
+			return c.printer(ctx).emitList(keys)
 		}),
 	})
 
+	cmds = append(cmds, c.makeSubSliceCommand(v))
+	cmds = append(cmds, c.makeExtraDumpers(v, sliceDumpable)...)
+	cmds = append(cmds, c.makeFileCommands(v, sliceDumpable)...)
+
 	if primitive {
 		cmds = append(cmds, cli.Command{
 			Name:      "add",
@@ -293,21 +1188,69 @@ func (c *constructor) makeSliceCommands(v reflect.Value) ([]cli.Command, error)
 				return nil
 			}),
 		})
-	} else {
+	} else if member.Kind() == reflect.Struct {
+		cmds = append(cmds, c.makeTableCommand(v))
 		cmds = append(cmds, c.makeSliceItemBuilders(v)...)
+	} else {
+		cmds = append(cmds, makeSliceJsonAdder(v))
 	}
 
 	return cmds, nil
 }
 
+// checkFieldNames returns an error if any two fields of the struct type, or
+// of the structs nested in it, share a name, as their flags would.
+func (c *constructor) checkFieldNames(t reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	fields := make(map[string]string, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if c.isSkipped(f) {
+			continue
+		}
+		name := c.fieldName(f)
+		if other, ok := fields[name]; ok {
+			return fmt.Errorf("%s: command name %q is already in use by %s", f.Name, name, other)
+		}
+		fields[name] = f.Name
+		if ft := derefType(f.Type); ft.Kind() == reflect.Struct && !isPrimitiveType(f.Type) {
+			if err := c.checkFieldNames(ft, seen); err != nil {
+				return errors.Wrap(err, f.Name)
+			}
+		}
+	}
+	return nil
+}
+
 func (c *constructor) makeSliceItemBuilderFlags(memberType reflect.Type) []cli.Flag {
+	return c.makeSliceItemBuilderFlagsRecursive(memberType, "", make(map[reflect.Type]bool))
+}
+
+// makeSliceItemBuilderFlagsRecursive returns the flags for the fields of the
+// struct type, prefixed by prefix, including the fields of nested structs
+// prefixed by the name of the struct field and a dash, such as address-host.
+func (c *constructor) makeSliceItemBuilderFlagsRecursive(memberType reflect.Type, prefix string, seen map[reflect.Type]bool) []cli.Flag {
+	// Stop at recursive types
+	if seen[memberType] {
+		return nil
+	}
+	seen[memberType] = true
+	defer delete(seen, memberType)
+
 	flags := make([]cli.Flag, 0, memberType.NumField())
 	for fi := 0; fi < memberType.NumField(); fi++ {
 		memberField := memberType.Field(fi)
-		usage := ""
-		if defaultValueString, ok := memberField.Tag.Lookup(c.cfg.DefaultTagName); ok {
-			usage = fmt.Sprintf("default value: %s", defaultValueString)
+		if c.isSkipped(memberField) {
+			continue
 		}
+		name := prefix + c.fieldName(memberField)
+		hidden := c.isHidden(memberField)
+		usage := c.builderFlagUsage(memberField)
 
 		memberKind := simplifyKind(memberField.Type.Kind())
 		memberKindIsTextUnmarshaler := memberField.Type.Implements(textUnmarshaler) || reflect.PtrTo(memberField.Type).Implements(textUnmarshaler)
@@ -315,23 +1258,27 @@ func (c *constructor) makeSliceItemBuilderFlags(memberType reflect.Type) []cli.F
 		switch {
 		case memberKind == reflect.Bool:
 			flags = append(flags, cli.BoolFlag{
-				Name:  c.cfg.FieldNameConverter(memberField.Name),
-				Usage: usage,
+				Name:   name,
+				Usage:  usage,
+				Hidden: hidden,
 			})
 		case memberKind == reflect.String || memberKindIsTextUnmarshaler:
 			flags = append(flags, cli.StringFlag{
-				Name:  c.cfg.FieldNameConverter(memberField.Name),
-				Usage: usage,
+				Name:   name,
+				Usage:  usage,
+				Hidden: hidden,
 			})
 		case memberKind == reflect.Int:
 			flags = append(flags, cli.Int64Flag{
-				Name:  c.cfg.FieldNameConverter(memberField.Name),
-				Usage: usage,
+				Name:   name,
+				Usage:  usage,
+				Hidden: hidden,
 			})
 		case memberKind == reflect.Float32 || memberKind == reflect.Float64:
 			flags = append(flags, cli.Float64Flag{
-				Name:  c.cfg.FieldNameConverter(memberField.Name),
-				Usage: usage,
+				Name:   name,
+				Usage:  usage,
+				Hidden: hidden,
 			})
 		case memberKind == reflect.Array || memberKind == reflect.Slice:
 			arrayKind := simplifyKind(memberField.Type.Elem().Kind())
@@ -340,18 +1287,219 @@ func (c *constructor) makeSliceItemBuilderFlags(memberType reflect.Type) []cli.F
 			switch {
 			case arrayKind == reflect.Int:
 				flags = append(flags, cli.Int64SliceFlag{
-					Name: c.cfg.FieldNameConverter(memberField.Name),
+					Name:   name,
+					Usage:  usage,
+					Hidden: hidden,
 				})
 			case arrayKind == reflect.String || arrayKindIsTextUnmarshaler:
 				flags = append(flags, cli.StringSliceFlag{
-					Name: c.cfg.FieldNameConverter(memberField.Name),
+					Name:   name,
+					Usage:  usage,
+					Hidden: hidden,
 				})
 			}
+		case derefType(memberField.Type).Kind() == reflect.Struct:
+			flags = append(flags, c.makeSliceItemBuilderFlagsRecursive(derefType(memberField.Type), name+"-", seen)...)
 		}
 	}
 	return flags
 }
 
+// builderFlagUsage returns the usage of the flag setting the field, which is
+// the usage tag followed by the default value and the environment variable
+// overriding it, such as "Listen addresses (default: dynamic)".
+func (c *constructor) builderFlagUsage(f reflect.StructField) string {
+	usage := f.Tag.Get(c.cfg.UsageTagName)
+	var details []string
+	if defaultValue, ok := f.Tag.Lookup(c.cfg.DefaultTagName); ok {
+		details = append(details, "default: "+defaultValue)
+	}
+	if env := f.Tag.Get(c.cfg.EnvTagName); c.cfg.EnvTagName != "" && env != "" {
+		details = append(details, "env: "+env)
+	}
+	if len(details) > 0 {
+		if usage == "" {
+			usage = strings.Join(details, ", ")
+		} else {
+			usage += " (" + strings.Join(details, ", ") + ")"
+		}
+	}
+	if note, ok := c.deprecation(f); ok {
+		usage = deprecatedUsage(usage, note)
+	}
+	return usage
+}
+
+// applyFlags sets the fields of the struct v from the flags generated by
+// makeSliceItemBuilderFlags, touching only the flags that were actually set.
+func (c *constructor) applyFlags(ctx *cli.Context, v reflect.Value) error {
+	return c.applyFlagsRecursive(ctx, v, "", true)
+}
+
+// checkFlags parses and validates the flags that were set as applyFlags
+// would, without touching any value.
+func (c *constructor) checkFlags(ctx *cli.Context, t reflect.Type) error {
+	return c.applyFlagsRecursive(ctx, reflect.New(t).Elem(), "", false)
+}
+
+func (c *constructor) applyFlagsRecursive(ctx *cli.Context, v reflect.Value, prefix string, warn bool) error {
+	t := v.Type()
+	for mi := 0; mi < v.NumField(); mi++ {
+		field := t.Field(mi)
+		if c.isSkipped(field) {
+			continue
+		}
+		flagName := prefix + c.fieldName(field)
+
+		if ft := derefType(field.Type); ft.Kind() == reflect.Struct && !isPrimitiveType(field.Type) {
+			// Nested structs only get allocated if any of their flags is set
+			for _, flag := range c.makeSliceItemBuilderFlagsRecursive(ft, flagName+"-", make(map[reflect.Type]bool)) {
+				if ctx.IsSet(flag.GetName()) {
+					if err := c.applyFlagsRecursive(ctx, derefAndInit(v.Field(mi)), flagName+"-", warn); err != nil {
+						return err
+					}
+					break
+				}
+			}
+			continue
+		}
+
+		if !ctx.IsSet(flagName) {
+			continue
+		}
+		if note, ok := c.deprecation(field); ok && warn {
+			c.warnDeprecated(ctx, flagName, note)
+		}
+
+		fieldValue := derefAndInit(v.Field(mi))
+		if isPrimitive(fieldValue) {
+			if err := SetPrimitiveValueFromString(fieldValue, ctx.Generic(flagName).(flag.Value).String()); err != nil {
+				return errors.Wrap(err, flagName)
+			}
+		} else if fieldValue.Kind() == reflect.Array || fieldValue.Kind() == reflect.Slice {
+			var items []string
+			switch simplifyKind(fieldValue.Type().Elem().Kind()) {
+			case reflect.Int:
+				for _, item := range ctx.Int64Slice(flagName) {
+					items = append(items, fmt.Sprint(item))
+				}
+			default:
+				items = ctx.StringSlice(flagName)
+			}
+			if err := setSliceValueFromStrings(fieldValue, items); err != nil {
+				return errors.Wrap(err, flagName)
+			}
+		}
+
+		if err := c.validateField(field, fieldValue); err != nil {
+			return errors.Wrap(err, flagName)
+		}
+	}
+	return nil
+}
+
+func (c *constructor) validateField(field reflect.StructField, v reflect.Value) error {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if enum, ok := field.Tag.Lookup(c.cfg.EnumTagName); ok && isPrimitive(v) {
+		val, err := GetPrimitiveValue(v)
+		if err != nil {
+			return err
+		}
+		options := strings.Split(enum, ",")
+		valid := false
+		for _, option := range options {
+			if fmt.Sprint(val) == option {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid value %q, expected one of: %s", fmt.Sprint(val), strings.Join(options, ", "))
+		}
+	}
+
+	num, isNumeric := numericValue(v)
+	if !isNumeric {
+		return nil
+	}
+
+	if minString, ok := field.Tag.Lookup(c.cfg.MinTagName); ok {
+		min, err := strconv.ParseFloat(minString, 64)
+		if err != nil {
+			return errors.Wrap(err, "min tag")
+		}
+		if num < min {
+			return fmt.Errorf("value %v is less than the minimum of %s", num, minString)
+		}
+	}
+
+	if maxString, ok := field.Tag.Lookup(c.cfg.MaxTagName); ok {
+		max, err := strconv.ParseFloat(maxString, 64)
+		if err != nil {
+			return errors.Wrap(err, "max tag")
+		}
+		if num > max {
+			return fmt.Errorf("value %v is greater than the maximum of %s", num, maxString)
+		}
+	}
+
+	return nil
+}
+
+func (c *constructor) makeStructSetter(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:      "set",
+		Usage:     "Set multiple properties at once",
+		ArgsUsage: "-attribute=value",
+		Category:  "ACTIONS",
+		Flags:     c.makeSliceItemBuilderFlags(v.Type()),
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			if ctx.NumFlags() == 0 {
+				return errors.New("no properties specified")
+			}
+
+			// Check all the flags first, so that a failure does not leave
+			// the value half set
+			if err := c.checkFlags(ctx, v.Type()); err != nil {
+				return err
+			}
+			return c.applyFlags(ctx, v)
+		}),
+	}
+}
+
+func (c *constructor) makeDefaultsResetter(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:     "reset-defaults",
+		Usage:    "Reset all properties to their default values",
+		Category: "ACTIONS",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "keep-set",
+				Usage: "Only reset properties that are not set",
+			},
+		},
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			keepSet := ctx.Bool("keep-set")
+
+			newValue := deepCopy(v)
+			if !keepSet {
+				newValue.Set(reflect.Zero(v.Type()))
+			}
+			touched, err := applyDefaults(c.defaults(), newValue.Addr().Interface(), nil, keepSet)
+			if err != nil {
+				return err
+			}
+			copyInPlace(v, newValue, make(map[seenPointer]reflect.Value))
+
+			return c.printer(ctx).emitText(fmt.Sprintf("%d properties reset to defaults", touched))
+		}),
+	}
+}
+
 func (c *constructor) makeSliceItemBuilders(v reflect.Value) []cli.Command {
 	memberType := v.Type().Elem()
 
@@ -367,55 +1515,87 @@ func (c *constructor) makeSliceItemBuilders(v reflect.Value) []cli.Command {
 					return errors.New("no properties specified")
 				}
 
-				// Create a new item that will go in the slice
+				// Create a new item that will go in the slice. Its fields are
+				// addressable, so that pointer receiver TextUnmarshalers
+				// get used when applying the flags.
 				newValue := reflect.New(memberType).Elem()
 
 				// Set defaults
-				if err := setDefaults(c.cfg.DefaultTagName, newValue.Addr().Interface(), nil); err != nil {
+				if err := setDefaults(c.defaults(), newValue.Addr().Interface()); err != nil {
 					return err
 				}
 
-				for mi := 0; mi < newValue.NumField(); mi++ {
-					flagName := c.cfg.FieldNameConverter(memberType.Field(mi).Name)
-					fieldValue := deref(newValue.Field(mi))
-					if ctx.IsSet(flagName) {
-						if isPrimitive(fieldValue) {
-							if err := setPrimitiveValueFromString(fieldValue, ctx.Generic(flagName).(flag.Value).String()); err != nil {
-								return err
-							}
-							continue
-						}
-
-						switch fieldValue.Kind() {
-						case reflect.Array, reflect.Slice:
-							switch simplifyKind(fieldValue.Kind()) {
-							case reflect.Int:
-								fieldValue.Set(reflect.ValueOf(ctx.IntSlice(flagName)))
-							case reflect.String:
-								fieldValue.Set(reflect.ValueOf(ctx.StringSlice(flagName)))
-							}
-						}
-					}
+				if err := c.applyFlags(ctx, newValue); err != nil {
+					return err
 				}
-				v.Set(reflect.Append(v, newValue))
-				return nil
-			}),
-		},
-		{
-			Name:      "add-json",
-			Usage:     "Add a new item to collection deserialised from JSON",
-			ArgsUsage: "[value]",
-			Category:  "ACTIONS",
-			Action: expectArgs(1, func(ctx *cli.Context) error {
-				newValue := reflect.New(memberType)
-				if err := json.Unmarshal([]byte(ctx.Args().First()), newValue.Interface()); err != nil {
+				if err := validate(newValue); err != nil {
 					return err
 				}
-				v.Set(reflect.Append(v, newValue.Elem()))
+				v.Set(reflect.Append(v, newValue))
 				return nil
 			}),
 		},
+		makeSliceJsonAdder(v),
+	}
+}
+
+func makeSliceJsonAdder(v reflect.Value) cli.Command {
+	memberType := v.Type().Elem()
+
+	return cli.Command{
+		Name:      "add-json",
+		Usage:     "Add a new item to collection deserialised from JSON",
+		ArgsUsage: "[value]",
+		Category:  "ACTIONS",
+		Action: expectArgs(1, func(ctx *cli.Context) error {
+			newValue := reflect.New(memberType)
+			if err := json.Unmarshal([]byte(ctx.Args().First()), newValue.Interface()); err != nil {
+				return err
+			}
+			if err := validate(newValue.Elem()); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, newValue.Elem()))
+			return nil
+		}),
+	}
+}
+
+// fieldName returns the command name for the field, which is either the
+// value of the name tag or the converted field name.
+func (c *constructor) fieldName(f reflect.StructField) string {
+	if name := f.Tag.Get(c.cfg.NameTagName); name != "" {
+		return name
+	}
+	if c.cfg.UseJSONTagNames {
+		if name, ok := jsonFieldName(f); ok {
+			return c.cfg.FieldNameConverter(name)
+		}
+	}
+	return c.cfg.FieldNameConverter(f.Name)
+}
+
+func (c *constructor) isHidden(f reflect.StructField) bool {
+	return c.cfg.HiddenTag.Name != "" && hasTag(f, c.cfg.HiddenTag)
+}
+
+func (c *constructor) isSkipped(f reflect.StructField) bool {
+	// This is what encoding/json does
+	isUnexported := f.PkgPath != ""
+	if f.Anonymous || hasTag(f, c.cfg.SkipTag) || isUnexported {
+		return true
+	}
+	if _, ok := jsonFieldName(f); !ok && c.cfg.UseJSONTagNames {
+		return true
+	}
+
+	t := derefType(f.Type)
+	for _, skipType := range c.cfg.SkipTypes {
+		if t == skipType {
+			return true
+		}
 	}
+	return false
 }
 
 func (c *constructor) Construct(item interface{}) ([]cli.Command, error) {
@@ -423,50 +1603,273 @@ func (c *constructor) Construct(item interface{}) ([]cli.Command, error) {
 	if itemValue.Kind() != reflect.Ptr {
 		return nil, errors.New("expected a pointer got: " + itemValue.Kind().String())
 	}
+	if itemValue.IsNil() {
+		return nil, errors.New("expected a pointer got: nil " + itemValue.Type().String())
+	}
 	itemValue = itemValue.Elem()
-	if itemValue.Kind() != reflect.Struct {
-		return nil, errors.New("expected pointer to a struct got a pointer to: " + itemValue.Kind().String())
+	switch itemValue.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map:
+	default:
+		return nil, errors.New("expected pointer to a struct, slice or map got a pointer to: " + itemValue.Kind().String())
+	}
+
+	if c.cfg.Mutex != nil {
+		// The value gets inspected while constructing the commands
+		c.cfg.Mutex.RLock()
+		defer c.cfg.Mutex.RUnlock()
+	}
+
+	var cmds []cli.Command
+	var err error
+	if itemValue.Kind() == reflect.Struct {
+		cmds, err = c.makeStructCommands(itemValue, true)
+	} else {
+		// Collections have the same commands at the root as anywhere else
+		cmds, err = c.getCommandsForValue(itemValue, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.TreeCommand {
+		cmds = append(cmds, c.makeTreeCommand(&cmds))
+	}
+	if c.cfg.DocsCommand {
+		cmds = append(cmds, c.makeDocsCommand(&cmds))
+	}
+	if c.cfg.ConfirmMutations || c.cfg.OnMutation != nil || c.cfg.Validate != nil {
+		c.mutationCommands(itemValue, nil, cmds)
+	}
+	if c.cfg.OutputFlag {
+		addOutputFlag(cmds)
+	}
+	if c.cfg.Mutex != nil {
+		c.lockCommands(cmds)
+	}
+	// Actions are told apart by their names, so they only get renamed and
+	// prefixed once wrapped
+	if err := c.renameActions(cmds); err != nil {
+		return nil, err
+	}
+	for i := range cmds {
+		cmds[i].Name = c.cfg.CommandPrefix + cmds[i].Name
+	}
+	if c.cfg.CommandDecorator != nil {
+		c.decorateCommands(cmds)
+	}
+
+	return cmds, validateCommandNames(cmds)
+}
+
+// decorateCommands calls Config.CommandDecorator for the commands, after
+// their subcommands.
+func (c *constructor) decorateCommands(cmds []cli.Command) {
+	for i := range cmds {
+		c.decorateCommands(cmds[i].Subcommands)
+		c.cfg.CommandDecorator(&cmds[i])
+	}
+}
+
+// actionName returns the name of the action as renamed by
+// Config.ActionNames.
+func (c *constructor) actionName(name string) string {
+	if renamed, ok := c.cfg.ActionNames[name]; ok {
+		return renamed
+	}
+	return name
+}
+
+// renameActions renames the actions among the commands and their subcommands
+// according to Config.ActionNames, checking that the names are still unique
+// at every level.
+func (c *constructor) renameActions(cmds []cli.Command) error {
+	if len(c.cfg.ActionNames) == 0 {
+		return nil
+	}
+	for i := range cmds {
+		if err := c.renameActions(cmds[i].Subcommands); err != nil {
+			return errors.Wrap(err, cmds[i].Name)
+		}
+		if cmds[i].Category != "ACTIONS" {
+			continue
+		}
+		name := c.actionName(cmds[i].Name)
+		if name == "" {
+			return fmt.Errorf("empty name for the %s action", cmds[i].Name)
+		}
+		cmds[i].Name = name
+	}
+	return validateCommandNames(cmds)
+}
+
+// validateCommandNames returns an error if any two commands share a name or
+// an alias.
+func validateCommandNames(cmds []cli.Command) error {
+	seen := make(map[string]struct{}, len(cmds))
+	for _, cmd := range cmds {
+		for _, name := range cmd.Names() {
+			if _, ok := seen[name]; ok {
+				return fmt.Errorf("duplicate command name: %s", name)
+			}
+			seen[name] = struct{}{}
+		}
 	}
+	return nil
+}
+
+// rootAliases are the alternative names of the root actions.
+var rootAliases = map[string][]string{
+	// Short for partial updates of the whole value
+	"merge-json": {"merge", "patch"},
+	// Named after the json pointer like the other operations on it
+	"get-pointer": {"pointer-get"},
+	"set-pointer": {"pointer-set"},
+}
+
+func (c *constructor) makeStructCommands(itemValue reflect.Value, root bool) ([]cli.Command, error) {
 	itemType := itemValue.Type()
 
-	cmds := make([]cli.Command, 0, itemType.NumField())
+	getter := c.makeJsonDumper(itemValue, "Dump item as json", dumpable)
+	getter.Name = "get"
+	getter.Usage = "Get the value as json"
+	actions := []cli.Command{getter, c.makeJsonDumper(itemValue, "Dump item as json", dumpable)}
+	if c.cfg.ShowCommand {
+		actions = append(actions, c.makeShowCommand(itemValue))
+	}
+	if c.cfg.DumpEnvCommand {
+		actions = append(actions, c.makeEnvDumper(itemValue))
+	}
+	actions = append(actions, c.makeJsonDiffer(itemValue))
+	if c.cfg.ZeroCommand {
+		actions = append(actions, makeZeroer(itemValue))
+	}
+	actions = append(actions, c.makeExtraDumpers(itemValue, dumpable)...)
+	actions = append(actions, c.makeFileCommands(itemValue, dumpable)...)
+	if itemValue.CanSet() {
+		// The root set also takes the paths of PathCommands
+		if c.cfg.StructSetCommand || root && c.cfg.PathCommands {
+			actions = append(actions, c.makeStructSetter(itemValue))
+		}
+		actions = append(actions, makeJsonLoader(itemValue), c.makeJsonMerger(itemValue), c.makeDefaultsResetter(itemValue))
+	}
+	if root && itemValue.CanSet() {
+		actions = append(actions, makeRootJsonLoader(itemValue))
+	}
+	if root {
+		if c.cfg.PathsCommand {
+			actions = append(actions, c.makePathsCommand(itemType))
+		}
+		if c.cfg.SchemaCommand {
+			actions = append(actions, c.makeSchemaCommand(itemType))
+		}
+		if c.cfg.ExportScriptCommand {
+			actions = append(actions, c.makeScriptExporter(itemValue))
+		}
+		validator, err := c.structValidator()
+		if err != nil {
+			return nil, err
+		}
+		if validator != nil {
+			actions = append(actions, c.makeValidateCommand(itemValue, validator))
+		}
+		if c.cfg.PathCommands {
+			c.addPathCommands(itemValue, actions)
+			actions = append(actions, c.makeApplyCommand(itemValue))
+			actions = append(actions, c.makePointerCommands(itemValue)...)
+		}
+	}
+
+	names := make(map[string]bool, itemType.NumField()+len(actions))
+	for _, action := range actions {
+		names[c.actionName(action.Name)] = true
+	}
+	// fields are the names taken by fields, for reporting collisions
+	fields := make(map[string]string, itemType.NumField())
+
+	cmds := make([]cli.Command, 0, itemType.NumField()+len(actions))
 	for i := 0; i < itemType.NumField(); i++ {
 		f := itemType.Field(i)
 		v := itemValue.Field(i)
 
-		// This is what encoding/json does
-		isUnexported := f.PkgPath != ""
-		if f.Anonymous || hasTag(f, c.cfg.SkipTag) || isUnexported {
+		if c.isSkipped(f) {
 			continue
 		}
 
-		valueCmds, err := c.getCommandsForValue(v)
+		name := c.fieldName(f)
+		if names[name] && c.cfg.OnNameCollision != nil {
+			name = c.cfg.OnNameCollision(f.Name, name)
+		}
+		if other, ok := fields[name]; ok {
+			return nil, fmt.Errorf("%s: command name %q is already in use by %s", f.Name, name, other)
+		}
+		if names[name] && c.cfg.StrictCommandNames {
+			return nil, fmt.Errorf("%s: command name %q is already in use", f.Name, name)
+		}
+
+		valueCmds, err := c.getCommandsForValue(v, &f)
+		if err == errSkipValue {
+			continue
+		}
 		if err != nil {
 			return nil, errors.Wrap(err, f.Name)
 		}
+		names[name] = true
+		fields[name] = f.Name
+		usage := f.Tag.Get(c.cfg.UsageTagName)
+		if note, ok := c.deprecation(f); ok {
+			usage = deprecatedUsage(usage, note)
+			c.deprecateCommands(valueCmds, name, note)
+		}
 		cmds = append(cmds, cli.Command{
-			Name:        c.cfg.FieldNameConverter(f.Name),
-			Usage:       f.Tag.Get(c.cfg.UsageTagName),
+			Name:        name,
+			Usage:       usage,
 			Category:    "PROPERTIES",
+			Hidden:      c.isHidden(f),
 			Subcommands: valueCmds,
 		})
 	}
-	cmds = append(cmds, makeJsonDumper(itemValue, func(s string) {
-		c.cfg.ValuePrinter(s)
-	}))
+	if root && len(cmds) == 0 {
+		// Most likely all fields are unexported or skipped by mistake
+		return nil, errors.New("struct has no accessible fields")
+	}
 
-	return cmds, nil
+	// Fields take the names of the actions they collide with, unless the
+	// action was explicitly renamed to it
+	kept := actions[:0]
+	for _, action := range actions {
+		name := c.actionName(action.Name)
+		if field, ok := fields[name]; ok {
+			if name != action.Name {
+				return nil, fmt.Errorf("%s: command name %q is already in use by action %s", field, name, action.Name)
+			}
+			continue
+		}
+		kept = append(kept, action)
+	}
+	actions = kept
+	if root {
+		// Aliases are only added unless properties are named the same
+		for i := range actions {
+			for _, alias := range rootAliases[actions[i].Name] {
+				if !names[alias] {
+					actions[i].Aliases = append(actions[i].Aliases, alias)
+				}
+			}
+		}
+	}
+	cmds = append(cmds, actions...)
+
+	return cmds, validateCommandNames(cmds)
 }
 
 func isPrimitiveKind(k reflect.Kind) bool {
-	return (reflect.Bool <= k && k <= reflect.Float64) || k == reflect.String
+	return (reflect.Bool <= k && k <= reflect.Complex128) || k == reflect.String
 }
 
 func isPrimitive(v reflect.Value) bool {
 	v = deref(v)
 
 	k := v.Kind()
-	if isPrimitiveKind(k) {
+	if isPrimitiveKind(k) || (k == reflect.Slice && v.Type() == hardwareAddrType) {
 		return true
 	}
 
@@ -481,23 +1884,68 @@ func isPrimitive(v reflect.Value) bool {
 	return false
 }
 
-func (c *constructor) getCommandsForValue(v reflect.Value) ([]cli.Command, error) {
+func isPrimitiveType(t reflect.Type) bool {
+	t = derefType(t)
+
+	if isPrimitiveKind(t.Kind()) || t == hardwareAddrType {
+		return true
+	}
+
+	pt := reflect.PtrTo(t)
+	return pt.Implements(textMarshaler) && pt.Implements(textUnmarshaler)
+}
+
+func (c *constructor) getCommandsForValue(v reflect.Value, field *reflect.StructField) ([]cli.Command, error) {
+	// Pointers to primitives are kept as is, so that nil pointers can be
+	// allocated when the value gets set.
+	if v.Kind() == reflect.Ptr && isPrimitiveType(v.Type()) {
+		return c.makePrimitiveCommands(v, field), nil
+	}
+
 	v = deref(v)
+	if !v.IsValid() {
+		// Nil pointers to containers have nothing to show until they are set
+		// through a parent, for example with set-json or apply.
+		return nil, nil
+	}
 	k := v.Kind()
 
 	switch {
+	case v.Type() == rawMessageType:
+		return c.makeRawMessageCommands(v), nil
+
 	case isPrimitive(v):
-		return c.makePrimitiveCommands(v), nil
+		return c.makePrimitiveCommands(v, field), nil
+
+	case k == reflect.Map && v.Type().Elem().Kind() == reflect.Interface:
+		return c.makeInterfaceMapCommands(v)
 
 	case k == reflect.Map:
 		return c.makeMapCommands(v), nil
 
 	case k == reflect.Struct && v.CanAddr() && v.Addr().CanInterface():
-		return c.Construct(v.Addr().Interface())
+		return c.makeStructCommands(v, false)
 
 	case k == reflect.Slice || k == reflect.Array:
 		return c.makeSliceCommands(v)
 	}
 
-	return nil, unsupportedKindErr(k)
+	return c.unsupportedKind(k)
+}
+
+// errSkipValue is returned for values Config.OnUnsupportedKind has no
+// commands for, whose fields are left out.
+var errSkipValue = errors.New("value skipped")
+
+// unsupportedKind returns the commands Config.OnUnsupportedKind returns for
+// the kind, or an error if it is not set.
+func (c *constructor) unsupportedKind(k reflect.Kind) ([]cli.Command, error) {
+	if c.cfg.OnUnsupportedKind == nil {
+		return nil, unsupportedKindErr(k)
+	}
+	cmds, err := c.cfg.OnUnsupportedKind(k)
+	if err == nil && cmds == nil {
+		return nil, errSkipValue
+	}
+	return cmds, err
 }
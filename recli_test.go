@@ -0,0 +1,4582 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func run(item interface{}, args ...string) ([]string, error) {
+	return runWithConfig(DefaultConfig, item, args...)
+}
+
+func runWithConfig(cfg Config, item interface{}, args ...string) ([]string, error) {
+	var output []string
+	cfg.ValuePrinter = func(value interface{}) {
+		output = append(output, fmt.Sprint(value))
+	}
+	cfg.KeyValuePrinter = func(key interface{}, value interface{}) {
+		output = append(output, fmt.Sprintf("%v=%v", key, value))
+	}
+
+	cmds, err := New(cfg).Construct(item)
+	if err != nil {
+		return nil, err
+	}
+
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = ioutil.Discard
+	err = app.Run(append([]string{"test"}, args...))
+	return output, err
+}
+
+type PointerStruct struct {
+	S *string
+	I *int
+	B *bool
+}
+
+func TestNilPointerPrimitives(t *testing.T) {
+	x := &PointerStruct{}
+
+	if out, err := run(x, "s", "get"); err != nil {
+		t.Fatal(err)
+	} else if len(out) != 1 || out[0] != "<nil>" {
+		t.Errorf("unexpected get output: %v", out)
+	}
+
+	// Invalid values don't allocate the pointers
+	cfg := DefaultConfig
+	cfg.PathCommands = true
+	for _, args := range [][]string{
+		{"i", "set", "x"},
+		{"set", "i", "x"},
+		{"set-pointer", "/I", "x"},
+	} {
+		if _, err := runWithConfig(cfg, x, args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+	if x.I != nil {
+		t.Errorf("I allocated: %v", *x.I)
+	}
+
+	for _, args := range [][]string{
+		{"s", "set", "foo"},
+		{"i", "set", "42"},
+		{"b", "set", "true"},
+	} {
+		if _, err := run(x, args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+
+	if x.S == nil || *x.S != "foo" {
+		t.Errorf("S not set")
+	}
+	if x.I == nil || *x.I != 42 {
+		t.Errorf("I not set")
+	}
+	if x.B == nil || !*x.B {
+		t.Errorf("B not set")
+	}
+
+	if out, err := run(x, "i", "get"); err != nil {
+		t.Fatal(err)
+	} else if len(out) != 1 || out[0] != "42" {
+		t.Errorf("unexpected get output: %v", out)
+	}
+}
+
+type Nested struct {
+	Name  string
+	Inner struct {
+		Port int
+	}
+}
+
+func TestStructGet(t *testing.T) {
+	x := &Nested{Name: "foo"}
+	x.Inner.Port = 8080
+
+	out, err := run(x, "inner", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "{\n  \"Port\": 8080\n}" {
+		t.Errorf("unexpected get output: %q", out)
+	}
+}
+
+type SetInner struct {
+	Port int
+}
+
+type SetStruct struct {
+	Name    string
+	Port    int `min:"1" max:"65535"`
+	Inner   *SetInner
+	Mode    string `enum:"fast,slow"`
+	Enabled bool
+}
+
+func TestStructSet(t *testing.T) {
+	x := &SetStruct{Name: "foo", Port: 80, Mode: "fast", Enabled: true}
+
+	cfg := DefaultConfig
+	cfg.StructSetCommand = true
+	if _, err := runWithConfig(cfg, x, "set", "-name=bar", "-port=8080"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "bar" || x.Port != 8080 {
+		t.Errorf("fields not set: %+v", x)
+	}
+	if x.Mode != "fast" || !x.Enabled {
+		t.Errorf("fields touched: %+v", x)
+	}
+
+	if _, err := runWithConfig(cfg, x, "set", "-name=baz", "-mode=medium"); err == nil {
+		t.Errorf("expected enum error")
+	}
+	if _, err := runWithConfig(cfg, x, "set", "-port=0"); err == nil {
+		t.Errorf("expected min error")
+	}
+	if _, err := runWithConfig(cfg, x, "set", "-inner-port=5", "-mode=medium"); err == nil {
+		t.Errorf("expected enum error")
+	}
+	if x.Name != "bar" || x.Port != 8080 || x.Mode != "fast" || x.Inner != nil {
+		t.Errorf("failed set modified the struct: %+v", x)
+	}
+
+	inner := &SetInner{Port: 1}
+	x.Inner = inner
+	if _, err := runWithConfig(cfg, x, "set", "-inner-port=5", "-mode=medium"); err == nil {
+		t.Errorf("expected enum error")
+	}
+	if inner.Port != 1 {
+		t.Errorf("failed set modified the nested struct: %+v", inner)
+	}
+
+	// The tags are checked by every way of setting the fields
+	cfg.PathCommands = true
+	for _, args := range [][]string{
+		{"mode", "set", "medium"},
+		{"port", "set", "0"},
+		{"set", "mode", "medium"},
+		{"set-pointer", "/Port", "70000"},
+	} {
+		if _, err := runWithConfig(cfg, x, args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+	if x.Port != 8080 || x.Mode != "fast" {
+		t.Errorf("failed set modified the struct: %+v", x)
+	}
+}
+
+type ComplexStruct struct {
+	Frequency complex128
+}
+
+func TestComplex(t *testing.T) {
+	x := &ComplexStruct{}
+
+	if _, err := run(x, "frequency", "set", "1.5+2i"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Frequency != complex(1.5, 2) {
+		t.Errorf("unexpected value: %v", x.Frequency)
+	}
+
+	out, err := run(x, "frequency", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "1.5+2i" {
+		t.Errorf("unexpected get output: %v", out)
+	}
+}
+
+type ShowItem struct {
+	ID   string `recli:"id"`
+	Port int
+}
+
+type ShowStruct struct {
+	Name    string
+	Secret  string `recli:"-"`
+	Tags    []string
+	Items   []ShowItem
+	Options map[string]int
+	Inner   struct {
+		Enabled bool
+	}
+}
+
+func TestShow(t *testing.T) {
+	x := &ShowStruct{
+		Name:    "foo",
+		Secret:  "hunter2",
+		Tags:    []string{"a", "b"},
+		Items:   []ShowItem{{"first", 1}, {"second", 2}},
+		Options: map[string]int{"z": 1, "a": 2},
+	}
+	x.Inner.Enabled = true
+
+	cfg := DefaultConfig
+	cfg.ShowCommand = true
+	out, err := runWithConfig(cfg, x, "show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"name=foo",
+		"tags=a,b",
+		"items.first.id=first",
+		"items.first.port=1",
+		"items.second.id=second",
+		"items.second.port=2",
+		"options.a=2",
+		"options.z=1",
+		"inner.enabled=true",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected show output: %v", out)
+	}
+}
+
+type JsonStruct struct {
+	Name    string
+	Port    int
+	Options map[string]string
+}
+
+func TestStructSetJson(t *testing.T) {
+	x := &JsonStruct{Name: "foo", Port: 80, Options: map[string]string{"a": "b"}}
+
+	if _, err := run(x, "set-json", "-merge", `{"Port": 8080, "Options": {"c": "d"}}`); err != nil {
+		t.Fatal(err)
+	}
+	expected := JsonStruct{Name: "foo", Port: 8080, Options: map[string]string{"a": "b", "c": "d"}}
+	if !reflect.DeepEqual(*x, expected) {
+		t.Errorf("unexpected merge result: %+v", x)
+	}
+
+	if _, err := run(x, "set-json", `{"Port": 9090}`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*x, JsonStruct{Port: 9090}) {
+		t.Errorf("unexpected replace result: %+v", x)
+	}
+
+	x.Options = map[string]string{"a": "b"}
+	if _, err := run(x, "set-json", "-merge", `{"Options": {"c": "d"}, "Port": "bad"}`); err == nil {
+		t.Errorf("expected error")
+	}
+	if !reflect.DeepEqual(*x, JsonStruct{Port: 9090, Options: map[string]string{"a": "b"}}) {
+		t.Errorf("malformed input modified the struct: %+v", x)
+	}
+
+	// Merging updates the value in place
+	options := x.Options
+	if _, err := run(x, "set-json", "-merge", `{"Options": {"c": "d"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if options["c"] != "d" {
+		t.Errorf("map replaced: %v", x.Options)
+	}
+}
+
+type ValidatedItem struct {
+	Name string
+}
+
+func (i *ValidatedItem) Validate() error {
+	if i.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+type ValidatedStruct struct {
+	Items []ValidatedItem
+}
+
+func TestSliceAddValidates(t *testing.T) {
+	x := &ValidatedStruct{}
+
+	if _, err := run(x, "items", "add", "-name="); err == nil {
+		t.Errorf("expected validation error")
+	}
+	if _, err := run(x, "items", "add-json", `{"Name": ""}`); err == nil {
+		t.Errorf("expected validation error")
+	}
+	if len(x.Items) != 0 {
+		t.Errorf("invalid items added: %v", x.Items)
+	}
+
+	if _, err := run(x, "items", "add", "-name=foo"); err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Items) != 1 {
+		t.Errorf("valid item not added: %v", x.Items)
+	}
+}
+
+type DefaultsInner struct {
+	Port      int   `default:"8080"`
+	Intervals []int `default:"10,20"`
+}
+
+type DefaultsStruct struct {
+	Name    string  `default:"foo"`
+	Address *string `default:"localhost"`
+	Inner   DefaultsInner
+}
+
+func TestResetDefaults(t *testing.T) {
+	x := &DefaultsStruct{Name: "bar"}
+	x.Inner.Intervals = []int{1}
+
+	out, err := run(x, "reset-defaults", "-keep-set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "bar" || x.Inner.Port != 8080 || !reflect.DeepEqual(x.Inner.Intervals, []int{1}) {
+		t.Errorf("unexpected result: %+v", x)
+	}
+	if x.Address == nil || *x.Address != "localhost" {
+		t.Errorf("pointer default not applied")
+	}
+	if len(out) != 1 || out[0] != "2 properties reset to defaults" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	address := x.Address
+	if _, err := run(x, "reset-defaults"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "foo" || !reflect.DeepEqual(x.Inner.Intervals, []int{10, 20}) {
+		t.Errorf("unexpected result: %+v", x)
+	}
+	if x.Address != address {
+		t.Errorf("pointer replaced")
+	}
+
+	if _, err := run(x, "inner", "reset-defaults"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type ZeroStruct struct {
+	Name  string
+	Inner struct {
+		Tags    []string
+		Options map[string]string
+	}
+}
+
+func TestZero(t *testing.T) {
+	x := &ZeroStruct{Name: "foo"}
+	x.Inner.Tags = []string{"a"}
+	x.Inner.Options = map[string]string{"a": "b"}
+
+	cfg := DefaultConfig
+	cfg.ZeroCommand = true
+	if _, err := runWithConfig(cfg, x, "inner", "zero"); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(x, "dump-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "Name": "foo",
+  "Inner": {
+    "Tags": null,
+    "Options": null
+  }
+}`
+	if len(out) != 1 || out[0] != expected {
+		t.Errorf("unexpected dump: %v", out)
+	}
+}
+
+type LockedStruct struct {
+	Lock  sync.Mutex
+	RLock *sync.RWMutex
+	Name  string
+}
+
+func TestSkipTypes(t *testing.T) {
+	x := &LockedStruct{RLock: new(sync.RWMutex)}
+
+	cmds, err := Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range cmds {
+		if cmd.Name == "lock" || cmd.Name == "r-lock" {
+			t.Errorf("unexpected command %s", cmd.Name)
+		}
+	}
+
+	cfg := DefaultConfig
+	cfg.SkipTypes = nil
+	cmds, err = New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmds[0].Name != "lock" {
+		t.Errorf("expected lock command without skip types")
+	}
+}
+
+type GetDefaultStruct struct {
+	Port    int `default:"0x10"`
+	Name    string
+	Address *string `default:"localhost"`
+}
+
+func TestGetDefault(t *testing.T) {
+	x := &GetDefaultStruct{Port: 80}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"port", "get", "-default"}, []string{"16"}},
+		{[]string{"name", "get", "-default"}, []string{"<no default>"}},
+		{[]string{"address", "get", "-default"}, []string{"localhost"}},
+		{[]string{"port", "get", "-both"}, []string{"current=80", "default=16"}},
+		{[]string{"address", "get", "-both"}, []string{"current=<nil>", "default=localhost"}},
+	} {
+		out, err := run(x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+}
+
+type ConditionalStruct struct {
+	Name string
+	Port int `default:"8080"`
+}
+
+func TestConditionalSet(t *testing.T) {
+	x := &ConditionalStruct{Port: 8080}
+
+	if _, err := run(x, "name", "set", "-if-unset", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(x, "port", "set", "-if-unset", "80"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "foo" || x.Port != 80 {
+		t.Errorf("unexpected result: %+v", x)
+	}
+
+	var condErr *ConditionError
+	if _, err := run(x, "name", "set", "-if-unset", "bar"); !errors.As(err, &condErr) {
+		t.Errorf("expected condition error, got %v", err)
+	}
+	if _, err := run(x, "port", "set", "-if-unset", "90"); !errors.As(err, &condErr) {
+		t.Errorf("expected condition error, got %v", err)
+	}
+
+	if _, err := run(x, "port", "set", "-if-equals", "0x50", "90"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(x, "name", "set", "-if-equals", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "bar" || x.Port != 90 {
+		t.Errorf("unexpected result: %+v", x)
+	}
+
+	if _, err := run(x, "port", "set", "-if-equals", "80", "100"); !errors.As(err, &condErr) {
+		t.Errorf("expected condition error, got %v", err)
+	}
+	if _, err := run(x, "name", "set", "-if-equals", "foo", "baz"); !errors.As(err, &condErr) {
+		t.Errorf("expected condition error, got %v", err)
+	}
+	if x.Name != "bar" || x.Port != 90 {
+		t.Errorf("failed condition modified the struct: %+v", x)
+	}
+}
+
+type MapSliceStruct struct {
+	Headers []map[string]string
+}
+
+func TestSliceOfMaps(t *testing.T) {
+	x := &MapSliceStruct{
+		Headers: []map[string]string{{"a": "b"}},
+	}
+
+	if _, err := run(x, "headers", "add-json", `{"c": "d"}`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(x, "headers", "0", "set", "e", "f"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(x, "headers", "1", "get", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "d" {
+		t.Errorf("unexpected get output: %v", out)
+	}
+
+	expected := []map[string]string{{"a": "b", "e": "f"}, {"c": "d"}}
+	if !reflect.DeepEqual(x.Headers, expected) {
+		t.Errorf("unexpected result: %v", x.Headers)
+	}
+}
+
+type NamedStruct struct {
+	ID    string `cli:"id"`
+	Items []struct {
+		HTTPPort int `cli:"port"`
+	}
+}
+
+func TestNameTag(t *testing.T) {
+	x := &NamedStruct{}
+
+	if _, err := run(x, "id", "set", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(x, "items", "add", "-port=80"); err != nil {
+		t.Fatal(err)
+	}
+	if x.ID != "foo" || len(x.Items) != 1 || x.Items[0].HTTPPort != 80 {
+		t.Errorf("unexpected result: %+v", x)
+	}
+}
+
+type PathsStruct struct {
+	Name    string
+	Hidden  string `recli:"-"`
+	Tags    []string
+	Devices []struct {
+		ID   string `recli:"id"`
+		Port *int
+	}
+	Env map[string]string
+}
+
+func TestPaths(t *testing.T) {
+	x := &PathsStruct{}
+
+	cfg := DefaultConfig
+	cfg.PathsCommand = true
+	out, err := runWithConfig(cfg, x, "paths")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"name",
+		"tags",
+		"devices.<key>.id",
+		"devices.<key>.port",
+		"env.<key>",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected paths: %v", out)
+	}
+
+	out, err = runWithConfig(cfg, x, "paths", "-types")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[1] != "tags=slice" || out[3] != "devices.<key>.port=int" {
+		t.Errorf("unexpected paths: %v", out)
+	}
+}
+
+type CollidingStruct struct {
+	Show string
+	List string
+}
+
+func TestNameCollision(t *testing.T) {
+	x := &CollidingStruct{}
+
+	// Fields take over the names of the actions by default
+	cfg := DefaultConfig
+	cfg.ShowCommand = true
+	cfg.ZeroCommand = true
+	cfg.StructSetCommand = true
+	cfg.PathCommands = true
+	cfg.SchemaCommand = true
+	cfg.FileCommands = true
+	if _, err := runWithConfig(cfg, x, "show", "set", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Show != "foo" {
+		t.Errorf("unexpected result: %+v", x)
+	}
+
+	for _, tc := range []struct {
+		item interface{}
+		args []string
+	}{
+		{&struct{ Zero int }{}, []string{"zero", "set", "1"}},
+		{&struct{ Apply bool }{}, []string{"apply", "set", "true"}},
+		{&struct{ Schema string }{}, []string{"schema", "set", "a"}},
+		{&struct{ Export string }{}, []string{"export", "set", "a"}},
+		{&struct{ Inner struct{ Set int } }{}, []string{"inner", "set", "set", "1"}},
+	} {
+		if _, err := runWithConfig(cfg, tc.item, tc.args...); err != nil {
+			t.Errorf("%T: %v", tc.item, err)
+		}
+	}
+
+	cfg.StrictCommandNames = true
+	if _, err := New(cfg).Construct(x); err == nil {
+		t.Errorf("expected collision error")
+	}
+
+	cfg.StrictCommandNames = false
+	cfg.OnNameCollision = func(fieldName, collidingName string) string {
+		return collidingName + "-field"
+	}
+	if _, err := runWithConfig(cfg, x, "show-field", "set", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithConfig(cfg, x, "list", "set", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Show != "foo" || x.List != "bar" {
+		t.Errorf("unexpected result: %+v", x)
+	}
+}
+
+func TestValidateCommandNames(t *testing.T) {
+	if err := validateCommandNames([]cli.Command{{Name: "a"}, {Name: "b"}}); err != nil {
+		t.Error(err)
+	}
+	if err := validateCommandNames([]cli.Command{{Name: "a"}, {Name: "b", Aliases: []string{"a"}}}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+type TreeStruct struct {
+	Name  string
+	Items []string
+}
+
+func TestTree(t *testing.T) {
+	x := &TreeStruct{Items: []string{"a"}}
+
+	cfg := DefaultConfig
+	cfg.TreeCommand = true
+
+	out, err := runWithConfig(cfg, x, "tree", "-depth=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[0] != "name [PROPERTIES]" || out[1] != "items [PROPERTIES]" || out[len(out)-1] != "tree [ACTIONS]" {
+		t.Errorf("unexpected tree: %v", out)
+	}
+
+	out, err = runWithConfig(cfg, x, "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"items [PROPERTIES]",
+		"  0 [ITEMS]",
+		"    get [ACTIONS]",
+		"    explain [ACTIONS]",
+		"    set [ACTIONS] [value]",
+		"    delete [ACTIONS]",
+		"  first [ITEMS] [command] (resolved when run)",
+		"  last [ITEMS] [command] (resolved when run)",
+		"  count [ACTIONS]",
+		"  dump-json [ACTIONS]",
+		"  list [ACTIONS]",
+		"  slice [ACTIONS] [--] [start] [end]",
+		"  add [ACTIONS] [value]",
+	}
+	joined := strings.Join(out, "\n")
+	if !strings.Contains(joined, strings.Join(expected, "\n")) {
+		t.Errorf("unexpected tree: %s", joined)
+	}
+}
+
+type CountStruct struct {
+	Items []string
+	Env   map[string]string
+}
+
+func TestCount(t *testing.T) {
+	x := &CountStruct{
+		Items: []string{"a", "b", "c"},
+		Env:   map[string]string{"a": "b"},
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"items", "count"}, "3"},
+		{[]string{"items", "length"}, "3"},
+		{[]string{"env", "count"}, "1"},
+		{[]string{"env", "length"}, "1"},
+	} {
+		out, err := run(x, tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 || out[0] != tc.expected {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+}
+
+type SchemaStruct struct {
+	Address  string `usage:"Listen address" default:"localhost"`
+	Mode     string `enum:"fast,slow"`
+	Skipped  string `recli:"-"`
+	Backends []struct {
+		Port int `min:"1" max:"65535"`
+	}
+	Env map[string]string
+}
+
+func TestSchema(t *testing.T) {
+	fields, err := Default.Schema(&SchemaStruct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []FieldSchema{
+		{Path: "address", Kind: "string", Type: "string", Settable: true, Usage: "Listen address", Default: "localhost"},
+		{Path: "mode", Kind: "string", Type: "string", Settable: true, Enum: []string{"fast", "slow"}},
+		{Path: "backends.<key>.port", Kind: "int", Type: "int", Settable: true, Min: "1", Max: "65535"},
+		{Path: "env.<key>", Kind: "string", Type: "string", Settable: true},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("unexpected schema: %+v", fields)
+	}
+
+	cfg := DefaultConfig
+	cfg.SchemaCommand = true
+	out, err := runWithConfig(cfg, &SchemaStruct{}, "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded []FieldSchema
+	if err := json.Unmarshal([]byte(out[0]), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("unexpected schema output: %s", out[0])
+	}
+}
+
+type SliceDumpStruct struct {
+	Items []struct {
+		Name string
+	}
+	Empty []int
+}
+
+func TestSliceDumpJson(t *testing.T) {
+	x := &SliceDumpStruct{}
+	x.Items = append(x.Items, struct{ Name string }{"foo"})
+
+	out, err := run(x, "items", "dump-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "[\n  {\n    \"Name\": \"foo\"\n  }\n]" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	out, err = run(x, "empty", "dump-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "[]" {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+type ExplainStruct struct {
+	Mode string `usage:"Operating mode" default:"fast" enum:"fast,slow"`
+}
+
+func TestExplain(t *testing.T) {
+	x := &ExplainStruct{Mode: "slow"}
+
+	out, err := run(x, "mode", "explain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"usage=Operating mode",
+		"default=fast",
+		"current=slow",
+		"type=string",
+		"allowed=fast, slow",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected output: %v", out)
+	}
+}
+
+type PathBackend struct {
+	Hostname string `recli:"id"`
+	Params   map[string]string
+}
+
+type PathStruct struct {
+	Name     string
+	Backends []PathBackend
+	Limits   map[string]int
+}
+
+func TestPathCommands(t *testing.T) {
+	x := &PathStruct{
+		Backends: []PathBackend{
+			{Hostname: "backend1.com", Params: map[string]string{"a": "b"}},
+		},
+	}
+
+	cfg := DefaultConfig
+	cfg.PathCommands = true
+
+	for _, args := range [][]string{
+		{"set", "name", "foo"},
+		{"set", "backends.backend1.com.params.a", "c"},
+		{"set", "backends.backend1.com.params.new", "d"},
+		{"set", "limits.cpu", "4"},
+	} {
+		if _, err := runWithConfig(cfg, x, args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+	expected := &PathStruct{
+		Name: "foo",
+		Backends: []PathBackend{
+			{Hostname: "backend1.com", Params: map[string]string{"a": "c", "new": "d"}},
+		},
+		Limits: map[string]int{"cpu": 4},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("unexpected result: %+v", x)
+	}
+
+	out, err := runWithConfig(cfg, x, "get", "backends.backend1.com.params.a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "c" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	// Without a path, get and set keep their original behaviour
+	out, err = runWithConfig(cfg, x, "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || !strings.HasPrefix(out[0], "{") {
+		t.Errorf("unexpected output: %v", out)
+	}
+	if _, err := runWithConfig(cfg, x, "set", "-name=bar"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "bar" {
+		t.Errorf("unexpected name: %s", x.Name)
+	}
+
+	_, err = runWithConfig(cfg, x, "get", "backends.backend2.com.params.a")
+	if err == nil || !strings.Contains(err.Error(), `backends.backend2: unknown path segment "backend2", expected one of: backend1.com`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type MapDumpStruct struct {
+	Names map[string]string
+	Ports map[int]bool
+}
+
+func TestMapDumpJson(t *testing.T) {
+	x := &MapDumpStruct{
+		Names: map[string]string{"a": "b"},
+		Ports: map[int]bool{80: true, 443: false},
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"names", "dump-json"}, "{\n  \"a\": \"b\"\n}"},
+		{[]string{"ports", "dump-json"}, "{\n  \"443\": false,\n  \"80\": true\n}"},
+	} {
+		out, err := run(x, tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 || out[0] != tc.expected {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+}
+
+type PointerItem struct {
+	Name string `json:"name"`
+}
+
+type PointerRoot struct {
+	Items  []PointerItem     `json:"items"`
+	Tags   []string          `json:"tags"`
+	Labels map[string]string `json:"labels"`
+}
+
+func TestJsonPointer(t *testing.T) {
+	x := &PointerRoot{
+		Items:  []PointerItem{{"foo"}},
+		Labels: map[string]string{"a/b": "c"},
+	}
+
+	cfg := DefaultConfig
+	cfg.PathCommands = true
+
+	for _, args := range [][]string{
+		{"set-pointer", "/items/0/name", "bar"},
+		{"set-pointer", "/tags/-", "first"},
+		{"set-pointer", "/labels/a~1b", "d"},
+		{"set-pointer", "/labels/e~0f", "g"},
+	} {
+		if _, err := runWithConfig(cfg, x, args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+	expected := &PointerRoot{
+		Items:  []PointerItem{{"bar"}},
+		Tags:   []string{"first"},
+		Labels: map[string]string{"a/b": "d", "e~f": "g"},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("unexpected result: %+v", x)
+	}
+
+	out, err := runWithConfig(cfg, x, "get-pointer", "/tags/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "first" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	_, err = runWithConfig(cfg, x, "get-pointer", "/items/5/name")
+	if err == nil || !strings.Contains(err.Error(), `token 1 ("5")`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := runWithConfig(cfg, x, "get-pointer", "items"); err == nil {
+		t.Errorf("expected error")
+	}
+
+	if _, err := runWithConfig(cfg, x, "pointer-set", "/labels/a~1b", "e"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runWithConfig(cfg, x, "pointer-get", "/labels/a~1b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "e" {
+		t.Errorf("unexpected output: %v", out)
+	}
+}
+
+type JsonGetStruct struct {
+	Name    string
+	Port    int
+	Enabled bool
+	Unset   *string
+}
+
+func TestGetJson(t *testing.T) {
+	x := &JsonGetStruct{Name: "hello", Port: 42, Enabled: true}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"name", "get", "-json"}, `"hello"`},
+		{[]string{"port", "get", "-json"}, `42`},
+		{[]string{"enabled", "get", "-json"}, `true`},
+		{[]string{"unset", "get", "-json"}, `null`},
+	} {
+		out, err := run(x, tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 || out[0] != tc.expected {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+}
+
+type ApplyStruct struct {
+	Name   string
+	Tags   []string
+	Labels map[string]string
+}
+
+func TestApply(t *testing.T) {
+	x := &ApplyStruct{Labels: map[string]string{"old": "value"}}
+
+	cfg := DefaultConfig
+	cfg.PathCommands = true
+
+	script := `
+# Comments and blank lines are skipped
+
+set name "hello world"
+add tags first
+set labels.new value
+unset labels.old
+`
+	if _, err := runWithConfig(cfg, x, "apply", "-dry-run", script); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, &ApplyStruct{Labels: map[string]string{"old": "value"}}) {
+		t.Errorf("dry run modified the struct: %+v", x)
+	}
+
+	if _, err := runWithConfig(cfg, x, "apply", script); err != nil {
+		t.Fatal(err)
+	}
+	expected := &ApplyStruct{
+		Name:   "hello world",
+		Tags:   []string{"first"},
+		Labels: map[string]string{"new": "value"},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("unexpected result: %+v", x)
+	}
+
+	_, err := runWithConfig(cfg, x, "apply", "set name foo\nset missing bar\nset name baz")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if x.Name != "foo" {
+		t.Errorf("operations before the failure not applied: %+v", x)
+	}
+
+	if _, err := runWithConfig(cfg, x, "apply", "set name bar\nbogus"); err == nil || x.Name != "foo" {
+		t.Errorf("expected parse error without changes, got %v", err)
+	}
+}
+
+type RawMessageStruct struct {
+	Name      string
+	Extension json.RawMessage
+}
+
+func TestRawMessage(t *testing.T) {
+	x := &RawMessageStruct{Extension: json.RawMessage(`{"a":1}`)}
+
+	out, err := run(x, "extension", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != `{"a":1}` {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	if _, err := run(x, "extension", "set", `[1, "two"]`); err != nil {
+		t.Fatal(err)
+	}
+	if string(x.Extension) != `[1, "two"]` {
+		t.Errorf("unexpected value: %s", x.Extension)
+	}
+
+	if _, err := run(x, "extension", "set", `{broken`); err == nil {
+		t.Error("expected error for invalid json")
+	}
+	if string(x.Extension) != `[1, "two"]` {
+		t.Errorf("value modified by invalid set: %s", x.Extension)
+	}
+
+	out, err = run(x, "dump-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dumped struct {
+		Extension []interface{}
+	}
+	if len(out) != 1 {
+		t.Fatalf("unexpected output: %v", out)
+	}
+	if err := json.Unmarshal([]byte(out[0]), &dumped); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dumped.Extension, []interface{}{1.0, "two"}) {
+		t.Errorf("raw json not embedded: %s", out[0])
+	}
+}
+
+type IPStruct struct {
+	Address net.IP
+	Peers   []net.IP
+}
+
+func TestNetIP(t *testing.T) {
+	x := &IPStruct{
+		Address: net.ParseIP("10.0.0.1"),
+		Peers:   []net.IP{net.ParseIP("192.168.0.1")},
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"address", "get"}, []string{"10.0.0.1"}},
+		{[]string{"peers", "0", "get"}, []string{"192.168.0.1"}},
+		{[]string{"peers", "count"}, []string{"1"}},
+	} {
+		out, err := run(x, tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+
+	if _, err := run(x, "address", "set", "::1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(x, "peers", "add", "172.16.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(x, "peers", "0", "set", "172.16.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	expected := &IPStruct{
+		Address: net.ParseIP("::1"),
+		Peers:   []net.IP{net.ParseIP("172.16.0.2"), net.ParseIP("172.16.0.1")},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("unexpected result: %v", x)
+	}
+
+	if _, err := run(x, "peers", "add", "not-an-ip"); err == nil {
+		t.Error("expected error for invalid ip")
+	}
+}
+
+type ExtraDumpStruct struct {
+	Name  string
+	Items []int
+	Env   map[string]string
+}
+
+func TestExtraDumpFormats(t *testing.T) {
+	x := &ExtraDumpStruct{
+		Name:  "foo",
+		Items: []int{1, 2},
+		Env:   map[string]string{"a": "b"},
+	}
+
+	cfg := DefaultConfig
+	cfg.ExtraDumpFormats = map[string]func(interface{}) ([]byte, error){
+		"compact": func(v interface{}) ([]byte, error) {
+			bytes, err := json.Marshal(v)
+			return append(bytes, '\n'), err
+		},
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"dump-compact"}, `{"Name":"foo","Items":[1,2],"Env":{"a":"b"}}`},
+		{[]string{"items", "dump-compact"}, `[1,2]`},
+		{[]string{"env", "dump-compact"}, `{"a":"b"}`},
+	} {
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 || out[0] != tc.expected {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+
+	cmds, err := Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range cmds {
+		if cmd.Name == "dump-compact" {
+			t.Error("unexpected dump-compact command without the config")
+		}
+	}
+}
+
+type HardwareAddrStruct struct {
+	MAC net.HardwareAddr
+}
+
+func TestHardwareAddr(t *testing.T) {
+	x := &HardwareAddrStruct{}
+
+	if _, err := run(x, "mac", "set", "aa:bb:cc:dd:ee:ff"); err != nil {
+		t.Fatal(err)
+	}
+	if x.MAC.String() != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("unexpected value: %v", x.MAC)
+	}
+
+	out, err := run(x, "mac", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	_, err = run(x, "mac", "set", "aa:bb:cc")
+	if err == nil || !strings.Contains(err.Error(), "invalid MAC address") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if x.MAC.String() != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("value modified by invalid set: %v", x.MAC)
+	}
+}
+
+type BigIntStruct struct {
+	Amount *big.Int
+}
+
+func TestBigInt(t *testing.T) {
+	x := &BigIntStruct{}
+
+	if _, err := run(x, "amount", "set", "12ab"); err == nil || x.Amount != nil {
+		t.Errorf("expected error without allocating, got %v, %v", err, x.Amount)
+	}
+
+	if _, err := run(x, "amount", "set", "123456789012345678901234567890"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Amount == nil || x.Amount.String() != "123456789012345678901234567890" {
+		t.Errorf("unexpected value: %v", x.Amount)
+	}
+
+	out, err := run(x, "amount", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "123456789012345678901234567890" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	if _, err := run(x, "amount", "set", "12ab"); err == nil {
+		t.Error("expected error for invalid number")
+	}
+}
+
+type EnvStruct struct {
+	Name       string
+	MaxThreads int
+	Hosts      []string
+	Env        map[string]string
+	Backends   map[string]struct {
+		Port int
+	}
+	Listen struct {
+		Address string
+	}
+}
+
+func TestDumpEnv(t *testing.T) {
+	x := &EnvStruct{
+		Name:  "it's",
+		Hosts: []string{"a", "b"},
+		Env:   map[string]string{"b": "2", "a": "1"},
+		Backends: map[string]struct {
+			Port int
+		}{"x": {1}},
+	}
+	x.Listen.Address = "localhost"
+
+	cfg := DefaultConfig
+	cfg.DumpEnvCommand = true
+	out, err := runWithConfig(cfg, x, "dump-env", "-prefix", "MYAPP_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`MYAPP_NAME='it'\''s'`,
+		`MYAPP_MAX_THREADS='0'`,
+		`MYAPP_HOSTS='a,b'`,
+		`MYAPP_ENV_A='1'`,
+		`MYAPP_ENV_B='2'`,
+		`MYAPP_LISTEN_ADDRESS='localhost'`,
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+type OutputStruct struct {
+	Name  string
+	Port  int
+	Items []string
+	Env   map[string]string
+}
+
+func TestJSONOutput(t *testing.T) {
+	x := &OutputStruct{
+		Name:  "foo \"bar\"",
+		Port:  80,
+		Items: []string{"a", "b"},
+		Env:   map[string]string{"a": "b"},
+	}
+
+	cfg := DefaultConfig
+	cfg.Output = OutputJSON
+	cfg.ShowCommand = true
+
+	for _, tc := range []struct {
+		args     []string
+		expected interface{}
+	}{
+		{[]string{"name", "get"}, x.Name},
+		{[]string{"port", "get"}, 80.0},
+		{[]string{"items", "list"}, []interface{}{"0", "1"}},
+		{[]string{"items", "count"}, 2.0},
+		{[]string{"env", "dump"}, map[string]interface{}{"a": "b"}},
+		{[]string{"port", "get", "--both"}, map[string]interface{}{"current": 80.0, "default": "<no default>"}},
+		{[]string{"show"}, map[string]interface{}{"name": x.Name, "port": 80.0, "items": "a,b", "env.a": "b"}},
+		{[]string{"items", "dump-json"}, []interface{}{"a", "b"}},
+	} {
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != 1 {
+			t.Errorf("%v: expected a single line: %v", tc.args, out)
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(out[0]), &value); err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+		}
+		if !reflect.DeepEqual(value, tc.expected) {
+			t.Errorf("%v: unexpected output: %v", tc.args, out[0])
+		}
+	}
+
+	// The default mode is unchanged
+	out, err := run(x, "items", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"0", "1"}) {
+		t.Errorf("unexpected output: %v", out)
+	}
+}
+
+type HostPort struct {
+	Host string
+	Port int
+}
+
+func (h *HostPort) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%s:%d", h.Host, h.Port)), nil
+}
+
+func (h *HostPort) UnmarshalText(data []byte) error {
+	parts := strings.Split(string(data), ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid host:port %q", data)
+	}
+	port, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return err
+	}
+	h.Host, h.Port = parts[0], port
+	return nil
+}
+
+type TextUnmarshalerItemStruct struct {
+	Backends []struct {
+		Address HostPort
+		Backup  *HostPort
+	}
+}
+
+func TestSliceItemTextUnmarshaler(t *testing.T) {
+	x := &TextUnmarshalerItemStruct{}
+
+	if _, err := run(x, "backends", "add", "--address", "a:80", "--backup", "b:81"); err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Backends) != 1 {
+		t.Fatalf("unexpected items: %v", x.Backends)
+	}
+	if x.Backends[0].Address != (HostPort{"a", 80}) {
+		t.Errorf("unexpected address: %v", x.Backends[0].Address)
+	}
+	if x.Backends[0].Backup == nil || *x.Backends[0].Backup != (HostPort{"b", 81}) {
+		t.Errorf("unexpected backup: %v", x.Backends[0].Backup)
+	}
+
+	out, err := run(x, "backends", "0", "address", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "a:80" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	if _, err := run(x, "backends", "add", "--address", "bad"); err == nil {
+		t.Error("expected error for invalid value")
+	}
+	if len(x.Backends) != 1 {
+		t.Errorf("invalid item added: %v", x.Backends)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestValueWriter(t *testing.T) {
+	x := &OutputStruct{
+		Name: "foo",
+		Env:  map[string]string{"a": "b"},
+	}
+
+	cfg := DefaultConfig
+	cfg.ShowCommand = true
+	cfg.ValueWriter = func(w io.Writer, value interface{}) error {
+		_, err := fmt.Fprintln(w, value)
+		return err
+	}
+	cfg.KeyValueWriter = func(w io.Writer, key, value interface{}) error {
+		_, err := fmt.Fprintf(w, "%v=%v\n", key, value)
+		return err
+	}
+
+	var buf bytes.Buffer
+	cfg.Writer = &buf
+	if _, err := runWithConfig(cfg, x, "name", "get"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithConfig(cfg, x, "env", "dump"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "foo\na=b\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	cfg.Writer = failingWriter{}
+	for _, args := range [][]string{
+		{"name", "get"},
+		{"env", "dump"},
+		{"dump-json"},
+		{"show"},
+	} {
+		if _, err := runWithConfig(cfg, x, args...); err == nil || err.Error() != "broken pipe" {
+			t.Errorf("%v: unexpected error: %v", args, err)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	x := &OutputStruct{
+		Name: "foo",
+		Env:  map[string]string{"a": "b"},
+	}
+
+	var buf bytes.Buffer
+	cfg := DefaultConfig
+	cfg.Writer = &buf
+
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = ioutil.Discard
+	for _, args := range [][]string{
+		{"name", "get"},
+		{"env", "dump"},
+		{"env", "dump-json"},
+	} {
+		if err := app.Run(append([]string{"test"}, args...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := "foo\na  =  b\n{\n  \"a\": \"b\"\n}\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+type ConcurrentStruct struct {
+	Counter int
+	Env     map[string]string
+}
+
+func TestMutex(t *testing.T) {
+	x := &ConcurrentStruct{Env: map[string]string{}}
+
+	cfg := DefaultConfig
+	cfg.Mutex = new(sync.RWMutex)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 10; i++ {
+		wg.Add(4)
+		go func(i int) {
+			defer wg.Done()
+			_, err := runWithConfig(cfg, x, "counter", "set", fmt.Sprint(i))
+			errs <- err
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := runWithConfig(cfg, x, "counter", "get")
+			errs <- err
+		}()
+		go func(i int) {
+			defer wg.Done()
+			_, err := runWithConfig(cfg, x, "env", "set", fmt.Sprint(i), "value")
+			errs <- err
+		}(i)
+		go func() {
+			defer wg.Done()
+			_, err := runWithConfig(cfg, x, "env", "dump-json")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if len(x.Env) != 10 {
+		t.Errorf("unexpected map: %v", x.Env)
+	}
+}
+
+type TableStruct struct {
+	Folders []struct {
+		Path   string
+		ID     string `recli:"id"`
+		Paused bool
+		Tags   []string
+		Size   int
+		Extra  string
+	}
+}
+
+func TestTable(t *testing.T) {
+	x := &TableStruct{}
+	if err := json.Unmarshal([]byte(`{"Folders": [
+		{"Path": "/a", "ID": "first", "Size": 10, "Tags": ["x"]},
+		{"Path": "/longer/path", "ID": "second", "Paused": true}
+	]}`), x); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(x, "folders", "table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"ID      PATH          PAUSED  SIZE",
+		"first   /a            false   10",
+		"second  /longer/path  true    0",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	out, err = run(x, "folders", "table", "--columns", "path,tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"PATH          TAGS",
+		`/a            ["x"]`,
+		"/longer/path  null",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	_, err = run(x, "folders", "table", "--columns", "path,bogus")
+	if err == nil || !strings.Contains(err.Error(), "expected one of: path, id, paused, tags, size, extra") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNoAccessibleFields(t *testing.T) {
+	for _, item := range []interface{}{
+		&struct{}{},
+		&struct {
+			a string
+			B string `recli:"-"`
+			sync.Mutex
+		}{},
+	} {
+		if _, err := Default.Construct(item); err == nil || err.Error() != "struct has no accessible fields" {
+			t.Errorf("%T: unexpected error: %v", item, err)
+		}
+	}
+}
+
+type SecretStruct struct {
+	Name     string
+	Key      string  `recli:"secret"`
+	Password *string `recli:"secret"`
+	Users    []struct {
+		Name  string `recli:"id"`
+		Token string `recli:"secret"`
+	}
+	Backends map[string]struct {
+		PIN int `recli:"secret"`
+	}
+}
+
+func TestSecret(t *testing.T) {
+	password := "hunter2"
+	x := &SecretStruct{
+		Name:     "foo",
+		Key:      "s3cret",
+		Password: &password,
+		Backends: map[string]struct {
+			PIN int `recli:"secret"`
+		}{"a": {1234}},
+	}
+	x.Users = append(x.Users, struct {
+		Name  string `recli:"id"`
+		Token string `recli:"secret"`
+	}{"bob", "token"})
+
+	out, err := run(x, "dump-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"s3cret", "hunter2", "token", "1234"} {
+		if strings.Contains(out[0], `"`+secret+`"`) || strings.Contains(out[0], secret+"\n") {
+			t.Errorf("secret %q in dump: %s", secret, out[0])
+		}
+	}
+	if !strings.Contains(out[0], `"Key": "<redacted>"`) || !strings.Contains(out[0], `"Token": "<redacted>"`) {
+		t.Errorf("secrets not redacted: %s", out[0])
+	}
+	if x.Key != "s3cret" || *x.Password != "hunter2" || x.Users[0].Token != "token" || x.Backends["a"].PIN != 1234 {
+		t.Errorf("original modified: %+v", x)
+	}
+
+	out, err = run(x, "dump-json", "--reveal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out[0], `"Key": "s3cret"`) || !strings.Contains(out[0], `"PIN": 1234`) {
+		t.Errorf("secrets not revealed: %s", out[0])
+	}
+
+	cfg := DefaultConfig
+	cfg.ShowCommand = true
+	out, err = runWithConfig(cfg, x, "show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"name=foo",
+		"key=<redacted>",
+		"password=<redacted>",
+		"users.bob.name=bob",
+		"users.bob.token=<redacted>",
+		"backends.a.pin=0",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	if _, err := run(x, "key", "get"); err == nil {
+		t.Error("expected get to require --reveal")
+	}
+	out, err = run(x, "key", "get", "--reveal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"s3cret"}) {
+		t.Errorf("unexpected output: %v", out)
+	}
+	out, err = run(x, "users", "bob", "token", "get", "--reveal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"token"}) {
+		t.Errorf("unexpected output: %v", out)
+	}
+}
+
+type DeviceID struct {
+	id string
+}
+
+func (d *DeviceID) MarshalText() ([]byte, error) {
+	if d.id == "" {
+		return nil, errors.New("empty device id")
+	}
+	return []byte(d.id), nil
+}
+
+func (d *DeviceID) UnmarshalText(data []byte) error {
+	d.id = string(data)
+	return nil
+}
+
+type InvalidKeyStruct struct {
+	Devices []struct {
+		ID   DeviceID `recli:"id"`
+		Name string
+	}
+}
+
+func TestSkipInvalidKeys(t *testing.T) {
+	x := &InvalidKeyStruct{}
+	x.Devices = make([]struct {
+		ID   DeviceID `recli:"id"`
+		Name string
+	}, 3)
+	x.Devices[0].ID.id = "first"
+	x.Devices[2].ID.id = "third"
+
+	if _, err := run(x, "devices", "list"); err == nil || !strings.Contains(err.Error(), "key of item 1: empty device id") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var logged []error
+	cfg := DefaultConfig
+	cfg.SkipInvalidKeys = true
+	cfg.ErrorLogger = func(err error) {
+		logged = append(logged, err)
+	}
+
+	out, err := runWithConfig(cfg, x, "devices", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"first", "third"}) {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	if _, err := runWithConfig(cfg, x, "devices", "third", "name", "set", "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Devices[2].Name != "foo" {
+		t.Errorf("unexpected items: %v", x.Devices)
+	}
+	if len(logged) == 0 {
+		t.Error("expected errors to be logged")
+	}
+}
+
+type ZeroIDStruct struct {
+	Items []struct {
+		Name  string `recli:"id"`
+		Value int
+	}
+	Numbered []struct {
+		ID    int `recli:"id"`
+		Value int
+	}
+}
+
+func TestZeroIDFallback(t *testing.T) {
+	x := &ZeroIDStruct{}
+	if err := json.Unmarshal([]byte(`{
+		"Items": [{"Name": "a"}, {"Name": ""}, {"Name": "1"}, {"Name": ""}],
+		"Numbered": [{"ID": 7}, {"ID": 0}]
+	}`), x); err != nil {
+		t.Fatal(err)
+	}
+
+	var logged []error
+	cfg := DefaultConfig
+	cfg.ErrorLogger = func(err error) {
+		logged = append(logged, err)
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"items", "list"}, []string{"a", "_index_1", "_index_2", "_index_3"}},
+		{[]string{"numbered", "list"}, []string{"7", "_index_1"}},
+	} {
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+	if len(logged) == 0 {
+		t.Error("expected warnings to be logged")
+	}
+
+	if _, err := runWithConfig(cfg, x, "items", "_index_3", "delete"); err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Items) != 3 || x.Items[1].Name != "" || x.Items[2].Name != "1" {
+		t.Errorf("wrong item deleted: %v", x.Items)
+	}
+}
+
+type OmitDefaultsStruct struct {
+	Address string `default:"localhost"`
+	Port    int    `default:"8080"`
+	Paused  bool
+	Hosts   []string `default:"a,b"`
+	Nested  struct {
+		Enabled bool   `default:"true"`
+		Name    string `default:"nested"`
+	}
+}
+
+func TestDumpJsonOmitDefaults(t *testing.T) {
+	x := &OmitDefaultsStruct{}
+	if err := SetDefaults("default", x); err != nil {
+		t.Fatal(err)
+	}
+	x.Port = 9090
+	x.Hosts = []string{"a"}
+	x.Nested.Name = "<changed>"
+
+	out, err := run(x, "dump-json", "--omit-defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dumped interface{}
+	if len(out) != 1 {
+		t.Fatalf("unexpected output: %v", out)
+	}
+	if err := json.Unmarshal([]byte(out[0]), &dumped); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"Port":   9090.0,
+		"Hosts":  []interface{}{"a"},
+		"Nested": map[string]interface{}{"Name": "<changed>"},
+	}
+	if !reflect.DeepEqual(dumped, expected) {
+		t.Errorf("unexpected output: %s", out[0])
+	}
+	if !strings.HasPrefix(out[0], "{\n  \"Port\": 9090,\n  \"Hosts\"") {
+		t.Errorf("field order not kept: %s", out[0])
+	}
+
+	out, err = run(x, "nested", "dump-json", "--omit-defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "{\n  \"Name\": \"<changed>\"\n}" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	if err := SetDefaults("default", x); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run(x, "dump-json", "--omit-defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "{}" {
+		t.Errorf("unexpected output: %v", out)
+	}
+}
+
+func TestSliceKeyFormat(t *testing.T) {
+	x := &CountStruct{
+		Items: []string{"a", "b", "c"},
+	}
+
+	cfg := DefaultConfig
+	cfg.SliceKeyFormat = "%03d"
+	cfg.SliceKeyBase = 1
+
+	out, err := runWithConfig(cfg, x, "items", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"001", "002", "003"}) {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	if _, err := runWithConfig(cfg, x, "items", "002", "set", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.Items, []string{"a", "x", "c"}) {
+		t.Errorf("unexpected items: %v", x.Items)
+	}
+
+	cfg.SliceKeyFormat = "%x"
+	cfg.SliceKeyBase = 0
+	x.Items = make([]string, 12)
+	out, err = runWithConfig(cfg, x, "items", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out[10] != "a" || out[11] != "b" {
+		t.Errorf("unexpected output: %v", out)
+	}
+}
+
+type LoadJsonStruct struct {
+	Name     string
+	Port     int
+	Hosts    []string
+	Env      map[string]string
+	Backends []struct {
+		Address string `recli:"id"`
+		Weight  float64
+	}
+}
+
+func (s *LoadJsonStruct) Validate() error {
+	if s.Port < 0 {
+		return errors.New("negative port")
+	}
+	return nil
+}
+
+func TestLoadJson(t *testing.T) {
+	x := &LoadJsonStruct{
+		Name:  "foo",
+		Port:  80,
+		Hosts: []string{"a", "b"},
+		Env:   map[string]string{"a": "b"},
+	}
+	x.Backends = append(x.Backends, struct {
+		Address string `recli:"id"`
+		Weight  float64
+	}{"backend", 0.5})
+
+	out, err := run(x, "dump-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	y := &LoadJsonStruct{Name: "other", Env: map[string]string{"c": "d"}}
+	if _, err := run(y, "load-json", out[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, y) {
+		t.Errorf("round trip mismatch: %+v != %+v", x, y)
+	}
+
+	for _, doc := range []string{`{"Name": "bar", "Port": -1}`, `{"Name": "bar", "Port": "x"}`} {
+		if _, err := run(y, "load-json", doc); err == nil {
+			t.Errorf("%s: expected error", doc)
+		}
+		if !reflect.DeepEqual(x, y) {
+			t.Errorf("%s: invalid document applied: %+v", doc, y)
+		}
+	}
+
+	if _, err := run(y, "load-json", "--validate-only", `{"Name": "bar"}`); err != nil {
+		t.Fatal(err)
+	}
+	if y.Name != "foo" {
+		t.Errorf("validate only applied the document: %+v", y)
+	}
+}
+
+type FirstLastStruct struct {
+	Names   []string
+	Servers []struct {
+		Address string
+		Port    int
+	}
+}
+
+func TestFirstLast(t *testing.T) {
+	x := &FirstLastStruct{Names: []string{"a", "b", "c"}}
+
+	cmds, err := Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = ioutil.Discard
+
+	// Grow the slice after the commands have been constructed
+	x.Names = append(x.Names, "d")
+	if err := app.Run([]string{"test", "names", "last", "set", "z"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run([]string{"test", "names", "first", "set", "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.Names, []string{"y", "b", "c", "z"}) {
+		t.Errorf("unexpected items: %v", x.Names)
+	}
+
+	if _, err := run(x, "servers", "first", "port", "get"); err == nil {
+		t.Error("expected error for empty slice")
+	}
+
+	if _, err := run(x, "servers", "add", "--address", "a", "--port", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(x, "servers", "add", "--address", "b", "--port", "2"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := run(x, "servers", "last", "address", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"b"}) {
+		t.Errorf("unexpected output: %v", out)
+	}
+	if _, err := run(x, "servers", "first", "port", "set", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Servers[0].Port != 10 {
+		t.Errorf("unexpected items: %v", x.Servers)
+	}
+}
+
+type MergeJsonStruct struct {
+	Name string
+	GUI  struct {
+		Theme   string `json:"theme"`
+		Enabled bool   `json:"enabled"`
+		Address *string
+	} `json:"gui"`
+	Hosts []string
+	Env   map[string]string
+}
+
+func TestMergeJson(t *testing.T) {
+	address := "localhost"
+	x := &MergeJsonStruct{
+		Name:  "foo",
+		Hosts: []string{"a", "b"},
+		Env:   map[string]string{"a": "1", "b": "2"},
+	}
+	x.GUI.Theme = "light"
+	x.GUI.Enabled = true
+	x.GUI.Address = &address
+
+	patch := `{"gui": {"theme": "dark", "Address": null}, "hosts": ["c"], "env": {"a": null, "c": "3"}}`
+	if _, err := run(x, "merge-json", patch); err != nil {
+		t.Fatal(err)
+	}
+
+	if x.Name != "foo" || x.GUI.Theme != "dark" || !x.GUI.Enabled || x.GUI.Address != nil {
+		t.Errorf("unexpected result: %+v", x)
+	}
+	if !reflect.DeepEqual(x.Hosts, []string{"c"}) {
+		t.Errorf("arrays not replaced: %v", x.Hosts)
+	}
+	if !reflect.DeepEqual(x.Env, map[string]string{"b": "2", "c": "3"}) {
+		t.Errorf("unexpected map: %v", x.Env)
+	}
+
+	if _, err := run(x, "gui", "merge-json", `{"enabled": null}`); err != nil {
+		t.Fatal(err)
+	}
+	if x.GUI.Enabled || x.GUI.Theme != "dark" {
+		t.Errorf("unexpected result: %+v", x.GUI)
+	}
+
+	// Values are patched in place
+	x.GUI.Address = &address
+	env := x.Env
+	if _, err := run(x, "merge-json", `{"gui": {"Address": "remote"}, "env": {"d": "4"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if x.GUI.Address != &address || address != "remote" || env["d"] != "4" {
+		t.Errorf("values replaced: %+v", x)
+	}
+	if _, err := run(x, "merge-json", `{"gui": {"Address": null}, "env": {"d": null}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, patch := range []string{`{"name": "bar", "bogus": 1}`, `{"name": "bar", "hosts": "x"}`} {
+		if _, err := run(x, "merge-json", patch); err == nil {
+			t.Errorf("%s: expected error", patch)
+		}
+		if x.Name != "foo" {
+			t.Errorf("%s: bad patch half applied: %+v", patch, x)
+		}
+	}
+
+	// The root command is also available as merge
+	if _, err := run(x, "merge", `{"gui": {"theme": "blue"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "foo" || x.GUI.Theme != "blue" || !reflect.DeepEqual(x.Hosts, []string{"c"}) {
+		t.Errorf("unexpected result: %+v", x)
+	}
+	// And as patch, with null deleting
+	if _, err := run(x, "patch", `{"env": {"b": null}, "gui": {"theme": null}}`); err != nil {
+		t.Fatal(err)
+	}
+	if x.GUI.Theme != "" || !reflect.DeepEqual(x.Env, map[string]string{"c": "3"}) {
+		t.Errorf("unexpected result: %+v", x)
+	}
+
+	cmds, err := Default.Construct(&struct{ Merge string }{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range cmds {
+		if cmd.Name == "merge-json" && !reflect.DeepEqual(cmd.Aliases, []string{"patch"}) {
+			t.Errorf("unexpected aliases: %v", cmd.Aliases)
+		}
+	}
+}
+
+func TestSubSlice(t *testing.T) {
+	x := &CountStruct{
+		Items: []string{"a", "b", "c", "d", "e"},
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"1", "3"}, []string{"b", "c"}},
+		{[]string{"3"}, []string{"d", "e"}},
+		{[]string{"--", "-2"}, []string{"d", "e"}},
+		{[]string{"0", "-1"}, []string{"a", "b", "c", "d"}},
+		{[]string{"--", "-10", "2"}, []string{"a", "b"}},
+		{[]string{"4", "100"}, []string{"e"}},
+		{[]string{"3", "1"}, []string{}},
+	} {
+		out, err := run(x, append([]string{"items", "slice"}, tc.args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var items []string
+		if len(out) != 1 {
+			t.Fatalf("%v: unexpected output: %v", tc.args, out)
+		}
+		if err := json.Unmarshal([]byte(out[0]), &items); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(items, tc.expected) {
+			t.Errorf("%v: unexpected items: %v", tc.args, items)
+		}
+	}
+
+	if _, err := run(x, "items", "slice", "x"); err == nil {
+		t.Error("expected error for invalid index")
+	}
+}
+
+type DiffDevice struct {
+	ID   string `recli:"id"`
+	Port int
+}
+
+type DiffStruct struct {
+	Name    string
+	Port    int
+	Devices []DiffDevice
+	Labels  map[string]string
+}
+
+func TestDiffJson(t *testing.T) {
+	x := &DiffStruct{
+		Name: "a",
+		Port: 1,
+		Devices: []DiffDevice{
+			{"x", 10},
+			{"y", 20},
+		},
+		Labels: map[string]string{"old": "1"},
+	}
+
+	same := `{"Name": "a", "Port": 1, "Devices": [{"ID": "y", "Port": 20}, {"ID": "x", "Port": 10}], "Labels": {"old": "1"}}`
+	out, err := run(x, "diff-json", same)
+	if err != nil || len(out) != 0 {
+		t.Errorf("unexpected differences: %v %v", out, err)
+	}
+
+	changed := `{"Name": "b", "Port": 1, "Devices": [{"ID": "y", "Port": 21}, {"ID": "z", "Port": 30}], "Labels": {"new": "2"}}`
+	out, err = run(x, "diff-json", changed)
+	if err == nil {
+		t.Error("expected error when there are differences")
+	}
+	expected := []string{
+		"name=a -> b",
+		"devices.x.id=x -> <none>",
+		"devices.x.port=10 -> <none>",
+		"devices.y.port=20 -> 21",
+		"labels.old=1 -> <none>",
+		"devices.z.id=<none> -> z",
+		"devices.z.port=<none> -> 30",
+		"labels.new=<none> -> 2",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected diff: %q", out)
+	}
+
+	// Nested levels diff against their own part of the document
+	out, err = run(x, "devices", "x", "diff-json", `{"ID": "x", "Port": 11}`)
+	if err == nil || !reflect.DeepEqual(out, []string{"port=10 -> 11"}) {
+		t.Errorf("unexpected item diff: %q %v", out, err)
+	}
+
+	cfg := DefaultConfig
+	cfg.Output = OutputJSON
+	out, err = runWithConfig(cfg, x, "diff-json", `{"Name": "a", "Port": 2, "Devices": [{"ID": "x", "Port": 10}, {"ID": "y", "Port": 20}], "Labels": {"old": "1"}}`)
+	if err == nil || !reflect.DeepEqual(out, []string{`{"port":{"old":1,"new":2}}`}) {
+		t.Errorf("unexpected json diff: %q %v", out, err)
+	}
+}
+
+func TestDumpOutputFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	x := &DiffStruct{Name: "a", Port: 1}
+	path := filepath.Join(dir, "out.json")
+
+	// Existing files are truncated
+	if err := ioutil.WriteFile(path, bytes.Repeat([]byte("x"), 1000), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := run(x, "dump-json", "-o", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || !strings.HasSuffix(out[0], path) {
+		t.Errorf("unexpected confirmation: %q", out)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y DiffStruct
+	if err := json.Unmarshal(data, &y); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*x, y) {
+		t.Errorf("unexpected contents: %s", data)
+	}
+
+	envPath := filepath.Join(dir, "out.env")
+	envCfg := DefaultConfig
+	envCfg.DumpEnvCommand = true
+	if _, err := runWithConfig(envCfg, x, "dump-env", "--output", envPath); err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "NAME='a'\nPORT='1'\n") {
+		t.Errorf("unexpected env contents: %q", data)
+	}
+	info, err := os.Stat(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected permissions: %v", info.Mode().Perm())
+	}
+
+	var buf bytes.Buffer
+	cfg := DefaultConfig
+	cfg.Writer = &buf
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = ioutil.Discard
+	if err := app.Run([]string{"test", "dump-json", "-o", "-"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "{\n  \"Name\": \"a\",") || !strings.HasSuffix(buf.String(), "}\n") {
+		t.Errorf("unexpected stdout: %q", buf.String())
+	}
+
+	missing := filepath.Join(dir, "missing", "out.json")
+	if _, err := run(x, "dump-json", "-o", missing); err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("expected error mentioning the path, got %v", err)
+	}
+}
+
+type PluginStruct struct {
+	Plugins map[string]interface{}
+}
+
+func TestInterfaceMap(t *testing.T) {
+	x := &PluginStruct{
+		Plugins: map[string]interface{}{
+			"auth":  map[string]interface{}{"enabled": true},
+			"cache": 10.0,
+		},
+	}
+
+	out, err := run(x, "plugins", "auth", "get-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(out, "") != "{\n  \"enabled\": true\n}" {
+		t.Errorf("unexpected value: %q", out)
+	}
+
+	if _, err := run(x, "plugins", "cache", "set-json", `{"size": 20}`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.Plugins["cache"], map[string]interface{}{"size": 20.0}) {
+		t.Errorf("unexpected cache: %#v", x.Plugins["cache"])
+	}
+	if _, err := run(x, "plugins", "cache", "set-json", `{`); err == nil {
+		t.Error("expected error for invalid json")
+	}
+
+	if _, err := run(x, "plugins", "set", "log", `["a", "b"]`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.Plugins["log"], []interface{}{"a", "b"}) {
+		t.Errorf("unexpected log: %#v", x.Plugins["log"])
+	}
+
+	out, err = run(x, "plugins", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(out)
+	expected := []string{`auth={"enabled":true}`, `cache={"size":20}`, `log=["a","b"]`}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("unexpected dump: %q", out)
+	}
+
+	cfg := DefaultConfig
+	cfg.ShowCommand = true
+	out, err = runWithConfig(cfg, x, "show")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{`plugins.auth={"enabled":true}`, `plugins.cache={"size":20}`, `plugins.log=["a","b"]`}) {
+		t.Errorf("unexpected show: %q", out)
+	}
+
+	if _, err := run(x, "plugins", "unset", "log"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := x.Plugins["log"]; ok {
+		t.Error("log not removed")
+	}
+}
+
+func TestMapSetJson(t *testing.T) {
+	var x struct {
+		Devices map[string]Device
+		Ports   map[string][]int
+		Limits  map[string]int
+	}
+
+	if _, err := run(&x, "devices", "set", "--json", "local", `{"Name": "local", "Port": 22}`); err != nil {
+		t.Fatal(err)
+	}
+	if x.Devices["local"] != (Device{"local", 22}) {
+		t.Errorf("unexpected devices: %v", x.Devices)
+	}
+
+	if _, err := run(&x, "ports", "set", "--json", "web", `[80, 443]`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.Ports["web"], []int{80, 443}) {
+		t.Errorf("unexpected ports: %v", x.Ports)
+	}
+
+	// Primitives parse the same either way
+	if _, err := run(&x, "limits", "set", "--json", "a", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(&x, "limits", "set", "b", "20"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Limits["a"] != 10 || x.Limits["b"] != 20 {
+		t.Errorf("unexpected limits: %v", x.Limits)
+	}
+
+	if _, err := run(&x, "devices", "set", "--json", "bad", `{"Port": "x"}`); err == nil {
+		t.Error("expected error for mismatched json")
+	}
+	if _, ok := x.Devices["bad"]; ok {
+		t.Error("bad value stored")
+	}
+	if _, err := run(&x, "devices", "set", "other", `{}`); err == nil {
+		t.Error("expected error without --json")
+	}
+}
+
+type ExportBackend struct {
+	Name string `recli:"id"`
+	Port int
+}
+
+type ExportNested struct {
+	Enabled bool `default:"true"`
+	Retries int  `default:"3"`
+}
+
+type ExportStruct struct {
+	Name     string `default:"server"`
+	Port     int    `default:"8080"`
+	Greeting string
+	Timeout  *int
+	Tags     []string `default:"a,b"`
+	Extra    []string
+	Backends []ExportBackend
+	Limits   map[string]int
+	Nested   ExportNested
+	Optional *ExportNested
+	Password string `recli:"secret"`
+	Hosts    map[string]ExportBackend
+}
+
+func TestExportScript(t *testing.T) {
+	timeout := 30
+	x := &ExportStruct{}
+	if err := SetDefaults("default", x); err != nil {
+		t.Fatal(err)
+	}
+	x.Name = "it's me"
+	x.Greeting = "hello world"
+	x.Timeout = &timeout
+	x.Tags = []string{"c"}
+	x.Extra = []string{"x y"}
+	x.Backends = []ExportBackend{{"a", 1}, {"b", 2}}
+	x.Limits = map[string]int{"cpu": 2, "mem": 512}
+	x.Nested.Retries = 5
+	x.Optional = &ExportNested{Enabled: false, Retries: 1}
+	x.Password = "hunter2"
+	x.Hosts = map[string]ExportBackend{"local": {"local", 22}}
+
+	cfg := DefaultConfig
+	cfg.ExportScriptCommand = true
+	cfg.PathCommands = true
+	out, err := runWithConfig(cfg, x, "export-script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile(filepath.Join("testdata", "export-script.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script := strings.Join(out, "\n") + "\n"; script != string(golden) {
+		t.Errorf("unexpected script:\n%s", script)
+	}
+
+	// Replaying the revealed script against the defaults recreates everything
+	out, err = runWithConfig(cfg, x, "export-script", "--reveal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	y := &ExportStruct{}
+	if err := SetDefaults("default", y); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithConfig(cfg, y, "apply", strings.Join(out, "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, y) {
+		t.Errorf("unexpected result of replaying:\n%#v\n%#v", x, y)
+	}
+
+	// Nothing to do for the defaults
+	z := &ExportStruct{}
+	if err := SetDefaults("default", z); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runWithConfig(cfg, z, "export-script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 0 {
+		t.Errorf("unexpected script for defaults: %q", out)
+	}
+}
+
+type FileInner struct {
+	Enabled bool
+	Ratio   float64 `json:"ratio"`
+}
+
+type FileStruct struct {
+	Name     string
+	Inner    FileInner
+	Backends []ExportBackend
+	Labels   map[string]string
+}
+
+func TestExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := DefaultConfig
+	cfg.FileCommands = true
+
+	x := &FileStruct{
+		Name:     "a",
+		Inner:    FileInner{true, 0.5},
+		Backends: []ExportBackend{{"b1", 1}, {"b2", 2}},
+		Labels:   map[string]string{"k": "v"},
+	}
+
+	path := filepath.Join(dir, "config.json")
+	if _, err := runWithConfig(cfg, x, "export", path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected permissions: %v", info.Mode().Perm())
+	}
+
+	y := &FileStruct{Name: "other"}
+	if _, err := runWithConfig(cfg, y, "import", path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, y) {
+		t.Errorf("unexpected round trip: %#v", y)
+	}
+
+	// Nested levels
+	innerPath := filepath.Join(dir, "inner.json")
+	if err := ioutil.WriteFile(innerPath, []byte(`{"Enabled": false, "ratio": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithConfig(cfg, x, "inner", "import", innerPath); err != nil {
+		t.Fatal(err)
+	}
+	if x.Inner != (FileInner{false, 2}) {
+		t.Errorf("unexpected inner: %v", x.Inner)
+	}
+
+	labelsPath := filepath.Join(dir, "labels.json")
+	if err := ioutil.WriteFile(labelsPath, []byte(`{"a": "b"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithConfig(cfg, x, "labels", "import", labelsPath); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.Labels, map[string]string{"a": "b"}) {
+		t.Errorf("unexpected labels: %v", x.Labels)
+	}
+
+	// Slices replace or append
+	backendsPath := filepath.Join(dir, "backends.json")
+	if err := ioutil.WriteFile(backendsPath, []byte(`[{"Name": "b3", "Port": 3}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithConfig(cfg, x, "backends", "import", "--append", backendsPath); err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Backends) != 3 || x.Backends[2] != (ExportBackend{"b3", 3}) {
+		t.Errorf("unexpected appended backends: %v", x.Backends)
+	}
+	if _, err := runWithConfig(cfg, x, "backends", "import", backendsPath); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.Backends, []ExportBackend{{"b3", 3}}) {
+		t.Errorf("unexpected replaced backends: %v", x.Backends)
+	}
+
+	// Bad files leave the value untouched
+	if err := ioutil.WriteFile(innerPath, []byte(`{"Enabled": [`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithConfig(cfg, x, "inner", "import", innerPath); err == nil {
+		t.Error("expected error for invalid json")
+	}
+	if x.Inner != (FileInner{false, 2}) {
+		t.Errorf("inner changed by a failed import: %v", x.Inner)
+	}
+
+	_, err = runWithConfig(cfg, x, "export", filepath.Join(dir, "config.toml"))
+	if err == nil || !strings.Contains(err.Error(), "expected one of: .json") {
+		t.Errorf("expected error listing the supported extensions, got %v", err)
+	}
+}
+
+type DocsStruct struct {
+	Name     string `usage:"Name of the server"`
+	Backends []ExportBackend
+	Labels   map[string]string
+}
+
+func TestGenerateMarkdown(t *testing.T) {
+	x := &DocsStruct{
+		Backends: []ExportBackend{{"first", 1}, {"second", 2}},
+	}
+
+	cfg := DefaultConfig
+	cfg.DocsCommand = true
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := GenerateMarkdown(cmds, &buf); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+
+	for _, expected := range []string{
+		"\n## `name`\n\nName of the server\n\nCategory: PROPERTIES\n\n```\nname [command]\n```\n",
+		"\n## `name set`\n",
+		"\n## `backends <key> port set`\n",
+		"\n## `backends add`\n\nAdd a new item to collection\n\nCategory: ACTIONS\n\n```\nbackends add [options] -attribute=value\n```\n\nOptions:\n\n- `--name`\n- `--port`\n",
+		"\n## `backends <key> delete`\n\nDelete item represented by key \"<key>\" from the collection\n",
+		"\n## `labels set`\n",
+		"- `--output, -o`: Write the dump to the file, or to stdout if -\n",
+		"\nCommands:\n\n- `get`: Get the value\n- `explain`: Describe the value\n- `set`: Set the value\n",
+		"\nCommands:\n\n- `<key>`\n- `last`: Access the last item\n",
+	} {
+		if !strings.Contains(doc, expected) {
+			t.Errorf("missing %q", expected)
+		}
+	}
+	for _, unexpected := range []string{"first", "second", "## `docs`"} {
+		if strings.Contains(doc, unexpected) {
+			t.Errorf("unexpected %q", unexpected)
+		}
+	}
+	if n := strings.Count(doc, "\n## `backends <key>`\n"); n != 1 {
+		t.Errorf("expected a single item section, got %d", n)
+	}
+
+	// Always the same
+	buf.Reset()
+	if err := GenerateMarkdown(cmds, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != doc {
+		t.Error("output differs between runs")
+	}
+
+	out, err := runWithConfig(cfg, x, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0]+"\n" != doc {
+		t.Errorf("unexpected docs command output: %q", out)
+	}
+
+	generated, err := New(cfg).GenerateMarkdown(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if generated != doc {
+		t.Errorf("unexpected generated docs: %q", generated)
+	}
+}
+
+type OutputFlagStruct struct {
+	Name  string
+	Items []string
+}
+
+func TestOutputFlag(t *testing.T) {
+	x := &OutputFlagStruct{
+		Name:  "a",
+		Items: []string{"b", "c"},
+	}
+
+	cfg := DefaultConfig
+	cfg.OutputFlag = true
+	cfg.ShowCommand = true
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"name", "get"}, []string{"a"}},
+		{[]string{"name", "get", "--output", "json"}, []string{`"a"`}},
+		{[]string{"name", "--output", "json", "get"}, []string{`"a"`}},
+		{[]string{"name", "--output", "json", "get", "--output", "text"}, []string{"a"}},
+		{[]string{"items", "list"}, []string{"0", "1"}},
+		{[]string{"items", "list", "--output=json"}, []string{`["0","1"]`}},
+		{[]string{"items", "last", "--output", "json", "get"}, []string{`"c"`}},
+	} {
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+
+	// Without the flag, the output is the same as with the option off
+	for _, args := range [][]string{{"show"}, {"dump-json"}, {"items", "count"}} {
+		with, err := runWithConfig(cfg, x, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain := cfg
+		plain.OutputFlag = false
+		without, err := runWithConfig(plain, x, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(with, without) {
+			t.Errorf("%v: output differs: %q != %q", args, with, without)
+		}
+	}
+
+	if _, err := runWithConfig(cfg, x, "name", "get", "--output", "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+
+	// The dump commands take --file instead, as --output selects the format
+	path := filepath.Join(t.TempDir(), "out.json")
+	if _, err := runWithConfig(cfg, x, "dump-json", "--file", path, "--output", "json"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || !strings.Contains(string(data), `"Name": "a"`) {
+		t.Errorf("unexpected file: %q %v", data, err)
+	}
+
+	// An application level flag is honoured too
+	var output []string
+	cfg.ValuePrinter = func(value interface{}) {
+		output = append(output, fmt.Sprint(value))
+	}
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{cli.StringFlag{Name: "output"}}
+	app.Commands = cmds
+	if err := app.Run([]string{"test", "--output", "json", "name", "get"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(output, []string{`"a"`}) {
+		t.Errorf("unexpected output: %q", output)
+	}
+}
+
+func TestBuildCommandTree(t *testing.T) {
+	x := &TreeStruct{Items: []string{"a"}}
+
+	tree, err := Default.BuildCommandTree(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds, err := Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var compare func(path string, trees []*CommandTree, cmds []cli.Command)
+	compare = func(path string, trees []*CommandTree, cmds []cli.Command) {
+		if len(trees) != len(cmds) {
+			t.Fatalf("%s: %d children, expected %d", path, len(trees), len(cmds))
+		}
+		for i, cmd := range cmds {
+			node := trees[i]
+			if node.Name != cmd.Name || node.Usage != cmd.Usage || node.Category != cmd.Category {
+				t.Errorf("%s: node %+v does not match command %s", path, node, cmd.Name)
+			}
+			compare(path+" "+cmd.Name, node.Children, cmd.Subcommands)
+		}
+	}
+	compare("", tree.Children, cmds)
+
+	var items *CommandTree
+	for _, child := range tree.Children {
+		if child.Name == "items" {
+			items = child
+		}
+	}
+	if items == nil || items.IsAction || items.Category != "PROPERTIES" {
+		t.Fatalf("unexpected items node: %+v", items)
+	}
+	for _, child := range items.Children {
+		switch child.Name {
+		case "0", "first", "last":
+			if child.IsAction {
+				t.Errorf("%s: unexpected action", child.Name)
+			}
+		case "add":
+			if !child.IsAction || child.ArgsUsage != "[value]" {
+				t.Errorf("unexpected add node: %+v", child)
+			}
+		}
+	}
+}
+
+type ColorStruct struct {
+	Name  string
+	Count int
+	Key   string `recli:"secret"`
+}
+
+func runColor(mode ColorMode, args ...string) (string, error) {
+	var buf bytes.Buffer
+	cfg := DefaultConfig
+	cfg.Color = mode
+	cfg.Writer = &buf
+	cfg.ShowCommand = true
+
+	x := &ColorStruct{Name: "a", Count: 1, Key: "s3cret"}
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		return "", err
+	}
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = ioutil.Discard
+	err = app.Run(append([]string{"test"}, args...))
+	return buf.String(), err
+}
+
+func TestColor(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"show"}, []string{colorize(colorKey, "name"), colorize(colorString, "a"), colorize(colorMarker, redactedValue)}},
+		{[]string{"dump-json"}, []string{colorize(colorKey, `"Name"`) + ": " + colorize(colorString, `"a"`), colorize(colorNumber, "1"), colorize(colorMarker, `"`+redactedValue+`"`)}},
+		{[]string{"name", "get"}, []string{"a\n"}},
+	} {
+		out, err := runColor(ColorAlways, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		for _, expected := range tc.expected {
+			if !strings.Contains(out, expected) {
+				t.Errorf("%v: %q not in output: %q", tc.args, expected, out)
+			}
+		}
+	}
+
+	// Never colorized when off or not writing to a terminal
+	for _, mode := range []ColorMode{ColorNever, ColorAuto} {
+		for _, args := range [][]string{{"show"}, {"dump-json"}, {"name", "get"}} {
+			out, err := runColor(mode, args...)
+			if err != nil {
+				t.Fatal(args, err)
+			}
+			if strings.Contains(out, "\x1b") {
+				t.Errorf("%v: escape codes in output: %q", args, out)
+			}
+		}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if isTerminal(w) || isTerminal(&bytes.Buffer{}) {
+		t.Error("not a terminal")
+	}
+}
+
+type MutationBackend struct {
+	Name string `recli:"id"`
+	Port int
+}
+
+type MutationStruct struct {
+	Name     string
+	Key      string `recli:"secret"`
+	Labels   map[string]string
+	Tags     []string
+	Backends []MutationBackend
+}
+
+func TestConfirmMutations(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.ConfirmMutations = true
+	cfg.PathCommands = true
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"name", "set", "b"}, []string{"set name = b"}},
+		{[]string{"key", "set", "hunter2"}, []string{"set key = <redacted>"}},
+		{[]string{"labels", "set", "env", "prod"}, []string{"set labels.env = prod"}},
+		{[]string{"labels", "unset", "a"}, []string{"unset labels.a"}},
+		{[]string{"tags", "add", "c"}, []string{"add tags"}},
+		{[]string{"backends", "add", "--name", "c", "--port", "3"}, []string{"add backends"}},
+		{[]string{"backends", "a", "port", "set", "10"}, []string{"set backends.a.port = 10"}},
+		{[]string{"backends", "a", "delete"}, []string{"delete backends.a"}},
+		{[]string{"backends", "last", "port", "set", "20"}, []string{"set backends.b.port = 20"}},
+		{[]string{"set", "backends.b.port", "30"}, []string{"set backends.b.port = 30"}},
+		{[]string{"apply", "set name c"}, []string{"apply"}},
+		{[]string{"apply", "--dry-run", "set name c"}, nil},
+		{[]string{"name", "get"}, []string{"a"}},
+		{[]string{"labels", "dump"}, []string{"a=b"}},
+	} {
+		x := &MutationStruct{
+			Name:     "a",
+			Labels:   map[string]string{"a": "b"},
+			Backends: []MutationBackend{{"a", 1}, {"b", 2}},
+		}
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+
+	// Off by default
+	x := &MutationStruct{}
+	if out, err := run(x, "name", "set", "b"); err != nil || len(out) != 0 {
+		t.Errorf("unexpected output: %q, %v", out, err)
+	}
+
+	// Failures are not confirmed
+	if out, err := runWithConfig(cfg, x, "backends", "add", "--port", "x"); err == nil || len(out) != 0 {
+		t.Errorf("unexpected output: %q, %v", out, err)
+	}
+
+	cfg.MutationMessage = func(op, path string, value interface{}) string {
+		return fmt.Sprintf("%s|%s|%v", op, path, value)
+	}
+	out, err := runWithConfig(cfg, x, "name", "set", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"set|name|b"}) {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestGenerateManPage(t *testing.T) {
+	x := &DocsStruct{
+		Backends: []ExportBackend{{"first", 1}, {"second", 2}},
+	}
+
+	cfg := DefaultConfig
+	cfg.DocsCommand = true
+	page, err := New(cfg).GenerateManPage(x, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(page, ".TH DOCS\\-STRUCT 8\n.SH NAME\ndocs\\-struct \\- ") {
+		t.Errorf("unexpected header: %q", page[:40])
+	}
+	last := 0
+	for _, section := range []string{"NAME", "SYNOPSIS", "DESCRIPTION", "COMMANDS", "OPTIONS", "EXAMPLES"} {
+		idx := strings.Index(page, "\n.SH "+section+"\n")
+		if idx < last {
+			t.Errorf("section %s missing or out of order", section)
+		}
+		last = idx
+	}
+	for _, expected := range []string{
+		".TP\n.B docs\\-struct name set [value]\nSet the value\n",
+		".TP\n.B docs\\-struct backends <key> delete\nDelete item represented by key \"<key>\" from the collection\n",
+		".SS backends add\n.TP\n.B \\-\\-name\n",
+		".SH EXAMPLES\n.PP\n.nf\ndocs\\-struct name get\ndocs\\-struct name set [value]\n.fi\n",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("missing %q", expected)
+		}
+	}
+	for _, unexpected := range []string{"first", "second", "docs\\-struct docs\n"} {
+		if strings.Contains(page, unexpected) {
+			t.Errorf("unexpected %q", unexpected)
+		}
+	}
+
+	if manEscape(`.a\b-c`) != `\&.a\eb\-c` {
+		t.Errorf("unexpected escape: %q", manEscape(`.a\b-c`))
+	}
+}
+
+type JSONTagStruct struct {
+	ListenAddress string `json:"listenAddr,omitempty"`
+	Untagged      int
+	OnlyOptions   bool   `json:",omitempty"`
+	Internal      string `json:"-"`
+	Named         string `json:"jsonName" cli:"cli-name"`
+	Nested        struct {
+		MaxConns int `json:"maxConnections"`
+	} `json:"nestedThing"`
+}
+
+func TestUseJSONTagNames(t *testing.T) {
+	x := &JSONTagStruct{ListenAddress: "a", Internal: "b"}
+
+	cfg := DefaultConfig
+	cfg.UseJSONTagNames = true
+	cfg.ShowCommand = true
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"listen-addr", "get"}, []string{"a"}},
+		{[]string{"untagged", "get"}, []string{"0"}},
+		{[]string{"only-options", "get"}, []string{"false"}},
+		{[]string{"cli-name", "get"}, []string{""}},
+		{[]string{"nested-thing", "max-connections", "get"}, []string{"0"}},
+		{[]string{"show"}, []string{"listen-addr=a", "untagged=0", "only-options=false", "cli-name=", "nested-thing.max-connections=0"}},
+	} {
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range cmds {
+		if cmd.Name == "internal" || cmd.Name == "listen-address" || cmd.Name == "json-name" {
+			t.Errorf("unexpected command %s", cmd.Name)
+		}
+	}
+
+	// Off by default
+	out, err := run(x, "internal", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"b"}) {
+		t.Errorf("unexpected output: %q", out)
+	}
+}
+
+func TestCommandPrefix(t *testing.T) {
+	x := &OutputFlagStruct{Name: "a", Items: []string{"b"}}
+
+	cfg := DefaultConfig
+	cfg.CommandPrefix = "device-"
+	cfg.TreeCommand = true
+	cfg.Mutex = new(sync.RWMutex)
+	cfg.ConfirmMutations = true
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range cmds {
+		if !strings.HasPrefix(cmd.Name, "device-") {
+			t.Errorf("unprefixed command %s", cmd.Name)
+		}
+		for _, subcmd := range cmd.Subcommands {
+			if strings.HasPrefix(subcmd.Name, "device-") {
+				t.Errorf("prefixed subcommand %s %s", cmd.Name, subcmd.Name)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"device-name", "get"}, []string{"a"}},
+		{[]string{"device-name", "set", "b"}, []string{"set name = b"}},
+		{[]string{"device-items", "last", "get"}, []string{"b"}},
+		{[]string{"device-dump-json"}, []string{"{\n  \"Name\": \"b\",\n  \"Items\": [\n    \"b\"\n  ]\n}"}},
+	} {
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+}
+
+func TestConstructApp(t *testing.T) {
+	x := &OutputFlagStruct{Name: "a", Items: []string{"b"}}
+
+	var out, errOut bytes.Buffer
+	cfg := DefaultConfig
+	cfg.Writer = &out
+	app, err := New(cfg).ConstructApp("prog", "Manage the thing", x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.ErrWriter = &errOut
+
+	if app.Name != "prog" || app.Usage != "Manage the thing" || app.Writer != &out {
+		t.Errorf("unexpected app: %+v", app)
+	}
+
+	if err := app.Run([]string{"prog", "name", "set", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run([]string{"prog", "items", "add", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Run([]string{"prog", "items", "list"}); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "b" || !reflect.DeepEqual(x.Items, []string{"b", "c"}) {
+		t.Errorf("unexpected value: %+v", x)
+	}
+	if out.String() != "0\n1\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	// Errors are returned
+	if err := app.Run([]string{"prog", "items", "add"}); err == nil {
+		t.Error("expected an error")
+	}
+
+	// Unknown commands do not exit, at any level
+	for _, args := range [][]string{{"prog", "nope"}, {"prog", "items", "nope"}} {
+		out.Reset()
+		errOut.Reset()
+		if err := app.Run(args); err != nil {
+			t.Fatal(args, err)
+		}
+		if errOut.String() != "unknown command \"nope\"\n\n" || !strings.Contains(out.String(), "USAGE:") {
+			t.Errorf("%v: unexpected output: %q, %q", args, errOut.String(), out.String())
+		}
+	}
+
+	// Same commands as Construct
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range cmds {
+		if app.Command(cmd.Name) == nil {
+			t.Errorf("missing command %s", cmd.Name)
+		}
+	}
+}
+
+func TestCollectionRoot(t *testing.T) {
+	folders := []MutationBackend{{"a", 1}}
+	for _, args := range [][]string{
+		{"add", "--name", "b", "--port", "2"},
+		{"add", "--name", "c", "--port", "3"},
+		{"a", "delete"},
+		{"b", "port", "set", "20"},
+	} {
+		if _, err := run(&folders, args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+	if !reflect.DeepEqual(folders, []MutationBackend{{"b", 20}, {"c", 3}}) {
+		t.Errorf("unexpected items: %v", folders)
+	}
+	out, err := run(&folders, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"b", "c"}) {
+		t.Errorf("unexpected output: %q", out)
+	}
+	out, err = run(&folders, "dump-json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || !strings.Contains(out[0], `"Name": "c"`) {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	var labels map[string]string
+	if _, err := run(&labels, "set", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run(&labels, "get", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []string{"b"}) {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	ptr := &folders
+	var nilFolders *[]MutationBackend
+	for _, item := range []interface{}{&ptr, nilFolders, nil, folders, new(int)} {
+		if _, err := Default.Construct(item); err == nil {
+			t.Errorf("%T: expected an error", item)
+		}
+	}
+}
+
+type PlaygroundStruct struct {
+	Name string `validate:"required"`
+	Port int    `validate:"min=1,max=65535"`
+}
+
+type fakeStructValidator struct {
+	calls int
+}
+
+func (v *fakeStructValidator) Struct(s interface{}) error {
+	v.calls++
+	if s.(*PlaygroundStruct).Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestStructValidator(t *testing.T) {
+	x := &PlaygroundStruct{Port: 80}
+
+	// No validate command unless configured
+	if cmds, err := Default.Construct(x); err != nil {
+		t.Fatal(err)
+	} else {
+		for _, cmd := range cmds {
+			if cmd.Name == "validate" {
+				t.Error("unexpected validate command")
+			}
+		}
+	}
+
+	validator := &fakeStructValidator{}
+	cfg := DefaultConfig
+	cfg.StructValidator = validator
+	if _, err := runWithConfig(cfg, x, "validate"); err == nil || err.Error() != "name is required" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	x.Name = "a"
+	if _, err := runWithConfig(cfg, x, "validate"); err != nil {
+		t.Error(err)
+	}
+	if validator.calls != 2 {
+		t.Errorf("validator called %d times", validator.calls)
+	}
+
+	cfg = DefaultConfig
+	cfg.UseGoPlaygroundValidator = true
+	if _, err := New(cfg).Construct(x); err == nil {
+		t.Error("expected an error without the playground package")
+	}
+}
+
+type EndToEndBackend struct {
+	Name    string `recli:"id"`
+	Address HostPort
+	Weight  *int
+}
+
+type EndToEndStruct struct {
+	Name   string
+	Listen struct {
+		Address HostPort
+		Backup  *HostPort
+	}
+	Tags     []string
+	Ports    []int
+	Labels   map[string]string
+	Limits   map[string]int
+	Timeout  *int
+	Backends []EndToEndBackend
+}
+
+func TestEndToEnd(t *testing.T) {
+	x := &EndToEndStruct{}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"name", "set", "proxy"}, nil},
+		{[]string{"name", "get"}, []string{"proxy"}},
+		{[]string{"listen", "address", "set", "0.0.0.0:80"}, nil},
+		{[]string{"listen", "address", "get"}, []string{"0.0.0.0:80"}},
+		{[]string{"listen", "backup", "get"}, []string{"<nil>"}},
+		{[]string{"listen", "backup", "set", "127.0.0.1:8080"}, nil},
+		{[]string{"listen", "backup", "get"}, []string{"127.0.0.1:8080"}},
+		{[]string{"tags", "add", "a"}, nil},
+		{[]string{"tags", "add", "b"}, nil},
+		{[]string{"tags", "0", "set", "c"}, nil},
+		{[]string{"tags", "list"}, []string{"0", "1"}},
+		{[]string{"tags", "1", "get"}, []string{"b"}},
+		{[]string{"ports", "add", "80"}, nil},
+		{[]string{"ports", "add", "443"}, nil},
+		{[]string{"ports", "0", "delete"}, nil},
+		{[]string{"ports", "count"}, []string{"1"}},
+		{[]string{"labels", "set", "env", "prod"}, nil},
+		{[]string{"labels", "set", "team", "infra"}, nil},
+		{[]string{"labels", "unset", "team"}, nil},
+		{[]string{"labels", "get", "env"}, []string{"prod"}},
+		{[]string{"limits", "set", "conns", "100"}, nil},
+		{[]string{"limits", "get", "conns"}, []string{"100"}},
+		{[]string{"limits", "dump"}, []string{"conns=100"}},
+		{[]string{"timeout", "set", "30"}, nil},
+		{[]string{"timeout", "get"}, []string{"30"}},
+		{[]string{"backends", "add", "--name", "a", "--address", "10.0.0.1:80"}, nil},
+		{[]string{"backends", "add", "--name", "b", "--address", "10.0.0.2:80"}, nil},
+		{[]string{"backends", "list"}, []string{"a", "b"}},
+		{[]string{"backends", "a", "weight", "set", "2"}, nil},
+		{[]string{"backends", "b", "address", "get"}, []string{"10.0.0.2:80"}},
+		{[]string{"backends", "b", "delete"}, nil},
+		{[]string{"backends", "count"}, []string{"1"}},
+	} {
+		out, err := run(x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+
+	two, thirty := 2, 30
+	expected := &EndToEndStruct{
+		Name:     "proxy",
+		Tags:     []string{"c", "b"},
+		Ports:    []int{443},
+		Labels:   map[string]string{"env": "prod"},
+		Limits:   map[string]int{"conns": 100},
+		Timeout:  &thirty,
+		Backends: []EndToEndBackend{{Name: "a", Address: HostPort{"10.0.0.1", 80}, Weight: &two}},
+	}
+	expected.Listen.Address = HostPort{"0.0.0.0", 80}
+	expected.Listen.Backup = &HostPort{"127.0.0.1", 8080}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("unexpected value: %+v", x)
+	}
+
+	for _, args := range [][]string{
+		{"listen", "address", "set", "nope"},
+		{"ports", "add", "x"},
+		{"limits", "set", "conns", "x"},
+		{"backends", "add", "--name", "c", "--address", "nope"},
+		{"backends", "a", "weight", "set", "x"},
+	} {
+		if _, err := run(x, args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("failed commands modified the value: %+v", x)
+	}
+}
+
+type mutation struct {
+	path               string
+	oldValue, newValue interface{}
+}
+
+func TestOnMutation(t *testing.T) {
+	x := &MutationStruct{
+		Name:     "a",
+		Labels:   map[string]string{"a": "b"},
+		Backends: []MutationBackend{{Name: "a", Port: 1}},
+	}
+
+	var mutations []mutation
+	cfg := DefaultConfig
+	cfg.OnMutation = func(path []string, oldValue, newValue interface{}) error {
+		mutations = append(mutations, mutation{strings.Join(path, "."), oldValue, newValue})
+		return nil
+	}
+	cfg.PathCommands = true
+
+	for _, tc := range []struct {
+		args     []string
+		expected []mutation
+	}{
+		{[]string{"name", "set", "b"}, []mutation{{"name", "a", "b"}}},
+		{[]string{"name", "get"}, nil},
+		{[]string{"labels", "set", "env", "prod"}, []mutation{{"labels.env", nil, "prod"}}},
+		{[]string{"labels", "unset", "a"}, []mutation{{"labels.a", "b", nil}}},
+		{[]string{"tags", "add", "c"}, []mutation{{"tags", []string(nil), []string{"c"}}}},
+		{[]string{"backends", "a", "port", "set", "2"}, []mutation{{"backends.a.port", 1, 2}}},
+		{[]string{"backends", "last", "port", "set", "3"}, []mutation{{"backends.a.port", 2, 3}}},
+		{[]string{"set", "backends.a.port", "4"}, []mutation{{"backends.a.port", 3, 4}}},
+		{[]string{"backends", "a", "delete"}, []mutation{{"backends.a", MutationBackend{"a", 4}, nil}}},
+		{[]string{"apply", "--dry-run", "set name c"}, nil},
+		{[]string{"load-json", `{"Name": "c"}`}, []mutation{{"", MutationStruct{
+			Name:     "b",
+			Labels:   map[string]string{"env": "prod"},
+			Tags:     []string{"c"},
+			Backends: []MutationBackend{},
+		}, MutationStruct{Name: "c"}}}},
+	} {
+		mutations = nil
+		if _, err := runWithConfig(cfg, x, tc.args...); err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(mutations, tc.expected) {
+			t.Errorf("%v: unexpected mutations: %#v", tc.args, mutations)
+		}
+	}
+
+	// Failing hooks roll the change back
+	x = &MutationStruct{Name: "a", Labels: map[string]string{"a": "b"}}
+	cfg.OnMutation = func([]string, interface{}, interface{}) error {
+		return errors.New("read only")
+	}
+	for _, args := range [][]string{
+		{"name", "set", "b"},
+		{"labels", "unset", "a"},
+		{"tags", "add", "c"},
+		{"load-json", `{"Name": "c"}`},
+	} {
+		if _, err := runWithConfig(cfg, x, args...); err == nil || err.Error() != "read only" {
+			t.Errorf("%v: unexpected error: %v", args, err)
+		}
+	}
+	if x.Name != "a" || !reflect.DeepEqual(x.Labels, map[string]string{"a": "b"}) || x.Tags != nil {
+		t.Errorf("changes not rolled back: %+v", x)
+	}
+}
+
+func TestWithAutoSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	x := &MutationStruct{Name: "a", Backends: []MutationBackend{{Name: "a", Port: 1}}}
+	path := filepath.Join(dir, "config.json")
+
+	cmds, err := Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runSaving := func(path string, args ...string) error {
+		app := cli.NewApp()
+		app.Commands = WithAutoSave(cmds, x, path)
+		app.Writer = ioutil.Discard
+		return app.Run(append([]string{"test"}, args...))
+	}
+	saved := func() *MutationStruct {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s MutationStruct
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatal(err)
+		}
+		return &s
+	}
+
+	if err := runSaving(path, "name", "set", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if s := saved(); !reflect.DeepEqual(s, x) || s.Name != "b" {
+		t.Errorf("unexpected file contents: %+v", s)
+	}
+	if err := runSaving(path, "backends", "last", "port", "set", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if s := saved(); s.Backends[0].Port != 2 {
+		t.Errorf("unexpected file contents: %+v", s)
+	}
+
+	// Reads leave the file alone
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"name", "get"},
+		{"dump-json"},
+		{"backends", "list"},
+		{"backends", "last", "port", "get"},
+	} {
+		if err := runSaving(path, args...); err != nil {
+			t.Fatal(args, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%v: file written", args)
+		}
+	}
+
+	// Failed actions don't write, failed writes fail the command
+	if err := runSaving(path, "backends", "a", "port", "set", "x"); err == nil {
+		t.Error("expected an error")
+	} else if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("file written")
+	}
+	if err := runSaving(filepath.Join(dir, "missing", "config.json"), "name", "set", "c"); err == nil {
+		t.Error("expected an error")
+	}
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Errorf("unexpected files left: %v %v", files, err)
+	}
+
+	// Renamed actions are told apart just the same
+	cfg := DefaultConfig
+	cfg.ActionNames = map[string]string{"get": "read", "set": "write"}
+	if cmds, err = New(cfg).Construct(x); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"name", "read"}, {"backends", "last", "port", "read"}} {
+		if err := runSaving(path, args...); err != nil {
+			t.Fatal(args, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%v: file written", args)
+		}
+	}
+	if err := runSaving(path, "name", "write", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if s := saved(); s.Name != "d" {
+		t.Errorf("unexpected file contents: %+v", s)
+	}
+}
+
+type InvariantFolder struct {
+	ID   string `recli:"id"`
+	Path string
+}
+
+type InvariantStruct struct {
+	MinInterval int
+	MaxInterval int
+	Folders     []InvariantFolder
+}
+
+func validateInvariants(root interface{}) error {
+	s := root.(*InvariantStruct)
+	if s.MinInterval > s.MaxInterval {
+		return errors.New("min interval above max interval")
+	}
+	paths := make(map[string]bool)
+	for _, folder := range s.Folders {
+		if paths[folder.Path] {
+			return fmt.Errorf("duplicate folder path %s", folder.Path)
+		}
+		paths[folder.Path] = true
+	}
+	return nil
+}
+
+func TestValidateMutations(t *testing.T) {
+	x := &InvariantStruct{
+		MinInterval: 1,
+		MaxInterval: 10,
+		Folders:     []InvariantFolder{{"a", "/a"}, {"b", "/b"}},
+	}
+	cfg := DefaultConfig
+	cfg.Validate = validateInvariants
+	cfg.ConfirmMutations = true
+
+	expected := *x
+	expected.Folders = append([]InvariantFolder(nil), x.Folders...)
+	for _, args := range [][]string{
+		{"min-interval", "set", "20"},
+		{"max-interval", "set", "0"},
+		{"folders", "b", "path", "set", "/a"},
+		{"folders", "last", "path", "set", "/a"},
+		{"folders", "add", "--id", "c", "--path", "/b"},
+		{"load-json", `{"MinInterval": 5, "MaxInterval": 4}`},
+	} {
+		out, err := runWithConfig(cfg, x, args...)
+		if err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+		if len(out) != 0 {
+			t.Errorf("%v: unexpected output: %v", args, out)
+		}
+		if !reflect.DeepEqual(*x, expected) {
+			t.Fatalf("%v: value not rolled back: %+v", args, x)
+		}
+	}
+
+	if out, err := runWithConfig(cfg, x, "folders", "b", "path", "set", "/c"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(out, []string{"set folders.b.path = /c"}) {
+		t.Errorf("unexpected output: %v", out)
+	}
+	if x.Folders[1].Path != "/c" {
+		t.Errorf("value not set: %+v", x)
+	}
+}
+
+type RollbackInner struct {
+	Port int
+}
+
+type RollbackStruct struct {
+	Name    string
+	Inner   *RollbackInner
+	Folders []InvariantFolder
+}
+
+func TestValidateRollbackInPlace(t *testing.T) {
+	inner := &RollbackInner{Port: 1}
+	x := &RollbackStruct{Name: "a", Inner: inner, Folders: []InvariantFolder{{"a", "/a"}, {"b", "/b"}}}
+	folder := &x.Folders[0]
+	cfg := DefaultConfig
+	cfg.Validate = func(root interface{}) error {
+		if s := root.(*RollbackStruct); s.Name == "bad" || len(s.Folders) < 2 {
+			return errors.New("invalid")
+		}
+		return nil
+	}
+
+	for _, args := range [][]string{
+		{"name", "set", "bad"},
+		{"folders", "a", "delete"},
+	} {
+		if _, err := runWithConfig(cfg, x, args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+	if _, err := runWithConfig(cfg, x, "inner", "port", "set", "7"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runWithConfig(cfg, x, "folders", "a", "path", "set", "/c"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "a" || x.Inner != inner || inner.Port != 7 || len(x.Folders) != 2 || x.Folders[1].ID != "b" {
+		t.Errorf("unexpected value: %+v", x)
+	}
+	if folder.Path != "/c" {
+		t.Errorf("slice detached: %+v", x.Folders)
+	}
+}
+
+type WalkNode struct {
+	Name     string
+	Parent   *WalkNode
+	Children []*WalkNode `recli:"-"`
+}
+
+type WalkStruct struct {
+	ListenAddress string
+	Timeout       *int
+	Tags          []string
+	Backends      []MutationBackend
+	Labels        map[string]string
+	Root          *WalkNode
+	Skipped       string `recli:"-"`
+}
+
+func TestWalk(t *testing.T) {
+	root := &WalkNode{Name: "root"}
+	child := &WalkNode{Name: "child", Parent: root}
+	root.Children = []*WalkNode{child}
+	x := &WalkStruct{
+		ListenAddress: "a",
+		Tags:          []string{"b"},
+		Backends:      []MutationBackend{{Name: "c", Port: 1}},
+		Labels:        map[string]string{"z": "1", "y": "2"},
+		Root:          child,
+	}
+	// A cycle back to a value being walked
+	root.Parent = child
+
+	var paths []string
+	err := Walk(x, func(path []string, v reflect.Value) error {
+		value, err := leafValue(v)
+		paths = append(paths, fmt.Sprintf("%s=%v", strings.Join(path, "."), value))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"listen-address=a",
+		"timeout=<nil>",
+		"tags=b",
+		"backends.c.name=c",
+		"backends.c.port=1",
+		"labels.y=2",
+		"labels.z=1",
+		"root.name=child",
+		"root.parent.name=root",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("unexpected paths: %v", paths)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := Walk(x, func([]string, reflect.Value) error {
+		calls++
+		return stop
+	}); err != stop || calls != 1 {
+		t.Errorf("walk not stopped: %v after %d calls", err, calls)
+	}
+}
+
+func TestWalkType(t *testing.T) {
+	var paths []string
+	err := WalkType(&WalkStruct{}, func(path []string, t reflect.Type, field *reflect.StructField) error {
+		name := "-"
+		if field != nil {
+			name = field.Name
+		}
+		paths = append(paths, fmt.Sprintf("%s=%s:%s", strings.Join(path, "."), t.Kind(), name))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"=struct:-",
+		"listen-address=string:ListenAddress",
+		"timeout=ptr:Timeout",
+		"tags=slice:Tags",
+		"backends=slice:Backends",
+		"backends.<key>=struct:Backends",
+		"backends.<key>.name=string:Name",
+		"backends.<key>.port=int:Port",
+		"labels=map:Labels",
+		"labels.<key>=string:Labels",
+		"root=struct:Root",
+		"root.name=string:Name",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("unexpected paths: %v", paths)
+	}
+
+	if err := WalkType(nil, nil); err == nil {
+		t.Error("expected an error for nil")
+	}
+}
+
+type FlattenStruct struct {
+	Name     string
+	Ratio    float32
+	Timeout  *int
+	Ports    []int
+	Extra    interface{}
+	Backends []MutationBackend
+	Labels   map[string]string
+	Inner    struct {
+		Address HostPort
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	timeout := 5
+	x := &FlattenStruct{
+		Name:     "a",
+		Ratio:    0.1,
+		Timeout:  &timeout,
+		Ports:    []int{1, 2},
+		Extra:    "b",
+		Backends: []MutationBackend{{Name: "c", Port: 3}},
+		Labels:   map[string]string{"d": "f"},
+	}
+	x.Inner.Address = HostPort{"g", 4}
+
+	values, err := Flatten(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":            "a",
+		"ratio":           float32(0.1),
+		"timeout":         int(5),
+		"ports":           []interface{}{int(1), int(2)},
+		"extra":           "b",
+		"backends.c.name": "c",
+		"backends.c.port": int(3),
+		"labels.d":        "f",
+		"inner.address":   "g:4",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected values: %#v", values)
+	}
+
+	y := &FlattenStruct{Backends: []MutationBackend{{Name: "c"}}}
+	if err := Unflatten(values, y); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x, y) {
+		t.Errorf("unflattened to %+v", y)
+	}
+
+	values = map[string]interface{}{
+		"timeout":    nil,
+		"ports":      []string{"7"},
+		"labels.new": 8,
+	}
+	labels := y.Labels
+	if err := Unflatten(values, y); err != nil {
+		t.Fatal(err)
+	}
+	if y.Timeout != nil || !reflect.DeepEqual(y.Ports, []int{7}) || y.Labels["new"] != "8" || y.Labels["d"] != "f" {
+		t.Errorf("unflattened to %+v", y)
+	}
+	if labels["new"] != "8" {
+		t.Errorf("map replaced: %v", labels)
+	}
+
+	for _, values := range []map[string]interface{}{
+		{"name": "b", "ratio": "x"},
+		{"name": "b", "backends.d.port": 1},
+		{"name": "b", "ports": 1},
+	} {
+		if err := Unflatten(values, y); err == nil {
+			t.Errorf("%v: expected an error", values)
+		}
+		if y.Name != "a" {
+			t.Fatalf("%v: value modified", values)
+		}
+	}
+}
+
+type UnsupportedStruct struct {
+	Name     string
+	Events   chan int
+	Callback func()
+	Queues   []chan int
+}
+
+func TestOnUnsupportedKind(t *testing.T) {
+	x := &UnsupportedStruct{Events: make(chan int, 3)}
+
+	if _, err := Default.Construct(x); err == nil {
+		t.Error("expected an error")
+	}
+
+	cfg := DefaultConfig
+	var kinds []reflect.Kind
+	cfg.OnUnsupportedKind = func(k reflect.Kind) ([]cli.Command, error) {
+		kinds = append(kinds, k)
+		return nil, nil
+	}
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmds[0].Name != "name" || cmds[1].Category != "ACTIONS" {
+		t.Errorf("unsupported fields not skipped: %s %s", cmds[0].Name, cmds[1].Name)
+	}
+	if !reflect.DeepEqual(kinds, []reflect.Kind{reflect.Chan, reflect.Func, reflect.Chan}) {
+		t.Errorf("unexpected kinds: %v", kinds)
+	}
+
+	cfg.OnUnsupportedKind = func(k reflect.Kind) ([]cli.Command, error) {
+		if k == reflect.Func {
+			return nil, errors.New("no functions")
+		}
+		return nil, nil
+	}
+	if _, err := New(cfg).Construct(x); err == nil || !strings.Contains(err.Error(), "no functions") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	length := -1
+	cfg.OnUnsupportedKind = func(k reflect.Kind) ([]cli.Command, error) {
+		if k != reflect.Chan {
+			return nil, nil
+		}
+		return []cli.Command{{
+			Name: "len",
+			Action: func(ctx *cli.Context) error {
+				length = len(x.Events)
+				return nil
+			},
+		}}, nil
+	}
+	x.Events <- 1
+	if _, err := runWithConfig(cfg, x, "events", "len"); err != nil {
+		t.Fatal(err)
+	}
+	if length != 1 {
+		t.Errorf("unexpected length: %d", length)
+	}
+}
+
+type HiddenBackend struct {
+	Name   string `recli:"id"`
+	Weight int    `recli:"hidden"`
+}
+
+type HiddenStruct struct {
+	Name     string
+	Debug    bool `recli:"hidden"`
+	Backends []HiddenBackend
+}
+
+func TestHiddenTag(t *testing.T) {
+	x := &HiddenStruct{}
+
+	cfg := DefaultConfig
+	cfg.StructSetCommand = true
+	help := func(args ...string) string {
+		cmds, err := New(cfg).Construct(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		app := cli.NewApp()
+		app.Commands = cmds
+		app.Writer = &buf
+		if err := app.Run(append([]string{"test"}, args...)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if out := help("help"); !strings.Contains(out, "name") || strings.Contains(out, "debug") {
+		t.Errorf("unexpected help: %s", out)
+	}
+	for _, args := range [][]string{{"backends", "help", "add"}, {"help", "set"}} {
+		if out := help(args...); strings.Contains(out, "weight") || strings.Contains(out, "debug") {
+			t.Errorf("%v: unexpected help: %s", args, out)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"debug", "set", "true"},
+		{"backends", "add", "--name", "a", "--weight", "3"},
+		{"set", "--debug"},
+	} {
+		if _, err := runWithConfig(cfg, x, args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+	if !x.Debug || len(x.Backends) != 1 || x.Backends[0].Weight != 3 {
+		t.Errorf("hidden fields not set: %+v", x)
+	}
+
+	if out, err := run(x, "dump-json"); err != nil {
+		t.Fatal(err)
+	} else if len(out) != 1 || !strings.Contains(out[0], `"Debug": true`) {
+		t.Errorf("hidden field missing from dump: %v", out)
+	}
+}
+
+func TestCommandDecorator(t *testing.T) {
+	x := &MutationStruct{Name: "a", Backends: []MutationBackend{{Name: "b", Port: 1}}}
+
+	var decorated, actions []string
+	cfg := DefaultConfig
+	cfg.CommandPrefix = "x-"
+	cfg.CommandDecorator = func(cmd *cli.Command) {
+		decorated = append(decorated, cmd.Name)
+		if action := cmd.Action; action != nil {
+			name := cmd.Name
+			cmd.Action = func(ctx *cli.Context) error {
+				actions = append(actions, name)
+				return cli.HandleAction(action, ctx)
+			}
+		}
+	}
+
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count func(cmds []cli.Command) int
+	count = func(cmds []cli.Command) int {
+		n := len(cmds)
+		for _, cmd := range cmds {
+			n += count(cmd.Subcommands)
+		}
+		return n
+	}
+	if len(decorated) != count(cmds) {
+		t.Errorf("decorated %d of %d commands", len(decorated), count(cmds))
+	}
+	if decorated[len(decorated)-1] != cmds[len(cmds)-1].Name || !strings.HasPrefix(decorated[len(decorated)-1], "x-") {
+		t.Errorf("root commands not decorated last, after prefixing: %v", decorated[len(decorated)-1])
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"x-name", "get"}, []string{"get"}},
+		{[]string{"x-backends", "last", "port", "get"}, []string{"last", "get"}},
+	} {
+		actions = nil
+		if out, err := runWithConfig(cfg, x, tc.args...); err != nil {
+			t.Fatal(err)
+		} else if len(out) != 1 {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+		if !reflect.DeepEqual(actions, tc.expected) {
+			t.Errorf("%v: unexpected actions: %v", tc.args, actions)
+		}
+	}
+}
+
+type UsageFlagItem struct {
+	Name      string   `recli:"id" usage:"Name of the device"`
+	Addresses []string `usage:"Listen addresses" default:"dynamic"`
+	Ports     []int    `usage:"Ports to use"`
+	Weight    float64  `default:"1.5"`
+	Paused    bool
+}
+
+type UsageFlagStruct struct {
+	Devices []UsageFlagItem
+}
+
+func TestBuilderFlagUsage(t *testing.T) {
+	x := &UsageFlagStruct{}
+
+	expected := map[string]string{
+		"name":      "Name of the device",
+		"addresses": "Listen addresses (default: dynamic)",
+		"ports":     "Ports to use",
+		"weight":    "default: 1.5",
+		"paused":    "",
+	}
+	for _, flags := range [][]cli.Flag{
+		Default.(*constructor).makeSliceItemBuilderFlags(reflect.TypeOf(UsageFlagItem{})),
+		Default.(*constructor).makeStructSetter(reflect.ValueOf(&UsageFlagItem{}).Elem()).Flags,
+	} {
+		if len(flags) != len(expected) {
+			t.Fatalf("unexpected flags: %v", flags)
+		}
+		for _, flag := range flags {
+			if usage := flagUsage(flag); usage != expected[flag.GetName()] {
+				t.Errorf("%s: unexpected usage %q", flag.GetName(), usage)
+			}
+		}
+	}
+
+	cmds, err := Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = &buf
+	if err := app.Run([]string{"test", "devices", "help", "add"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Listen addresses (default: dynamic)") {
+		t.Errorf("usage missing from help: %s", buf.String())
+	}
+}
+
+type NestedFlagsDevice struct {
+	Name    string `recli:"id"`
+	Address struct {
+		Host string `usage:"Host name"`
+		Port int    `max:"65535"`
+	}
+	TLS *struct {
+		CertFile string
+	}
+	Skipped struct {
+		Value string
+	} `recli:"-"`
+}
+
+type NestedFlagsStruct struct {
+	Devices []NestedFlagsDevice
+}
+
+func TestNestedBuilderFlags(t *testing.T) {
+	x := &NestedFlagsStruct{}
+
+	var names []string
+	for _, flag := range Default.(*constructor).makeSliceItemBuilderFlags(reflect.TypeOf(NestedFlagsDevice{})) {
+		names = append(names, flag.GetName())
+	}
+	if !reflect.DeepEqual(names, []string{"name", "address-host", "address-port", "tls-cert-file"}) {
+		t.Errorf("unexpected flags: %v", names)
+	}
+
+	for _, args := range [][]string{
+		{"devices", "add", "--name", "a", "--address-host", "localhost", "--address-port", "80"},
+		{"devices", "add", "--name", "b", "--tls-cert-file", "cert.pem"},
+	} {
+		if _, err := run(x, args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+	if _, err := run(x, "devices", "add", "--name", "c", "--address-port", "65536"); err == nil {
+		t.Error("expected an error")
+	}
+
+	if len(x.Devices) != 2 {
+		t.Fatalf("unexpected devices: %+v", x.Devices)
+	}
+	a, b := x.Devices[0], x.Devices[1]
+	if a.Address.Host != "localhost" || a.Address.Port != 80 || a.TLS != nil {
+		t.Errorf("unexpected device: %+v", a)
+	}
+	if b.Address.Host != "" || b.TLS == nil || b.TLS.CertFile != "cert.pem" {
+		t.Errorf("unexpected device: %+v", b)
+	}
+}
+
+type DeprecatedDevice struct {
+	Name string `recli:"id"`
+	Old  int    `usage:"Old setting" recli:"deprecated"`
+}
+
+type DeprecatedStruct struct {
+	Name     string
+	OldName  string `recli:"deprecated=use name, or alias, instead"`
+	Devices  []DeprecatedDevice
+	Settings struct {
+		Port int
+	} `recli:"deprecated"`
+}
+
+func TestDeprecatedTag(t *testing.T) {
+	x := &DeprecatedStruct{}
+
+	var warnings []string
+	cfg := DefaultConfig
+	cfg.WarningPrinter = func(msg string) {
+		warnings = append(warnings, msg)
+	}
+
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmds[1].Usage != "(deprecated: use name, or alias, instead)" || cmds[3].Usage != "(deprecated)" {
+		t.Errorf("unexpected usages: %q %q", cmds[1].Usage, cmds[3].Usage)
+	}
+	for _, flag := range Default.(*constructor).makeSliceItemBuilderFlags(reflect.TypeOf(DeprecatedDevice{})) {
+		if flag.GetName() == "old" && flagUsage(flag) != "Old setting (deprecated)" {
+			t.Errorf("unexpected flag usage: %q", flagUsage(flag))
+		}
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"old-name", "set", "a"}, []string{"old-name is deprecated: use name, or alias, instead"}},
+		{[]string{"old-name", "get"}, []string{"old-name is deprecated: use name, or alias, instead"}},
+		{[]string{"settings", "port", "set", "1"}, []string{"settings is deprecated"}},
+		{[]string{"devices", "add", "--name", "a", "--old", "1"}, []string{"old is deprecated"}},
+		{[]string{"devices", "add", "--name", "b"}, nil},
+		{[]string{"name", "set", "b"}, nil},
+	} {
+		warnings = nil
+		if _, err := runWithConfig(cfg, x, tc.args...); err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(warnings, tc.expected) {
+			t.Errorf("%v: unexpected warnings: %q", tc.args, warnings)
+		}
+	}
+	if x.OldName != "a" || x.Settings.Port != 1 || x.Devices[0].Old != 1 {
+		t.Errorf("deprecated fields not set: %+v", x)
+	}
+
+	// Warnings go to the ErrWriter by default
+	cmds, err = Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = ioutil.Discard
+	app.ErrWriter = &buf
+	if err := app.Run([]string{"test", "old-name", "set", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "warning: old-name is deprecated: use name, or alias, instead\n" {
+		t.Errorf("unexpected warning: %q", buf.String())
+	}
+}
+
+func TestConstructFlat(t *testing.T) {
+	x := &MutationStruct{Name: "a", Backends: []MutationBackend{{Name: "b", Port: 1}}}
+
+	runFlat := func(cfg Config, args ...string) []string {
+		var output []string
+		cfg.ValuePrinter = func(value interface{}) {
+			output = append(output, fmt.Sprint(value))
+		}
+		cmds, err := New(cfg).ConstructFlat(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cmd := range cmds {
+			if len(cmd.Subcommands) != 0 {
+				t.Errorf("%s has subcommands", cmd.Name)
+			}
+		}
+		app := cli.NewApp()
+		app.Commands = cmds
+		app.Writer = ioutil.Discard
+		if err := app.Run(append([]string{"test"}, args...)); err != nil {
+			t.Fatal(args, err)
+		}
+		return output
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"name.set", "b"}, nil},
+		{[]string{"name.get"}, []string{"b"}},
+		{[]string{"backends.b.port.set", "2"}, nil},
+		{[]string{"backends.last", "port", "get"}, []string{"2"}},
+		{[]string{"labels.set", "c", "d"}, nil},
+		{[]string{"backends.count"}, []string{"1"}},
+		{[]string{"merge", `{"Name": "c"}`}, nil},
+	} {
+		if out := runFlat(DefaultConfig, tc.args...); !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+	if x.Name != "c" || x.Backends[0].Port != 2 || x.Labels["c"] != "d" {
+		t.Errorf("unexpected value: %+v", x)
+	}
+
+	cfg := DefaultConfig
+	cfg.FlatSeparator = "/"
+	if out := runFlat(cfg, "backends/b/port/get"); !reflect.DeepEqual(out, []string{"2"}) {
+		t.Errorf("unexpected output: %v", out)
+	}
+}
+
+func TestConstructHTTP(t *testing.T) {
+	x := &MutationStruct{
+		Name:     "a",
+		Key:      "hunter2",
+		Labels:   map[string]string{"env": "prod"},
+		Backends: []MutationBackend{{Name: "b", Port: 1}},
+	}
+
+	mux := http.NewServeMux()
+	if err := Default.ConstructHTTP(x, mux); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path, body string) (int, string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		status             int
+		expected           string
+	}{
+		{"GET", "/name", "", 200, "\"a\"\n"},
+		{"PUT", "/name", `"c"`, 204, ""},
+		{"GET", "/name", "", 200, "\"c\"\n"},
+		{"GET", "/key", "", 403, "key: value is secret\n"},
+		{"GET", "/backends/b/port", "", 200, "1\n"},
+		{"PUT", "/backends/b/port", `2`, 204, ""},
+		{"POST", "/backends/", `{"Name": "d", "Port": 3}`, 201, "\"d\"\n"},
+		{"GET", "/backends/", "", 200, "[\n  {\n    \"Name\": \"b\",\n    \"Port\": 2\n  },\n  {\n    \"Name\": \"d\",\n    \"Port\": 3\n  }\n]\n"},
+		{"DELETE", "/backends/b", "", 204, ""},
+		{"DELETE", "/backends/b", "", 404, "backends/b: no such key\n"},
+		{"PUT", "/labels/team", `"infra"`, 204, ""},
+		{"GET", "/labels/team", "", 200, "\"infra\"\n"},
+		{"DELETE", "/labels/env", "", 204, ""},
+		{"GET", "/labels/env", "", 404, "labels/env: no such key\n"},
+		{"POST", "/tags", `"x"`, 201, "\"0\"\n"},
+		{"PUT", "/backends/d/port", `"x"`, 400, ""},
+		{"POST", "/name", `"x"`, 405, "name: not a slice\n"},
+		{"DELETE", "/name", "", 405, "name: not a slice item or map entry\n"},
+		{"PATCH", "/name", "", 405, "method PATCH not allowed\n"},
+		{"GET", "/missing", "", 404, ""},
+	} {
+		status, body := do(tc.method, tc.path, tc.body)
+		if status != tc.status || (tc.expected != "" || status < 400) && body != tc.expected {
+			t.Errorf("%s %s: unexpected response %d %q", tc.method, tc.path, status, body)
+		}
+	}
+
+	expected := &MutationStruct{
+		Name:     "c",
+		Key:      "hunter2",
+		Labels:   map[string]string{"team": "infra"},
+		Tags:     []string{"x"},
+		Backends: []MutationBackend{{Name: "d", Port: 3}},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("unexpected value: %+v", x)
+	}
+
+	if status, body := do("GET", "/", ""); status != 200 || !strings.Contains(body, `"Key": "<redacted>"`) {
+		t.Errorf("secret not redacted: %d %s", status, body)
+	}
+
+	// Validation rolls back
+	cfg := DefaultConfig
+	cfg.Validate = func(root interface{}) error {
+		if root.(*MutationStruct).Name == "" {
+			return errors.New("name is required")
+		}
+		return nil
+	}
+	mux = http.NewServeMux()
+	if err := New(cfg).ConstructHTTP(x, mux); err != nil {
+		t.Fatal(err)
+	}
+	if status, body := do("PUT", "/name", `""`); status != 400 || body != "name is required\n" || x.Name != "c" {
+		t.Errorf("unexpected response %d %q, name %q", status, body, x.Name)
+	}
+}
+
+func TestActionNames(t *testing.T) {
+	x := &MutationStruct{Name: "a", Backends: []MutationBackend{{Name: "b", Port: 1}}}
+
+	cfg := DefaultConfig
+	cfg.ShowCommand = true
+	cfg.ActionNames = map[string]string{"get": "show", "show": "view", "delete": "remove"}
+
+	cmds, err := New(cfg).Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range cmds {
+		if cmd.Name == "name" {
+			var names []string
+			for _, sub := range cmd.Subcommands {
+				names = append(names, sub.Name)
+			}
+			if !reflect.DeepEqual(names, []string{"show", "explain", "set"}) {
+				t.Errorf("unexpected name commands: %v", names)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"name", "show"}, []string{"a"}},
+		{[]string{"labels", "set", "k", "v"}, nil},
+		{[]string{"labels", "show", "k"}, []string{"v"}},
+		{[]string{"backends", "last", "port", "show"}, []string{"1"}},
+		{[]string{"backends", "b", "remove"}, nil},
+		{[]string{"backends", "count"}, []string{"0"}},
+	} {
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+
+	for _, names := range []map[string]string{
+		// Collides with the show action of structs
+		{"get": "show"},
+		// Collides with the name field
+		{"get": "name"},
+		{"get": ""},
+	} {
+		cfg.ActionNames = names
+		if _, err := New(cfg).Construct(x); err == nil {
+			t.Errorf("%v: expected an error", names)
+		}
+	}
+}
+
+type NameOverrideBackend struct {
+	Name     string `recli:"id"`
+	MaxConns int    `cli:"conns"`
+}
+
+type NameOverrideStruct struct {
+	GUIEnabled bool `cli:"gui-enabled"`
+	Backends   []NameOverrideBackend
+}
+
+type NameOverrideConflict struct {
+	Address string `cli:"addr"`
+	Addr    string
+}
+
+type NameOverrideSliceConflict struct {
+	Items []NameOverrideConflict
+}
+
+func TestNameOverrideTag(t *testing.T) {
+	x := &NameOverrideStruct{}
+
+	cfg := DefaultConfig
+	cfg.PathCommands = true
+	cfg.PathsCommand = true
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"gui-enabled", "set", "true"}, nil},
+		{[]string{"gui-enabled", "get"}, []string{"true"}},
+		{[]string{"backends", "add", "--name", "a", "--conns", "3"}, nil},
+		{[]string{"backends", "a", "conns", "get"}, []string{"3"}},
+		{[]string{"set", "backends.a.conns", "4"}, nil},
+		{[]string{"get", "backends.a.conns"}, []string{"4"}},
+		{[]string{"paths"}, []string{"gui-enabled", "backends.<key>.name", "backends.<key>.conns"}},
+	} {
+		out, err := runWithConfig(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("%v: unexpected output: %v", tc.args, out)
+		}
+	}
+	if !x.GUIEnabled || len(x.Backends) != 1 || x.Backends[0].MaxConns != 4 {
+		t.Errorf("unexpected value: %+v", x)
+	}
+
+	schema, err := Default.Schema(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema) != 3 || schema[0].Path != "gui-enabled" || schema[2].Path != "backends.<key>.conns" {
+		t.Errorf("unexpected schema: %+v", schema)
+	}
+
+	for _, item := range []interface{}{&NameOverrideConflict{}, &NameOverrideSliceConflict{}} {
+		_, err := Default.Construct(item)
+		if err == nil || !strings.Contains(err.Error(), "Address") || !strings.Contains(err.Error(), "Addr:") {
+			t.Errorf("%T: expected an error naming both fields, got %v", item, err)
+		}
+	}
+}
+
+type EnvDefaultsItem struct {
+	Name string `recli:"id"`
+	Port int    `default:"80" env:"RECLI_TEST_ITEM_PORT" usage:"Port to use"`
+}
+
+type EnvDefaultsStruct struct {
+	Address string `default:"0.0.0.0:8384" env:"RECLI_TEST_ADDRESS"`
+	Ports   []int  `default:"1,2" env:"RECLI_TEST_PORTS"`
+	IP      net.IP `default:"127.0.0.1" env:"RECLI_TEST_IP"`
+	Items   []EnvDefaultsItem
+}
+
+func TestEnvDefaults(t *testing.T) {
+	setenv := func(key, value string) {
+		old, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, old)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+	setenv("RECLI_TEST_ADDRESS", "1.2.3.4:1")
+	setenv("RECLI_TEST_PORTS", "3,4")
+	setenv("RECLI_TEST_IP", "")
+	setenv("RECLI_TEST_ITEM_PORT", "8080")
+
+	x := &EnvDefaultsStruct{}
+	for _, args := range [][]string{
+		{"reset-defaults"},
+		{"items", "add", "--name", "a"},
+	} {
+		if _, err := run(x, args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+	if x.Address != "1.2.3.4:1" || !reflect.DeepEqual(x.Ports, []int{3, 4}) || x.IP.String() != "127.0.0.1" {
+		t.Errorf("unexpected value: %+v", x)
+	}
+	if len(x.Items) != 1 || x.Items[0].Port != 8080 {
+		t.Errorf("unexpected items: %+v", x.Items)
+	}
+
+	// Empty variables only count as set if asked to
+	cfg := DefaultConfig
+	cfg.EmptyEnvIsSet = true
+	setenv("RECLI_TEST_ADDRESS", "")
+	if _, err := runWithConfig(cfg, x, "reset-defaults"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Address != "" {
+		t.Errorf("empty variable not used: %q", x.Address)
+	}
+
+	setenv("RECLI_TEST_ITEM_PORT", "x")
+	if _, err := run(x, "items", "add", "--name", "b"); err == nil || !strings.Contains(err.Error(), "RECLI_TEST_ITEM_PORT") {
+		t.Errorf("expected an error naming the variable, got %v", err)
+	}
+
+	// Without the tag name, the variables are ignored
+	cfg = DefaultConfig
+	cfg.EnvTagName = ""
+	if _, err := runWithConfig(cfg, x, "reset-defaults"); err != nil {
+		t.Fatal(err)
+	}
+	if x.Address != "0.0.0.0:8384" || !reflect.DeepEqual(x.Ports, []int{1, 2}) {
+		t.Errorf("unexpected value: %+v", x)
+	}
+
+	flags := Default.(*constructor).makeSliceItemBuilderFlags(reflect.TypeOf(EnvDefaultsItem{}))
+	if usage := flagUsage(flags[1]); usage != "Port to use (default: 80, env: RECLI_TEST_ITEM_PORT)" {
+		t.Errorf("unexpected usage: %q", usage)
+	}
+}
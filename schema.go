@@ -0,0 +1,89 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/urfave/cli"
+)
+
+// FieldSchema describes a single property reachable from the root struct.
+type FieldSchema struct {
+	// Path is the dot separated path of command names leading to the
+	// property, with slice items and map entries represented as <key>.
+	Path string `json:"path"`
+	// Kind is the kind of the property, with pointers dereferenced.
+	Kind string `json:"kind"`
+	// Type is the Go type name of the property.
+	Type string `json:"type"`
+	// Settable is true if the property can be changed with a set command.
+	Settable bool `json:"settable"`
+	// Secret is true if the property is secret, and redacted when shown.
+	Secret  bool     `json:"secret,omitempty"`
+	Usage   string   `json:"usage,omitempty"`
+	Default string   `json:"default,omitempty"`
+	Enum    []string `json:"enum,omitempty"`
+	Min     string   `json:"min,omitempty"`
+	Max     string   `json:"max,omitempty"`
+}
+
+func (c *constructor) Schema(item interface{}) ([]FieldSchema, error) {
+	t := reflect.TypeOf(item)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("expected a pointer to a struct")
+	}
+	return c.schema(t.Elem())
+}
+
+func (c *constructor) schema(t reflect.Type) ([]FieldSchema, error) {
+	var fields []FieldSchema
+	err := c.walkType(nil, t, func(path []string, t reflect.Type, field *reflect.StructField) error {
+		schema := FieldSchema{
+			Path:     strings.Join(path, "."),
+			Kind:     derefType(t).Kind().String(),
+			Type:     t.String(),
+			Settable: isPrimitiveType(t),
+		}
+		if field != nil {
+			schema.Secret = c.isSecret(*field)
+			schema.Usage = field.Tag.Get(c.cfg.UsageTagName)
+			schema.Default = field.Tag.Get(c.cfg.DefaultTagName)
+			if enum, ok := field.Tag.Lookup(c.cfg.EnumTagName); ok {
+				schema.Enum = strings.Split(enum, ",")
+			}
+			schema.Min = field.Tag.Get(c.cfg.MinTagName)
+			schema.Max = field.Tag.Get(c.cfg.MaxTagName)
+		}
+		fields = append(fields, schema)
+		return nil
+	})
+	return fields, err
+}
+
+func (c *constructor) makeSchemaCommand(t reflect.Type) cli.Command {
+	return cli.Command{
+		Name:     "schema",
+		Usage:    "Describe all properties as json",
+		Category: "ACTIONS",
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			fields, err := c.schema(t)
+			if err != nil {
+				return err
+			}
+			bytes, err := json.MarshalIndent(fields, "", "  ")
+			if err != nil {
+				return err
+			}
+			return c.printer(ctx).emitJSON(bytes)
+		}),
+	}
+}
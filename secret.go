@@ -0,0 +1,120 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/urfave/cli"
+)
+
+const redactedValue = "<redacted>"
+
+var errSecret = errors.New("value is secret, use --reveal to print it")
+
+func (c *constructor) isSecret(f reflect.StructField) bool {
+	return c.cfg.SecretTag.Name != "" && hasTag(f, c.cfg.SecretTag)
+}
+
+// hasSecrets returns whether any field reachable from the type is secret.
+func (c *constructor) hasSecrets(t reflect.Type) bool {
+	return c.hasSecretsSeen(t, make(map[reflect.Type]bool))
+}
+
+func (c *constructor) hasSecretsSeen(t reflect.Type, seen map[reflect.Type]bool) bool {
+	t = derefType(t)
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if c.isSecret(f) || c.hasSecretsSeen(f.Type, seen) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return c.hasSecretsSeen(t.Elem(), seen)
+	}
+	return false
+}
+
+// revealFlags returns the --reveal flag if the type has anything to reveal.
+func (c *constructor) revealFlags(t reflect.Type) []cli.Flag {
+	if !c.hasSecrets(t) {
+		return nil
+	}
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:  "reveal",
+			Usage: "Print secret values instead of redacting them",
+		},
+	}
+}
+
+// revealed returns v as is if --reveal was passed or it has no secrets, and
+// otherwise a copy of it with all the secrets redacted.
+func (c *constructor) revealed(ctx *cli.Context, v reflect.Value) reflect.Value {
+	if ctx.Bool("reveal") || !c.hasSecrets(v.Type()) {
+		return v
+	}
+	out := deepCopy(v)
+	c.redact(out, make(map[uintptr]bool))
+	return out
+}
+
+// redact replaces the secret string fields under v with a placeholder, and
+// zeroes all other secret fields.
+func (c *constructor) redact(v reflect.Value, seen map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return
+		}
+		seen[v.Pointer()] = true
+		c.redact(v.Elem(), seen)
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !v.Field(i).CanSet() {
+				continue
+			}
+			if c.isSecret(t.Field(i)) {
+				redactValue(v.Field(i))
+			} else {
+				c.redact(v.Field(i), seen)
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			c.redact(v.Index(i), seen)
+		}
+
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			c.redact(value, seen)
+			v.SetMapIndex(key, value)
+		}
+	}
+}
+
+func redactValue(v reflect.Value) {
+	if dv := deref(v); dv.IsValid() && dv.Kind() == reflect.String {
+		dv.SetString(redactedValue)
+		return
+	}
+	v.Set(reflect.Zero(v.Type()))
+}
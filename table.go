@@ -0,0 +1,159 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// defaultTableColumns is the number of columns shown when none are selected.
+const defaultTableColumns = 4
+
+type tableColumn struct {
+	name  string
+	index int
+}
+
+// tableColumns returns the columns available for the struct type, along with
+// the ones shown by default: the ID field followed by the first primitives.
+func (c *constructor) tableColumns(t reflect.Type) (all, defaults []tableColumn) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if c.isSkipped(f) {
+			continue
+		}
+		column := tableColumn{c.fieldName(f), i}
+		all = append(all, column)
+		if hasTag(f, c.cfg.IDTag) {
+			defaults = append([]tableColumn{column}, defaults...)
+		} else if isPrimitiveType(f.Type) {
+			defaults = append(defaults, column)
+		}
+	}
+	if len(defaults) > defaultTableColumns {
+		defaults = defaults[:defaultTableColumns]
+	}
+	return all, defaults
+}
+
+func tableCell(v reflect.Value) (interface{}, error) {
+	if isPrimitive(v) {
+		if v = deref(v); !v.IsValid() {
+			return nil, nil
+		}
+		return GetPrimitiveValue(v)
+	}
+
+	vi, err := dumpable(v)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := json.Marshal(vi)
+	return string(bs), err
+}
+
+func (c *constructor) makeTableCommand(v reflect.Value) cli.Command {
+	all, defaults := c.tableColumns(v.Type().Elem())
+
+	return cli.Command{
+		Name:     "table",
+		Usage:    "Print the items as a table",
+		Category: "ACTIONS",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:  "columns",
+				Usage: "Comma separated properties to show as columns",
+			},
+		}, c.revealFlags(v.Type())...),
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			columns := defaults
+			if ctx.IsSet("columns") {
+				columns = nil
+				for _, name := range strings.Split(ctx.String("columns"), ",") {
+					column, ok := findTableColumn(all, strings.TrimSpace(name))
+					if !ok {
+						names := make([]string, 0, len(all))
+						for _, column := range all {
+							names = append(names, column.name)
+						}
+						return fmt.Errorf("unknown column %q, expected one of: %s", name, strings.Join(names, ", "))
+					}
+					columns = append(columns, column)
+				}
+			}
+
+			items := c.revealed(ctx, v)
+			rows := make([][]keyValuePair, 0, items.Len())
+			for i := 0; i < items.Len(); i++ {
+				row := make([]keyValuePair, 0, len(columns))
+				for _, column := range columns {
+					cell, err := tableCell(items.Index(i).Field(column.index))
+					if err != nil {
+						return err
+					}
+					row = append(row, keyValuePair{column.name, cell})
+				}
+				rows = append(rows, row)
+			}
+
+			p := c.printer(ctx)
+			if p.mode == OutputJSON {
+				for _, row := range rows {
+					if err := p.emitKeyValues(row); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			var buf bytes.Buffer
+			tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+			header := make([]string, 0, len(columns))
+			for _, column := range columns {
+				header = append(header, strings.ToUpper(column.name))
+			}
+			fmt.Fprintln(tw, strings.Join(header, "\t"))
+			for _, row := range rows {
+				cells := make([]string, 0, len(row))
+				for _, cell := range row {
+					if cell.value == nil {
+						cells = append(cells, "")
+					} else {
+						cells = append(cells, fmt.Sprint(cell.value))
+					}
+				}
+				fmt.Fprintln(tw, strings.Join(cells, "\t"))
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+				if err := p.emitText(strings.TrimRight(line, " ")); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	}
+}
+
+func findTableColumn(columns []tableColumn, name string) (tableColumn, bool) {
+	for _, column := range columns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return tableColumn{}, false
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// CommandTree is a node of the generated command hierarchy, for inspecting it
+// without running anything.
+type CommandTree struct {
+	Name      string
+	Usage     string
+	ArgsUsage string
+	Category  string
+	Flags     []cli.Flag
+	Children  []*CommandTree
+	// IsAction is set for the commands that do something, rather than group
+	// other commands.
+	IsAction bool
+	Hidden   bool
+}
+
+// BuildCommandTree returns the tree of the commands Construct generates for
+// the item, under a root node without a name.
+func (c *constructor) BuildCommandTree(item interface{}) (*CommandTree, error) {
+	cmds, err := c.Construct(item)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandTree{Children: commandTrees(cmds)}, nil
+}
+
+func commandTrees(cmds []cli.Command) []*CommandTree {
+	trees := make([]*CommandTree, 0, len(cmds))
+	for _, cmd := range cmds {
+		trees = append(trees, &CommandTree{
+			Name:      cmd.Name,
+			Usage:     cmd.Usage,
+			ArgsUsage: cmd.ArgsUsage,
+			Category:  cmd.Category,
+			Flags:     cmd.Flags,
+			Children:  commandTrees(cmd.Subcommands),
+			IsAction:  cmd.Category == "ACTIONS",
+			Hidden:    cmd.Hidden,
+		})
+	}
+	return trees
+}
+
+func (c *constructor) makeTreeCommand(cmds *[]cli.Command) cli.Command {
+	return cli.Command{
+		Name:     "tree",
+		Usage:    "Print the command hierarchy",
+		Category: "ACTIONS",
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "depth",
+				Usage: "Maximum depth to print, 0 for unlimited",
+			},
+		},
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			return c.printer(ctx).printTree(*cmds, 0, ctx.Int("depth"))
+		}),
+	}
+}
+
+func (p printer) printTree(cmds []cli.Command, depth, maxDepth int) error {
+	if maxDepth > 0 && depth >= maxDepth {
+		return nil
+	}
+	for _, cmd := range cmds {
+		line := strings.Repeat("  ", depth) + cmd.Name
+		if cmd.Category != "" {
+			line += " [" + cmd.Category + "]"
+		}
+		if cmd.ArgsUsage != "" {
+			line += " " + cmd.ArgsUsage
+		}
+		if isLiveItemCommand(cmd) {
+			// The item, and so its subcommands, are only known when run
+			line += " (resolved when run)"
+		}
+		if err := p.emitText(line); err != nil {
+			return err
+		}
+		if err := p.printTree(cmd.Subcommands, depth+1, maxDepth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,12 +8,17 @@ package recli
 
 import (
 	"encoding"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 
@@ -24,8 +29,30 @@ type ParseDefaulter interface {
 	ParseDefault(string) error
 }
 
+type Validator interface {
+	Validate() error
+}
+
 var (
-	textUnmarshaler = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+	basicTypes = map[reflect.Kind]reflect.Type{
+		reflect.Int:     reflect.TypeOf(int(0)),
+		reflect.Int8:    reflect.TypeOf(int8(0)),
+		reflect.Int16:   reflect.TypeOf(int16(0)),
+		reflect.Int32:   reflect.TypeOf(int32(0)),
+		reflect.Int64:   reflect.TypeOf(int64(0)),
+		reflect.Uint:    reflect.TypeOf(uint(0)),
+		reflect.Uint8:   reflect.TypeOf(uint8(0)),
+		reflect.Uint16:  reflect.TypeOf(uint16(0)),
+		reflect.Uint32:  reflect.TypeOf(uint32(0)),
+		reflect.Uint64:  reflect.TypeOf(uint64(0)),
+		reflect.Uintptr: reflect.TypeOf(uintptr(0)),
+	}
+	textMarshaler      = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
+	textUnmarshaler    = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
+	parseDefaulterType = reflect.TypeOf(new(ParseDefaulter)).Elem()
+	// net.HardwareAddr has a String method but no UnmarshalText, so it gets
+	// handled explicitly.
+	hardwareAddrType = reflect.TypeOf(net.HardwareAddr{})
 )
 
 func hasTag(field reflect.StructField, tag Tag) bool {
@@ -44,34 +71,91 @@ func simplifyKind(k reflect.Kind) reflect.Kind {
 	return k
 }
 
+func isNumericKind(k reflect.Kind) bool {
+	return reflect.Int <= k && k <= reflect.Complex128
+}
+
+func isUnsignedKind(k reflect.Kind) bool {
+	return reflect.Uint <= k && k <= reflect.Uintptr
+}
+
 func unsupportedKindErr(k reflect.Kind) error {
 	_, fn, line, _ := runtime.Caller(1)
 	fileParts := strings.Split(fn, "/")
 	return fmt.Errorf("unsupported kind: %s [%s:%d]", k, fileParts[len(fileParts)-1], line)
 }
 
-func toLowerDashCase(arg string) string {
-	output := make([]rune, 0, len(arg))
+// ToLowerDashCase converts a field name such as ListenAddress to
+// listen-address, and is the default Config.FieldNameConverter. Underscores
+// separate words the same way, and runs of uppercase letters, such as
+// acronyms, are kept together.
+func ToLowerDashCase(arg string) string {
+	return strings.Join(splitWords(arg), "-")
+}
+
+// ToSnakeCase converts a field name such as ListenAddress to listen_address,
+// splitting it into words like ToLowerDashCase.
+func ToSnakeCase(arg string) string {
+	return strings.Join(splitWords(arg), "_")
+}
+
+// ToCamelCase converts a field name such as ListenAddress to listenAddress,
+// splitting it into words like ToLowerDashCase.
+func ToCamelCase(arg string) string {
+	words := splitWords(arg)
+	for i := 1; i < len(words); i++ {
+		r, size := utf8.DecodeRuneInString(words[i])
+		words[i] = string(unicode.ToUpper(r)) + words[i][size:]
+	}
+	return strings.Join(words, "")
+}
+
+// splitWords splits a field name into lowercase words at underscores and at
+// uppercase letters following lowercase ones, keeping runs of uppercase
+// letters together.
+func splitWords(arg string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
 	previousUppercase := false
 	for i, r := range arg {
-		if i == 0 {
-			output = append(output, unicode.ToLower(r))
+		if r == '_' {
+			flush()
 		} else if unicode.IsUpper(r) {
-			// If it's the last rune, and it's uppercase, it's probably a unit suffix, so skip the dash
+			// If it's the last rune, and it's uppercase, it's probably a unit suffix, so don't split
 			if !previousUppercase && i != len(arg)-1 {
-				output = append(output, '-')
+				flush()
 			}
-			output = append(output, unicode.ToLower(r))
+			word = append(word, unicode.ToLower(r))
 		} else {
-			output = append(output, r)
+			word = append(word, r)
 		}
 		previousUppercase = unicode.IsUpper(r)
-
 	}
-	return string(output)
+	flush()
+	return words
 }
 
-func getPrimitiveValue(v reflect.Value) (interface{}, error) {
+// IsPrimitiveType returns whether values of the type, or of the type it
+// points to, are handled as a single value, such as numbers, strings, bools,
+// net.HardwareAddr and types implementing both encoding.TextMarshaler and
+// encoding.TextUnmarshaler.
+func IsPrimitiveType(t reflect.Type) bool {
+	return isPrimitiveType(t)
+}
+
+// GetPrimitiveValue returns the value held by v, which must not be a
+// pointer, the way recli prints it. Integers, unsigned integers and floats
+// are converted to the basic type of their size, dropping any named type,
+// complex numbers and types implementing encoding.TextMarshaler are
+// formatted as strings, and net.HardwareAddr as a MAC address. Other kinds,
+// such as structs and slices, are an error.
+func GetPrimitiveValue(v reflect.Value) (interface{}, error) {
 	// Always expect a non-pointer
 	if v.CanAddr() && v.Addr().CanInterface() {
 		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
@@ -80,21 +164,45 @@ func getPrimitiveValue(v reflect.Value) (interface{}, error) {
 		}
 	}
 
-	k := simplifyKind(v.Kind())
+	if v.Type() == hardwareAddrType {
+		return net.HardwareAddr(v.Bytes()).String(), nil
+	}
+
+	k := v.Kind()
 	switch k {
 	case reflect.Bool:
 		return v.Bool(), nil
-	case reflect.Int:
-		return v.Int(), nil
-	case reflect.Float32, reflect.Float64:
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Return the natural type for the size of the value, ignoring any
+		// named types.
+		out := reflect.New(basicTypes[k]).Elem()
+		out.SetInt(v.Int())
+		return out.Interface(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		out := reflect.New(basicTypes[k]).Elem()
+		out.SetUint(v.Uint())
+		return out.Interface(), nil
+	case reflect.Float32:
+		return float32(v.Float()), nil
+	case reflect.Float64:
 		return v.Float(), nil
+	case reflect.Complex64, reflect.Complex128:
+		// Formatted as real+imagi, without the surrounding parentheses
+		s := strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
+		return strings.TrimSuffix(strings.TrimPrefix(s, "("), ")"), nil
 	case reflect.String:
 		return v.String(), nil
 	}
 	return nil, unsupportedKindErr(k)
 }
 
-func setPrimitiveValueFromString(v reflect.Value, arg string) error {
+// SetPrimitiveValueFromString parses arg according to the type of v, and
+// stores the result in v, which must be settable and not a pointer. This is
+// how the set commands parse their arguments: integers accept 0x, 0o and 0b
+// prefixes and fail if they overflow the type, types implementing
+// encoding.TextUnmarshaler parse themselves, and net.HardwareAddr takes a MAC
+// address.
+func SetPrimitiveValueFromString(v reflect.Value, arg string) error {
 	// Always expect a non-pointer
 	if v.CanAddr() && v.Addr().CanInterface() {
 		if m, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
@@ -102,6 +210,15 @@ func setPrimitiveValueFromString(v reflect.Value, arg string) error {
 		}
 	}
 
+	if v.Type() == hardwareAddrType {
+		mac, err := net.ParseMAC(arg)
+		if err != nil {
+			return fmt.Errorf("invalid MAC address %q, expected a format such as aa:bb:cc:dd:ee:ff", arg)
+		}
+		v.SetBytes(mac)
+		return nil
+	}
+
 	k := simplifyKind(v.Kind())
 	switch k {
 	case reflect.Bool:
@@ -112,7 +229,15 @@ func setPrimitiveValueFromString(v reflect.Value, arg string) error {
 		}
 
 	case reflect.Int:
-		if cv, err := strconv.ParseInt(arg, 0, 0); err != nil {
+		if isUnsignedKind(v.Kind()) {
+			if cv, err := strconv.ParseUint(arg, 0, 0); err != nil {
+				return err
+			} else if v.OverflowUint(cv) {
+				return fmt.Errorf("value overflows: %d", cv)
+			} else {
+				v.SetUint(cv)
+			}
+		} else if cv, err := strconv.ParseInt(arg, 0, 0); err != nil {
 			return err
 		} else if v.OverflowInt(cv) {
 			return fmt.Errorf("value overflows: %d", cv)
@@ -121,12 +246,19 @@ func setPrimitiveValueFromString(v reflect.Value, arg string) error {
 		}
 
 	case reflect.Float32, reflect.Float64:
-		if cv, err := strconv.ParseFloat(arg, 0); err != nil {
+		if cv, err := strconv.ParseFloat(arg, v.Type().Bits()); err != nil {
 			return err
 		} else {
 			v.SetFloat(cv)
 		}
 
+	case reflect.Complex64, reflect.Complex128:
+		if cv, err := strconv.ParseComplex(arg, v.Type().Bits()); err != nil {
+			return err
+		} else {
+			v.SetComplex(cv)
+		}
+
 	case reflect.String:
 		v.SetString(arg)
 
@@ -137,9 +269,30 @@ func setPrimitiveValueFromString(v reflect.Value, arg string) error {
 	return nil
 }
 
+func setSliceValueFromStrings(v reflect.Value, args []string) error {
+	items := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), len(args), len(args))
+	for i, arg := range args {
+		if err := SetPrimitiveValueFromString(items.Index(i), arg); err != nil {
+			return err
+		}
+	}
+
+	if v.Kind() == reflect.Array {
+		if items.Len() > v.Len() {
+			return fmt.Errorf("too many values: %d > %d", items.Len(), v.Len())
+		}
+		v.Set(reflect.Zero(v.Type()))
+		reflect.Copy(v, items)
+		return nil
+	}
+
+	v.Set(items)
+	return nil
+}
+
 func stringToPrimitiveValue(arg string, t reflect.Type) (reflect.Value, error) {
 	v := reflect.New(t).Elem()
-	return v, setPrimitiveValueFromString(v, arg)
+	return v, SetPrimitiveValueFromString(v, arg)
 }
 
 func expectArgs(n int, actionFunc cli.ActionFunc) cli.ActionFunc {
@@ -155,7 +308,73 @@ func expectArgs(n int, actionFunc cli.ActionFunc) cli.ActionFunc {
 	}
 }
 
-func setDefaults(tagName string, data interface{}, seen map[uintptr]struct{}) error {
+// SetDefaults sets the fields of the struct pointed to by data from their
+// default tags, named by tagName. Nested structs are descended into, and nil
+// pointers are allocated if they have a default. The tag value is parsed
+// according to the kind of the field:
+//
+//   - types implementing ParseDefaulter are given the tag value as is, and
+//     are not descended into even if they are structs
+//   - types implementing encoding.TextUnmarshaler are unmarshaled from it
+//   - bools, numbers and complex numbers are parsed with strconv, integers
+//     accepting 0x, 0o and 0b prefixes, for example "true", "0x1f" or "1+2i"
+//   - strings are taken as is
+//   - net.HardwareAddr takes a MAC address, such as "aa:bb:cc:dd:ee:ff"
+//   - slices and arrays of the above take comma separated values, such as
+//     "10,20", arrays keeping any remaining items zero; integers in them are
+//     decimal, so "010" is 10
+//   - slices of structs take a json array, such as `[{"Name": "a"}]`
+//
+// Any other kind with a default is an error.
+func SetDefaults(tagName string, data interface{}) error {
+	return setDefaults(defaultSource{tagName: tagName}, data)
+}
+
+// SetDefaultsFromEnv sets the fields like SetDefaults does, except that the
+// value of the environment variable named by the envTagName tag of a field,
+// such as env:"MYAPP_ADDRESS", takes precedence over its default tag when set
+// and not empty.
+func SetDefaultsFromEnv(tagName, envTagName string, data interface{}) error {
+	return setDefaults(defaultSource{tagName: tagName, envTagName: envTagName}, data)
+}
+
+// defaultSource names the tags the defaults of fields are taken from.
+type defaultSource struct {
+	tagName string
+	// envTagName names the environment variable taking precedence over
+	// the default tag, if set.
+	envTagName string
+	// emptyEnv makes empty environment variables count as set.
+	emptyEnv bool
+}
+
+// lookup returns the default of the field, along with the name of the
+// environment variable it came from, if any.
+func (d defaultSource) lookup(f reflect.StructField) (value, env string, ok bool) {
+	if d.envTagName != "" {
+		if env = f.Tag.Get(d.envTagName); env != "" {
+			if value, ok = os.LookupEnv(env); ok && (value != "" || d.emptyEnv) {
+				return value, env, true
+			}
+		}
+	}
+	value, ok = f.Tag.Lookup(d.tagName)
+	return value, "", ok
+}
+
+func setDefaults(d defaultSource, data interface{}) error {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("setDefaults: expected a non-nil pointer to a struct, got %T", data)
+	}
+	_, err := applyDefaults(d, data, nil, false)
+	return err
+}
+
+// applyDefaults sets fields from their defaults, returning the number of
+// fields set. If onlyZero is set, fields that already hold a non-zero value
+// are left untouched.
+func applyDefaults(d defaultSource, data interface{}, seen map[uintptr]struct{}, onlyZero bool) (int, error) {
 	s := reflect.ValueOf(data).Elem()
 	t := s.Type()
 
@@ -163,75 +382,118 @@ func setDefaults(tagName string, data interface{}, seen map[uintptr]struct{}) er
 		seen = make(map[uintptr]struct{})
 	} else if s.CanAddr() {
 		if _, ok := seen[s.Addr().Pointer()]; ok {
-			return nil
+			return 0, nil
 		}
 	}
 
 	seen[s.Addr().Pointer()] = struct{}{}
 
+	touched := 0
 	for i := 0; i < s.NumField(); i++ {
 		f := deref(s.Field(i))
-		tag := t.Field(i).Tag
 
-		if f.Kind() == reflect.Struct {
+		// Checked on the type, so that nil pointers and structs that parse
+		// their own defaults are covered too
+		defaulter := reflect.PtrTo(derefType(t.Field(i).Type)).Implements(parseDefaulterType)
+
+		if f.Kind() == reflect.Struct && !defaulter {
 			if f.CanAddr() && f.Addr().CanInterface() {
-				err := setDefaults(tagName, f.Addr().Interface(), seen)
+				n, err := applyDefaults(d, f.Addr().Interface(), seen, onlyZero)
 				if err != nil {
-					return err
+					return touched, err
 				}
+				touched += n
 				continue
 			}
 		}
 
-		v := tag.Get(tagName)
-		if len(v) == 0 {
+		v, env, _ := d.lookup(t.Field(i))
+		if len(v) == 0 && env == "" {
 			continue
 		}
 
-		if f.CanAddr() && f.Addr().CanInterface() {
-			if i, ok := f.Addr().Interface().(ParseDefaulter); ok {
-				if err := i.ParseDefault(v); err != nil {
-					return err
-				}
-				continue
+		if onlyZero && f.IsValid() && !f.IsZero() {
+			continue
+		}
+
+		// Allocate nil pointers that have a default
+		if !f.IsValid() && s.Field(i).CanSet() {
+			f = derefAndInit(s.Field(i))
+		}
+
+		touched++
+
+		if err := setDefault(f, v, defaulter); err != nil {
+			if env != "" {
+				return touched, errors.Wrapf(err, "environment variable %s", env)
 			}
+			return touched, err
 		}
+	}
+
+	return touched, nil
+}
+
+// setDefault parses the default into f, as described by SetDefaults.
+func setDefault(f reflect.Value, v string, defaulter bool) error {
+	if defaulter && f.CanAddr() && f.Addr().CanInterface() {
+		return f.Addr().Interface().(ParseDefaulter).ParseDefault(v)
+	}
+
+	if isPrimitive(f) {
+		return SetPrimitiveValueFromString(f, v)
+	}
 
-		if isPrimitive(f) {
-			err := setPrimitiveValueFromString(f, v)
+	switch f.Kind() {
+	case reflect.Array, reflect.Slice:
+		if isPrimitiveType(f.Type().Elem()) {
+			items, err := decimalItems(f.Type().Elem(), strings.Split(v, ","))
 			if err != nil {
 				return err
 			}
-			continue
+			return setSliceValueFromStrings(f, items)
+		}
+		// Slices of structs take a json array as the default
+		if f.Type().Elem().Kind() == reflect.Struct && f.CanAddr() && f.Addr().CanInterface() {
+			return errors.Wrap(json.Unmarshal([]byte(v), f.Addr().Interface()), "setDefaults")
 		}
+	}
 
-		switch f.Kind() {
-		case reflect.Array, reflect.Slice:
-			switch simplifyKind(f.Type().Elem().Kind()) {
-			case reflect.Int:
-				var m []int
-				for _, si := range strings.Split(v, ",") {
-					i, err := strconv.ParseInt(si, 10, 64)
-					if err != nil {
-						return err
-					}
-					m = append(m, int(i))
-				}
-				f.Set(reflect.ValueOf(m))
-				continue
-			case reflect.String:
-				var m []string
-				for _, i := range strings.Split(v, ",") {
-					m = append(m, i)
-				}
-				f.Set(reflect.ValueOf(m))
-				continue
+	return errors.Wrap(unsupportedKindErr(f.Kind()), "setDefaults")
+}
+
+// decimalItems parses integer items of slice defaults in base 10, as they
+// always were, rather than taking prefixes like single values do.
+func decimalItems(t reflect.Type, items []string) ([]string, error) {
+	if reflect.PtrTo(t).Implements(textUnmarshaler) || simplifyKind(t.Kind()) != reflect.Int {
+		return items, nil
+	}
+	parsed := make([]string, len(items))
+	for i, item := range items {
+		if isUnsignedKind(t.Kind()) {
+			n, err := strconv.ParseUint(item, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			parsed[i] = strconv.FormatUint(n, 10)
+		} else {
+			n, err := strconv.ParseInt(item, 10, 64)
+			if err != nil {
+				return nil, err
 			}
+			parsed[i] = strconv.FormatInt(n, 10)
 		}
-
-		return errors.Wrap(unsupportedKindErr(f.Kind()), "setDefaults")
 	}
+	return parsed, nil
+}
 
+// validate calls Validate on v if it implements Validator.
+func validate(v reflect.Value) error {
+	if v.CanAddr() && v.Addr().CanInterface() {
+		if i, ok := v.Addr().Interface().(Validator); ok {
+			return i.Validate()
+		}
+	}
 	return nil
 }
 
@@ -241,3 +503,262 @@ func deref(v reflect.Value) reflect.Value {
 	}
 	return v
 }
+
+func numericValue(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// derefAndInit is like deref, but allocates any nil pointers in the chain
+// rather than stopping at them.
+func derefAndInit(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// readInput returns the contents of the file if the argument is prefixed with
+// @, standard input if the argument is -, or the argument itself otherwise.
+func readInput(arg string) ([]byte, error) {
+	switch {
+	case arg == "-":
+		return ioutil.ReadAll(os.Stdin)
+	case strings.HasPrefix(arg, "@"):
+		return ioutil.ReadFile(arg[1:])
+	}
+	return []byte(arg), nil
+}
+
+// deepCopy returns a copy of v which shares no pointers, slices or maps with
+// the original.
+func deepCopy(v reflect.Value) reflect.Value {
+	out := reflect.New(v.Type()).Elem()
+	copyInto(out, v, make(map[seenPointer]reflect.Value))
+	return out
+}
+
+func copyInto(dst, src reflect.Value, seen map[seenPointer]reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		// Pointers to a struct and to its first field share the address
+		key := seenPointer{src.Pointer(), src.Type()}
+		if existing, ok := seen[key]; ok {
+			dst.Set(existing)
+			return
+		}
+		dst.Set(reflect.New(src.Type().Elem()))
+		seen[key] = dst
+		copyInto(dst.Elem(), src.Elem(), seen)
+
+	case reflect.Struct:
+		// Copies unexported fields as is
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				copyInto(dst.Field(i), src.Field(i), seen)
+			}
+		}
+
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			copyInto(dst.Index(i), src.Index(i), seen)
+		}
+
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			copyInto(dst.Index(i), src.Index(i), seen)
+		}
+
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		for _, key := range src.MapKeys() {
+			value := reflect.New(src.Type().Elem()).Elem()
+			copyInto(value, src.MapIndex(key), seen)
+			dst.SetMapIndex(key, value)
+		}
+
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		value := reflect.New(src.Elem().Type()).Elem()
+		copyInto(value, src.Elem(), seen)
+		dst.Set(value)
+
+	default:
+		dst.Set(src)
+	}
+}
+
+// copyInPlace copies src into dst like copyInto, but keeps the pointees,
+// slice arrays and maps dst already has, so that references to them held
+// elsewhere see the copied values. Used to restore or update live values
+// from copies.
+func copyInPlace(dst, src reflect.Value, seen map[seenPointer]reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			dst.Set(src)
+			return
+		}
+		key := seenPointer{src.Pointer(), src.Type()}
+		if existing, ok := seen[key]; ok {
+			dst.Set(existing)
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(src.Type().Elem()))
+		}
+		seen[key] = dst
+		copyInPlace(dst.Elem(), src.Elem(), seen)
+
+	case reflect.Struct:
+		// Copies unexported fields as is, keeping the exported ones of dst
+		// to restore them one by one
+		value := reflect.New(src.Type()).Elem()
+		value.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if value.Field(i).CanSet() {
+				value.Field(i).Set(dst.Field(i))
+			}
+		}
+		dst.Set(value)
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				copyInPlace(dst.Field(i), src.Field(i), seen)
+			}
+		}
+
+	case reflect.Slice:
+		if src.IsNil() {
+			dst.Set(src)
+			return
+		}
+		if dst.IsNil() || dst.Cap() < src.Len() {
+			dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		} else {
+			dst.SetLen(src.Len())
+		}
+		for i := 0; i < src.Len(); i++ {
+			copyInPlace(dst.Index(i), src.Index(i), seen)
+		}
+
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			copyInPlace(dst.Index(i), src.Index(i), seen)
+		}
+
+	case reflect.Map:
+		if src.IsNil() {
+			dst.Set(src)
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		}
+		for _, key := range dst.MapKeys() {
+			if !src.MapIndex(key).IsValid() {
+				dst.SetMapIndex(key, reflect.Value{})
+			}
+		}
+		for _, key := range src.MapKeys() {
+			value := reflect.New(src.Type().Elem()).Elem()
+			if existing := dst.MapIndex(key); existing.IsValid() {
+				value.Set(existing)
+			}
+			copyInPlace(value, src.MapIndex(key), seen)
+			dst.SetMapIndex(key, value)
+		}
+
+	case reflect.Interface:
+		if src.IsNil() {
+			dst.Set(src)
+			return
+		}
+		value := reflect.New(src.Elem().Type()).Elem()
+		if !dst.IsNil() && dst.Elem().Type() == src.Elem().Type() {
+			value.Set(dst.Elem())
+		}
+		copyInPlace(value, src.Elem(), seen)
+		dst.Set(value)
+
+	default:
+		dst.Set(src)
+	}
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// splitArgs splits the line into whitespace separated arguments, honouring
+// single and double quotes, and backslash escapes outside of single quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current []rune
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current = append(current, r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current = append(current, r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, string(current))
+				current = current[:0]
+				inArg = false
+			}
+		default:
+			current = append(current, r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inArg {
+		args = append(args, string(current))
+	}
+	return args, nil
+}
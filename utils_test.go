@@ -7,7 +7,15 @@
 package recli
 
 import (
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/quick"
+
+	"github.com/spf13/pflag"
 )
 
 type Inner struct {
@@ -24,7 +32,7 @@ type DefaultStruct struct {
 func TestSetDefault(t *testing.T) {
 	x := &DefaultStruct{}
 	x.C.B = x
-	err := setDefaults("default", x, nil)
+	err := SetDefaults("default", x)
 	if err != nil {
 		t.Error(err)
 	}
@@ -41,3 +49,476 @@ func TestSetDefault(t *testing.T) {
 		t.Errorf("A loop")
 	}
 }
+
+func TestDerefAndInit(t *testing.T) {
+	var x struct {
+		P **int
+	}
+	v := derefAndInit(reflect.ValueOf(&x).Elem().Field(0))
+	if !v.CanSet() || v.Kind() != reflect.Int {
+		t.Fatalf("unexpected value: %v", v)
+	}
+	v.SetInt(10)
+	if x.P == nil || *x.P == nil || **x.P != 10 {
+		t.Errorf("pointer chain not allocated")
+	}
+}
+
+func TestGetPrimitiveValueTypes(t *testing.T) {
+	type Named int16
+	var x struct {
+		A int
+		B int8
+		C Named
+		D uint32
+		E float32
+	}
+	expected := []interface{}{int(0), int8(0), int16(0), uint32(0), float32(0)}
+
+	v := reflect.ValueOf(&x).Elem()
+	for i, exp := range expected {
+		val, err := GetPrimitiveValue(v.Field(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.TypeOf(val) != reflect.TypeOf(exp) {
+			t.Errorf("field %d: expected %T got %T", i, exp, val)
+		}
+	}
+}
+
+func TestSetPrimitiveValueUnsigned(t *testing.T) {
+	var x uint8
+	v := reflect.ValueOf(&x).Elem()
+	if err := SetPrimitiveValueFromString(v, "200"); err != nil || x != 200 {
+		t.Errorf("unexpected result: %d %v", x, err)
+	}
+	if err := SetPrimitiveValueFromString(v, "300"); err == nil {
+		t.Errorf("expected overflow error")
+	}
+	if err := SetPrimitiveValueFromString(v, "-1"); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
+
+type Device struct {
+	Name string
+	Port int
+}
+
+func TestSetDefaultStructSlice(t *testing.T) {
+	var x struct {
+		Empty   []Device `default:"[]"`
+		Devices []Device `default:"[{\"Name\": \"local\", \"Port\": 22}]"`
+	}
+	if err := SetDefaults("default", &x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Empty == nil || len(x.Empty) != 0 {
+		t.Errorf("Empty: %#v", x.Empty)
+	}
+	if len(x.Devices) != 1 || x.Devices[0].Name != "local" || x.Devices[0].Port != 22 {
+		t.Errorf("Devices: %#v", x.Devices)
+	}
+}
+
+func TestDeepCopyAliasedPointers(t *testing.T) {
+	type inner struct {
+		Port int
+	}
+	x := struct {
+		P *inner
+		Q *int
+	}{P: &inner{1}}
+	x.Q = &x.P.Port
+
+	out := deepCopy(reflect.ValueOf(x)).Interface().(struct {
+		P *inner
+		Q *int
+	})
+	if out.P == x.P || out.P.Port != 1 || out.Q == x.Q || *out.Q != 1 {
+		t.Errorf("unexpected copy: %+v", out)
+	}
+
+	p := x.P
+	out.P.Port, *out.Q = 2, 2
+	copyInPlace(reflect.ValueOf(&x).Elem(), reflect.ValueOf(out), make(map[seenPointer]reflect.Value))
+	if x.P != p || x.Q != &p.Port || p.Port != 2 {
+		t.Errorf("pointees replaced: %+v", x)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		out []string
+	}{
+		{`a b  c`, []string{"a", "b", "c"}},
+		{`set "hello world" 'it''s'`, []string{"set", "hello world", "its"}},
+		{`a\ b "c\"d" ''`, []string{"a b", `c"d`, ""}},
+	} {
+		out, err := splitArgs(tc.in)
+		if err != nil {
+			t.Error(tc.in, err)
+		}
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("%s: %q", tc.in, out)
+		}
+	}
+
+	if _, err := splitArgs(`"unterminated`); err == nil {
+		t.Error("expected error")
+	}
+}
+
+type Level int
+
+func (l *Level) ParseDefault(s string) error {
+	switch s {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %q", s)
+	}
+	return nil
+}
+
+type Endpoint struct {
+	Host string `default:"ignored"`
+	Port int
+}
+
+func (e *Endpoint) ParseDefault(s string) error {
+	e.Host = s
+	e.Port = 443
+	return nil
+}
+
+type ParseDefaulterStruct struct {
+	Level    Level     `default:"high"`
+	LevelPtr *Level    `default:"low"`
+	Endpoint Endpoint  `default:"example.com"`
+	Backup   *Endpoint `default:"backup.example.com"`
+}
+
+func TestSetDefaultsParseDefaulter(t *testing.T) {
+	x := &ParseDefaulterStruct{}
+	if err := SetDefaults("default", x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Level != 2 {
+		t.Errorf("Level %d", x.Level)
+	}
+	if x.LevelPtr == nil || *x.LevelPtr != 1 {
+		t.Errorf("LevelPtr %v", x.LevelPtr)
+	}
+	if x.Endpoint != (Endpoint{"example.com", 443}) {
+		t.Errorf("Endpoint %v", x.Endpoint)
+	}
+	if x.Backup == nil || *x.Backup != (Endpoint{"backup.example.com", 443}) {
+		t.Errorf("Backup %v", x.Backup)
+	}
+}
+
+func TestSetDefaultsDecimalSlices(t *testing.T) {
+	var x struct {
+		Ints  []int    `default:"010,-07"`
+		Uints [2]uint8 `default:"010"`
+	}
+	if err := SetDefaults("default", &x); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x.Ints, []int{10, -7}) {
+		t.Errorf("Ints %v", x.Ints)
+	}
+	if x.Uints != [2]uint8{10, 0} {
+		t.Errorf("Uints %v", x.Uints)
+	}
+
+	var hex struct {
+		Ints []int `default:"0x10"`
+	}
+	if err := SetDefaults("default", &hex); err == nil {
+		t.Errorf("expected error, got %v", hex.Ints)
+	}
+}
+
+func TestSetDefaultsFromEnv(t *testing.T) {
+	t.Setenv("RECLI_TEST_NAME", "from-env")
+	t.Setenv("RECLI_TEST_PORTS", "")
+	t.Setenv("RECLI_TEST_BAD", "x")
+
+	var x struct {
+		Name  string `default:"a" env:"RECLI_TEST_NAME"`
+		Ports []int  `default:"1,2" env:"RECLI_TEST_PORTS"`
+		Unset string `default:"b" env:"RECLI_TEST_UNSET"`
+	}
+	if err := SetDefaultsFromEnv("default", "env", &x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "from-env" || !reflect.DeepEqual(x.Ports, []int{1, 2}) || x.Unset != "b" {
+		t.Errorf("unexpected result: %+v", x)
+	}
+
+	// The environment is ignored by SetDefaults
+	if err := SetDefaults("default", &x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "a" {
+		t.Errorf("unexpected name: %s", x.Name)
+	}
+
+	var bad struct {
+		Port int `default:"1" env:"RECLI_TEST_BAD"`
+	}
+	if err := SetDefaultsFromEnv("default", "env", &bad); err == nil || !strings.Contains(err.Error(), "RECLI_TEST_BAD") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSetDefaultsInvalid(t *testing.T) {
+	var x DefaultStruct
+	var nilStruct *DefaultStruct
+	for _, data := range []interface{}{x, nilStruct, new(int), nil} {
+		if err := SetDefaults("default", data); err == nil {
+			t.Errorf("%T: expected error", data)
+		}
+	}
+}
+
+func ExampleGetPrimitiveValue() {
+	type Port uint16
+	var cfg struct {
+		Port Port
+		Addr net.IP
+	}
+	cfg.Port = 8080
+	cfg.Addr = net.IPv4(127, 0, 0, 1)
+
+	v := reflect.ValueOf(&cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		value, err := GetPrimitiveValue(v.Field(i))
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("%T %v\n", value, value)
+	}
+	// Output:
+	// uint16 8080
+	// string 127.0.0.1
+}
+
+func ExampleSetPrimitiveValueFromString() {
+	var cfg struct {
+		Retries int8
+		Ratio   float64
+	}
+
+	// Fields can only be set through a pointer
+	v := reflect.ValueOf(&cfg).Elem()
+	if err := SetPrimitiveValueFromString(v.Field(0), "0x10"); err != nil {
+		fmt.Println(err)
+	}
+	if err := SetPrimitiveValueFromString(v.Field(1), "0.25"); err != nil {
+		fmt.Println(err)
+	}
+	if err := SetPrimitiveValueFromString(v.Field(0), "1000"); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(cfg.Retries, cfg.Ratio)
+	// Output:
+	// value overflows: 1000
+	// 16 0.25
+}
+
+type FlagsStruct struct {
+	Name    string `usage:"Name of the server"`
+	Port    int    `default:"8080"`
+	Verbose bool
+	Ratio   *float64
+	Hosts   []string
+	Ports   []int `default:"1,2"`
+	GUI     struct {
+		Theme string `default:"dark"`
+	}
+	TLS    *FlagsTLS
+	Labels map[string]string
+	Hidden string `recli:"-"`
+}
+
+type FlagsTLS struct {
+	Cert string
+}
+
+func TestBindFlags(t *testing.T) {
+	var logged []error
+	cfg := DefaultConfig
+	cfg.ErrorLogger = func(err error) {
+		logged = append(logged, err)
+	}
+
+	x := &FlagsStruct{}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	if err := New(cfg).BindFlags(fs, x, "server"); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	fs.VisitAll(func(f *pflag.Flag) {
+		names = append(names, f.Name)
+	})
+	expected := []string{"server.gui.theme", "server.hosts", "server.name", "server.port", "server.ports", "server.ratio", "server.tls.cert", "server.verbose"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected flags: %v", names)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0].Error(), "server.labels") {
+		t.Errorf("unexpected errors: %v", logged)
+	}
+
+	if f := fs.Lookup("server.name"); f.Usage != "Name of the server" || f.DefValue != "" {
+		t.Errorf("unexpected flag: %+v", f)
+	}
+	if f := fs.Lookup("server.port"); f.DefValue != "8080" || f.Value.Type() != "int" {
+		t.Errorf("unexpected flag: %+v", f)
+	}
+	if f := fs.Lookup("server.ports"); f.DefValue != "[1,2]" || f.Value.Type() != "intSlice" {
+		t.Errorf("unexpected flag: %+v", f)
+	}
+
+	err := fs.Parse([]string{"--server.name", "a", "--server.verbose", "--server.ratio=0.5", "--server.hosts", "b,c", "--server.hosts", "d", "--server.ports", "3", "--server.tls.cert", "e"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Name != "a" || x.Port != 8080 || !x.Verbose || *x.Ratio != 0.5 || x.GUI.Theme != "dark" || x.TLS.Cert != "e" {
+		t.Errorf("unexpected value: %+v", x)
+	}
+	if !reflect.DeepEqual(x.Hosts, []string{"b", "c", "d"}) || !reflect.DeepEqual(x.Ports, []int{3}) {
+		t.Errorf("unexpected slices: %v %v", x.Hosts, x.Ports)
+	}
+
+	if err := fs.Parse([]string{"--server.port", "x"}); err == nil {
+		t.Error("expected an error")
+	}
+
+	// Without a prefix
+	fs = pflag.NewFlagSet("test", pflag.ContinueOnError)
+	if err := New(cfg).BindFlags(fs, &FlagsStruct{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Lookup("gui.theme") == nil {
+		t.Error("missing unprefixed flag")
+	}
+
+	cfg.StrictBindFlags = true
+	fs = pflag.NewFlagSet("test", pflag.ContinueOnError)
+	if err := New(cfg).BindFlags(fs, &FlagsStruct{}, ""); err == nil || !strings.Contains(err.Error(), "labels") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := BindFlags(fs, FlagsStruct{}, ""); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// identifier generates exported Go identifiers, biased towards runs of
+// uppercase letters and underscores.
+type identifier string
+
+func (identifier) Generate(r *rand.Rand, size int) reflect.Value {
+	const (
+		upper = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+		other = "abcdefghijklmnopqrstuvwxyz0123456789_"
+	)
+	b := []byte{upper[r.Intn(len(upper))]}
+	for i := r.Intn(size + 1); i > 0; i-- {
+		if r.Intn(3) == 0 {
+			b = append(b, upper[r.Intn(len(upper))])
+		} else {
+			b = append(b, other[r.Intn(len(other))])
+		}
+	}
+	return reflect.ValueOf(identifier(b))
+}
+
+func TestToLowerDashCase(t *testing.T) {
+	for input, expected := range map[string]string{
+		"Name":          "name",
+		"ListenAddress": "listen-address",
+		"HTTPServer":    "httpserver",
+		"ServerHTTP":    "server-http",
+		"TimeoutS":      "timeouts",
+		"Port8080":      "port8080",
+		"TLS_Cert":      "tls-cert",
+		"Max__Conns_":   "max-conns",
+		"Foo_Bar":       "foo-bar",
+		"_":             "",
+	} {
+		if actual := ToLowerDashCase(input); actual != expected {
+			t.Errorf("%s: got %q, expected %q", input, actual, expected)
+		}
+	}
+
+	valid := func(id identifier) bool {
+		out := ToLowerDashCase(string(id))
+		if strings.HasPrefix(out, "-") || strings.HasSuffix(out, "-") || strings.Contains(out, "--") {
+			return false
+		}
+		for _, r := range out {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(valid, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+
+	idempotent := func(id identifier) bool {
+		once := ToLowerDashCase(string(id))
+		return ToLowerDashCase(once) == once
+	}
+	if err := quick.Check(idempotent, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCaseConverters(t *testing.T) {
+	for _, tc := range []struct {
+		input, dash, snake, camel string
+	}{
+		{"Name", "name", "name", "name"},
+		{"ListenAddress", "listen-address", "listen_address", "listenAddress"},
+		{"HTTPPort", "httpport", "httpport", "httpport"},
+		{"ServerHTTP", "server-http", "server_http", "serverHttp"},
+		{"IPv6Enabled", "ipv6-enabled", "ipv6_enabled", "ipv6Enabled"},
+		{"TimeoutS", "timeouts", "timeouts", "timeouts"},
+		{"MaxSizeMB", "max-size-mb", "max_size_mb", "maxSizeMb"},
+		{"Port8080", "port8080", "port8080", "port8080"},
+		{"TLS_Cert", "tls-cert", "tls_cert", "tlsCert"},
+		{"Max__Conns_", "max-conns", "max_conns", "maxConns"},
+		{"_", "", "", ""},
+	} {
+		if actual := ToLowerDashCase(tc.input); actual != tc.dash {
+			t.Errorf("ToLowerDashCase(%s): got %q, expected %q", tc.input, actual, tc.dash)
+		}
+		if actual := ToSnakeCase(tc.input); actual != tc.snake {
+			t.Errorf("ToSnakeCase(%s): got %q, expected %q", tc.input, actual, tc.snake)
+		}
+		if actual := ToCamelCase(tc.input); actual != tc.camel {
+			t.Errorf("ToCamelCase(%s): got %q, expected %q", tc.input, actual, tc.camel)
+		}
+	}
+
+	consistent := func(id identifier) bool {
+		dash := ToLowerDashCase(string(id))
+		return ToSnakeCase(string(id)) == strings.Replace(dash, "-", "_", -1) &&
+			strings.ToLower(ToCamelCase(string(id))) == strings.Replace(dash, "-", "", -1)
+	}
+	if err := quick.Check(consistent, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/AudriusButkevicius/recli/v2cli
+
+go 1.17
+
+require (
+	github.com/AudriusButkevicius/recli v0.0.0-00010101000000-000000000000
+	github.com/urfave/cli v1.20.0
+	github.com/urfave/cli/v2 v2.3.0
+)
+
+require (
+	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/russross/blackfriday/v2 v2.0.1 // indirect
+	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+)
+
+replace github.com/AudriusButkevicius/recli => ../
@@ -0,0 +1,133 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package v2cli provides the commands recli constructs as urfave/cli v2
+// commands.
+//
+// The commands are converted from the urfave/cli v1 ones rather than
+// constructed separately, so that both behave exactly the same. The actions
+// keep parsing their own flags and arguments the v1 way, and the converted
+// flags only serve the help output, apart from the flags of the commands
+// grouping other commands, such as --output, which get parsed by v2 and
+// passed on to the actions.
+package v2cli
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/AudriusButkevicius/recli"
+	v1 "github.com/urfave/cli"
+	"github.com/urfave/cli/v2"
+)
+
+// Construct returns the commands the constructor constructs for the item,
+// converted to urfave/cli v2.
+func Construct(c recli.Constructor, item interface{}) ([]*cli.Command, error) {
+	cmds, err := c.Construct(item)
+	if err != nil {
+		return nil, err
+	}
+	return Commands(cmds), nil
+}
+
+// Commands converts urfave/cli v1 commands and their subcommands to v2.
+func Commands(cmds []v1.Command) []*cli.Command {
+	converted := make([]*cli.Command, 0, len(cmds))
+	for _, cmd := range cmds {
+		converted = append(converted, command(cmd))
+	}
+	return converted
+}
+
+func command(cmd v1.Command) *cli.Command {
+	converted := &cli.Command{
+		Name:        cmd.Name,
+		Aliases:     cmd.Aliases,
+		Usage:       cmd.Usage,
+		UsageText:   cmd.UsageText,
+		Description: cmd.Description,
+		ArgsUsage:   cmd.ArgsUsage,
+		Category:    cmd.Category,
+		Hidden:      cmd.Hidden,
+		Flags:       flags(cmd.Flags),
+		Subcommands: Commands(cmd.Subcommands),
+	}
+	if cmd.Action != nil {
+		// The action parses the arguments itself
+		converted.SkipFlagParsing = true
+		converted.Action = func(ctx *cli.Context) error {
+			return runAction(ctx, cmd)
+		}
+	}
+	return converted
+}
+
+// runAction runs the v1 command with the arguments, in a v1 app printing
+// where the v2 one does.
+func runAction(ctx *cli.Context, cmd v1.Command) error {
+	app := v1.NewApp()
+	app.Name = ctx.App.Name
+	app.HideVersion = true
+	app.Writer = ctx.App.Writer
+	app.ErrWriter = ctx.App.ErrWriter
+	app.Commands = []v1.Command{cmd}
+
+	args := []string{app.Name, cmd.Name}
+	// Flags given to the parents, which v2 parsed, are not visible to the
+	// action otherwise
+	for _, parent := range ctx.Lineage()[1:] {
+		if parent.IsSet("output") {
+			args = append(args, "--output", parent.String("output"))
+			break
+		}
+	}
+	return app.Run(append(args, ctx.Args().Slice()...))
+}
+
+func flags(flags []v1.Flag) []cli.Flag {
+	converted := make([]cli.Flag, 0, len(flags))
+	for _, flag := range flags {
+		converted = append(converted, convertFlag(flag))
+	}
+	return converted
+}
+
+// convertFlag converts the flag types recli uses, falling back to a string
+// flag for anything else.
+func convertFlag(flag v1.Flag) cli.Flag {
+	names := strings.Split(flag.GetName(), ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	name, aliases := names[0], names[1:]
+
+	switch flag := flag.(type) {
+	case v1.BoolFlag:
+		return &cli.BoolFlag{Name: name, Aliases: aliases, Usage: flag.Usage, Hidden: flag.Hidden}
+	case v1.StringFlag:
+		return &cli.StringFlag{Name: name, Aliases: aliases, Usage: flag.Usage, Hidden: flag.Hidden, Value: flag.Value}
+	case v1.IntFlag:
+		return &cli.IntFlag{Name: name, Aliases: aliases, Usage: flag.Usage, Hidden: flag.Hidden, Value: flag.Value}
+	case v1.Int64Flag:
+		return &cli.Int64Flag{Name: name, Aliases: aliases, Usage: flag.Usage, Hidden: flag.Hidden, Value: flag.Value}
+	case v1.Float64Flag:
+		return &cli.Float64Flag{Name: name, Aliases: aliases, Usage: flag.Usage, Hidden: flag.Hidden, Value: flag.Value}
+	case v1.StringSliceFlag:
+		return &cli.StringSliceFlag{Name: name, Aliases: aliases, Usage: flag.Usage, Hidden: flag.Hidden}
+	case v1.Int64SliceFlag:
+		return &cli.Int64SliceFlag{Name: name, Aliases: aliases, Usage: flag.Usage, Hidden: flag.Hidden}
+	}
+
+	// All the flag types of v1 have a usage, but not in their interface
+	var usage string
+	if v := reflect.Indirect(reflect.ValueOf(flag)); v.Kind() == reflect.Struct {
+		if field := v.FieldByName("Usage"); field.Kind() == reflect.String {
+			usage = field.String()
+		}
+	}
+	return &cli.StringFlag{Name: name, Aliases: aliases, Usage: usage}
+}
@@ -0,0 +1,162 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package v2cli
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AudriusButkevicius/recli"
+	v1 "github.com/urfave/cli"
+	"github.com/urfave/cli/v2"
+)
+
+type Backend struct {
+	Name  string `recli:"id"`
+	Port  int
+	Tags  []string
+	Ports []int
+	TLS   bool
+}
+
+type Config struct {
+	Name     string `usage:"Name of the server"`
+	Backends []Backend
+	Labels   map[string]string
+}
+
+func run(cfg recli.Config, item interface{}, args ...string) (string, error) {
+	var buf bytes.Buffer
+	cfg.Writer = &buf
+
+	cmds, err := Construct(recli.New(cfg), item)
+	if err != nil {
+		return "", err
+	}
+
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = &buf
+	app.ErrWriter = &buf
+	err = app.Run(append([]string{"test"}, args...))
+	return buf.String(), err
+}
+
+func TestV2(t *testing.T) {
+	x := &Config{
+		Name:     "a",
+		Backends: []Backend{{Name: "b", Port: 1}},
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"name", "set", "foo"}, ""},
+		{[]string{"name", "get"}, "foo\n"},
+		{[]string{"backends", "add", "--name", "c", "--port", "2", "--tags", "x", "--tags", "y", "--ports", "3", "--tls"}, ""},
+		{[]string{"backends", "list"}, "b\nc\n"},
+		{[]string{"backends", "c", "tags", "list"}, "0\n1\n"},
+		{[]string{"backends", "last", "port", "get"}, "2\n"},
+		{[]string{"backends", "slice", "--", "-1"}, "[\n  {\n    \"Name\": \"c\",\n    \"Port\": 2,\n    \"Tags\": [\n      \"x\",\n      \"y\"\n    ],\n    \"Ports\": [\n      3\n    ],\n    \"TLS\": true\n  }\n]\n"},
+		{[]string{"labels", "set", "k", "v"}, ""},
+		{[]string{"labels", "get", "k"}, "v\n"},
+		{[]string{"backends", "b", "delete"}, ""},
+		{[]string{"backends", "count"}, "1\n"},
+	} {
+		out, err := run(recli.DefaultConfig, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if out != tc.expected {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+
+	expected := &Config{
+		Name:     "foo",
+		Backends: []Backend{{Name: "c", Port: 2, Tags: []string{"x", "y"}, Ports: []int{3}, TLS: true}},
+		Labels:   map[string]string{"k": "v"},
+	}
+	if !reflect.DeepEqual(x, expected) {
+		t.Errorf("unexpected value: %+v", x)
+	}
+
+	for _, args := range [][]string{
+		{"name", "set"},
+		{"backends", "add", "--port", "x"},
+		{"backends", "c", "port", "set", "x"},
+	} {
+		if _, err := run(recli.DefaultConfig, x, args...); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestV2OutputFlag(t *testing.T) {
+	x := &Config{
+		Name:     "a",
+		Backends: []Backend{{Name: "b", Port: 1}},
+	}
+
+	cfg := recli.DefaultConfig
+	cfg.OutputFlag = true
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"name", "get"}, "a\n"},
+		{[]string{"name", "get", "--output", "json"}, "\"a\"\n"},
+		{[]string{"name", "--output", "json", "get"}, "\"a\"\n"},
+		{[]string{"backends", "--output", "json", "last", "port", "get"}, "1\n"},
+		{[]string{"backends", "--output", "json", "list"}, "[\"b\"]\n"},
+	} {
+		out, err := run(cfg, x, tc.args...)
+		if err != nil {
+			t.Fatal(tc.args, err)
+		}
+		if out != tc.expected {
+			t.Errorf("%v: unexpected output: %q", tc.args, out)
+		}
+	}
+}
+
+func TestV2Tree(t *testing.T) {
+	x := &Config{Backends: []Backend{{Name: "b"}}}
+
+	cmds, err := recli.Default.Construct(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var compare func(path string, cmds []v1.Command, converted []*cli.Command)
+	compare = func(path string, cmds []v1.Command, converted []*cli.Command) {
+		if len(converted) != len(cmds) {
+			t.Fatalf("%s: %d commands, expected %d", path, len(converted), len(cmds))
+		}
+		for i, cmd := range cmds {
+			c := converted[i]
+			if c.Name != cmd.Name || c.Usage != cmd.Usage || c.Category != cmd.Category || len(c.Flags) != len(cmd.Flags) {
+				t.Errorf("%s %s: converted to %+v", path, cmd.Name, c)
+			}
+			compare(path+" "+cmd.Name, cmd.Subcommands, c.Subcommands)
+		}
+	}
+	compare("", cmds, Commands(cmds))
+
+	out, err := run(recli.DefaultConfig, x, "backends", "help", "add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, flag := range []string{"--name value", "--tags value", "--tls"} {
+		if !strings.Contains(out, flag) {
+			t.Errorf("%s missing from help: %s", flag, out)
+		}
+	}
+}
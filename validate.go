@@ -0,0 +1,60 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// StructValidator validates a whole struct, for example based on its tags
+// like the *Validate of github.com/go-playground/validator does.
+type StructValidator interface {
+	Struct(s interface{}) error
+}
+
+// newPlaygroundValidator returns a go-playground/validator, once registered
+// by the playground package.
+var newPlaygroundValidator func() StructValidator
+
+// RegisterPlaygroundValidator sets the function creating the validator
+// UseGoPlaygroundValidator uses. It is called when importing
+// github.com/AudriusButkevicius/recli/playground, which keeps the dependency
+// out of the programs not using it.
+func RegisterPlaygroundValidator(newValidator func() StructValidator) {
+	newPlaygroundValidator = newValidator
+}
+
+// structValidator returns the validator configured, if any.
+func (c *constructor) structValidator() (StructValidator, error) {
+	if c.cfg.StructValidator != nil {
+		return c.cfg.StructValidator, nil
+	}
+	if !c.cfg.UseGoPlaygroundValidator {
+		return nil, nil
+	}
+	if newPlaygroundValidator == nil {
+		return nil, errors.New("UseGoPlaygroundValidator requires importing github.com/AudriusButkevicius/recli/playground")
+	}
+	return newPlaygroundValidator(), nil
+}
+
+func (c *constructor) makeValidateCommand(v reflect.Value, validator StructValidator) cli.Command {
+	return cli.Command{
+		Name:     "validate",
+		Usage:    "Check that the value is valid",
+		Category: "ACTIONS",
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			if err := validate(v); err != nil {
+				return err
+			}
+			return validator.Struct(v.Addr().Interface())
+		}),
+	}
+}
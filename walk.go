@@ -0,0 +1,313 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package recli
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+type walkFunc func(path []string, v reflect.Value) error
+
+// walkFilter is called before descending into a struct, slice or map, and
+// returns whether it should be descended into.
+type walkFilter func(path []string, v reflect.Value) bool
+
+func appendPath(path []string, segment string) []string {
+	newPath := make([]string, len(path), len(path)+1)
+	copy(newPath, path)
+	return append(newPath, segment)
+}
+
+// Walk walks the item using the default constructor, see Constructor.Walk.
+func Walk(item interface{}, fn func(path []string, v reflect.Value) error) error {
+	return Default.Walk(item, fn)
+}
+
+// Walk calls fn for every leaf of the item, in the order the commands are
+// constructed in, with the path of command names leading to it. The path
+// segments are the command names of the fields, honouring the name tags and
+// Config.UseJSONTagNames, the keys of slice items as used by the slice
+// commands, and the map keys.
+// Leaves are primitives, pointers to primitives, slices of primitives and
+// interface values, while structs, other slices and maps are descended into.
+// Skipped fields are left out, and pointers back to a value being walked are
+// not followed. An error returned by fn stops the walk and is returned.
+func (c *constructor) Walk(item interface{}, fn func(path []string, v reflect.Value) error) error {
+	return c.walk(nil, reflect.ValueOf(item), fn)
+}
+
+// walk calls fn for every leaf under v in declaration order. Leaves are
+// primitive values (including nil pointers to primitives) and slices of
+// primitives. Structs, slices of structs and maps are descended into, with
+// slice items keyed the same way as the slice commands, and map entries
+// visited in sorted key order.
+func (c *constructor) walk(path []string, v reflect.Value, fn walkFunc) error {
+	return c.walkFiltered(path, v, fn, nil)
+}
+
+// walkFiltered is like walk, but skips the containers rejected by filter.
+func (c *constructor) walkFiltered(path []string, v reflect.Value, fn walkFunc, filter walkFilter) error {
+	return c.walkSeen(path, v, fn, filter, make(map[seenPointer]bool))
+}
+
+// seenPointer identifies a pointer, along with its type as a struct and its
+// first field share the address.
+type seenPointer struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func (c *constructor) walkSeen(path []string, v reflect.Value, fn walkFunc, filter walkFilter, seen map[seenPointer]bool) error {
+	if v.Kind() == reflect.Ptr && isPrimitiveType(v.Type()) {
+		return fn(path, v)
+	}
+
+	// Stop at pointers back to a value being walked
+	for ; v.Kind() == reflect.Ptr && !v.IsNil(); v = v.Elem() {
+		key := seenPointer{v.Pointer(), v.Type()}
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		defer delete(seen, key)
+	}
+
+	v = deref(v)
+	if !v.IsValid() {
+		return nil
+	}
+
+	// Interface values have no static structure, and are leaves as json
+	if isPrimitive(v) || v.Kind() == reflect.Interface {
+		return fn(path, v)
+	}
+
+	if filter != nil && !filter(path, v) {
+		return nil
+	}
+
+	switch {
+	case v.Kind() == reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if c.isSkipped(f) {
+				continue
+			}
+			if err := c.walkSeen(appendPath(path, c.fieldName(f)), v.Field(i), fn, filter, seen); err != nil {
+				return err
+			}
+		}
+
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		if isPrimitiveType(v.Type().Elem()) {
+			return fn(path, v)
+		}
+		keyer := c.makeKeyer(v)
+		for i := 0; i < v.Len(); i++ {
+			key, err := keyer(i)
+			if err != nil {
+				if c.skipKeyError(err) {
+					continue
+				}
+				return err
+			}
+			if err := c.walkSeen(appendPath(path, key), v.Index(i), fn, filter, seen); err != nil {
+				return err
+			}
+		}
+
+	case v.Kind() == reflect.Map:
+		type entry struct {
+			key   string
+			value reflect.Value
+		}
+		entries := make([]entry, 0, v.Len())
+		for _, keyValue := range v.MapKeys() {
+			key, err := GetPrimitiveValue(keyValue)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry{fmt.Sprint(key), v.MapIndex(keyValue)})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].key < entries[j].key
+		})
+		for _, e := range entries {
+			if err := c.walkSeen(appendPath(path, e.key), e.value, fn, filter, seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// leafValue returns the printable value of a leaf visited by walk.
+func leafValue(v reflect.Value) (interface{}, error) {
+	v = deref(v)
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	if v.Kind() == reflect.Interface {
+		return interfaceValue(v)
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		if isPrimitiveType(v.Type().Elem()) && !isPrimitive(v) {
+			items := make([]string, 0, v.Len())
+			for i := 0; i < v.Len(); i++ {
+				item, err := leafValue(v.Index(i))
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			return strings.Join(items, ","), nil
+		}
+	}
+
+	return GetPrimitiveValue(v)
+}
+
+func (c *constructor) makeShowCommand(v reflect.Value) cli.Command {
+	return cli.Command{
+		Name:     "show",
+		Usage:    "Show all properties and their values",
+		Category: "ACTIONS",
+		Flags:    c.revealFlags(v.Type()),
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			var kvs []keyValuePair
+			err := c.walk(nil, c.revealed(ctx, v), func(path []string, v reflect.Value) error {
+				value, err := leafValue(v)
+				if err != nil {
+					return err
+				}
+				kvs = append(kvs, keyValuePair{strings.Join(path, "."), value})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			return c.printer(ctx).emitKeyValues(kvs)
+		}),
+	}
+}
+
+type typeWalkFunc func(path []string, t reflect.Type, field *reflect.StructField) error
+
+// walkType is like walk, but works on types rather than values, calling fn
+// for every leaf type along with the struct field that declared it. Slice
+// items and map entries are represented by a generic <key> path segment, and
+// are given the field of the slice or map.
+func (c *constructor) walkType(path []string, t reflect.Type, fn typeWalkFunc) error {
+	return c.walkTypeSeen(path, t, nil, fn, false, make(map[reflect.Type]bool))
+}
+
+// WalkType walks the type of the item using the default constructor, see
+// Constructor.WalkType.
+func WalkType(item interface{}, fn func(path []string, t reflect.Type, field *reflect.StructField) error) error {
+	return Default.WalkType(item, fn)
+}
+
+// WalkType is like Walk, but works on the type of the item rather than its
+// value, so slice items and map entries are represented by a generic <key>
+// path segment. fn is called for the leaves, and also for the structs,
+// slices and maps before their contents, starting with the item itself at
+// an empty path. The field is the struct field declaring the type, the field
+// of the slice or map for their items, or nil for the item. Recursive types
+// are not descended into again.
+func (c *constructor) WalkType(item interface{}, fn func(path []string, t reflect.Type, field *reflect.StructField) error) error {
+	t := reflect.TypeOf(item)
+	if t == nil {
+		return fmt.Errorf("expected a value, got %T", item)
+	}
+	return c.walkTypeSeen(nil, t, nil, fn, true, make(map[reflect.Type]bool))
+}
+
+// walkTypeSeen calls fn for the leaves under t, and for the containers too
+// if containers is set.
+func (c *constructor) walkTypeSeen(path []string, t reflect.Type, field *reflect.StructField, fn typeWalkFunc, containers bool, seen map[reflect.Type]bool) error {
+	if isPrimitiveType(t) || t.Kind() == reflect.Interface {
+		return fn(path, t, field)
+	}
+
+	t = derefType(t)
+
+	// Stop at recursive types
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+	case reflect.Slice, reflect.Array:
+		if isPrimitiveType(t.Elem()) {
+			return fn(path, t, field)
+		}
+	default:
+		return nil
+	}
+	if containers {
+		if err := fn(path, t, field); err != nil {
+			return err
+		}
+	}
+
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if c.isSkipped(f) {
+				continue
+			}
+			if err := c.walkTypeSeen(appendPath(path, c.fieldName(f)), f.Type, &f, fn, containers, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return c.walkTypeSeen(appendPath(path, itemPlaceholder), t.Elem(), field, fn, containers, seen)
+}
+
+func (c *constructor) makePathsCommand(t reflect.Type) cli.Command {
+	return cli.Command{
+		Name:     "paths",
+		Usage:    "List the paths of all properties",
+		Category: "ACTIONS",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "types",
+				Usage: "Include the kind of each property",
+			},
+		},
+		Action: expectArgs(0, func(ctx *cli.Context) error {
+			var paths []interface{}
+			var kvs []keyValuePair
+			err := c.walkType(nil, t, func(path []string, t reflect.Type, _ *reflect.StructField) error {
+				paths = append(paths, strings.Join(path, "."))
+				kvs = append(kvs, keyValuePair{strings.Join(path, "."), derefType(t).Kind().String()})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			p := c.printer(ctx)
+			if ctx.Bool("types") {
+				return p.emitKeyValues(kvs)
+			}
+			return p.emitList(paths)
+		}),
+	}
+}
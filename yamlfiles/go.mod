@@ -0,0 +1,17 @@
+module github.com/AudriusButkevicius/recli/yamlfiles
+
+go 1.17
+
+require (
+	github.com/AudriusButkevicius/recli v0.0.0-00010101000000-000000000000
+	github.com/urfave/cli v1.20.0
+	sigs.k8s.io/yaml v1.2.0
+)
+
+require (
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	gopkg.in/yaml.v2 v2.2.8 // indirect
+)
+
+replace github.com/AudriusButkevicius/recli => ../
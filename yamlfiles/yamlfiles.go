@@ -0,0 +1,23 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package yamlfiles adds yaml files to the formats of the export and import
+// commands when imported, for the .yaml and .yml extensions.
+//
+//	import _ "github.com/AudriusButkevicius/recli/yamlfiles"
+//
+// It is a module of its own, so that the yaml dependency is opt in.
+package yamlfiles
+
+import (
+	"github.com/AudriusButkevicius/recli"
+	"sigs.k8s.io/yaml"
+)
+
+func init() {
+	recli.RegisterFileFormat(".yaml", yaml.JSONToYAML, yaml.YAMLToJSON)
+	recli.RegisterFileFormat(".yml", yaml.JSONToYAML, yaml.YAMLToJSON)
+}
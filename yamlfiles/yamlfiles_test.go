@@ -0,0 +1,114 @@
+// Copyright (C) 2019 Audrius Butkevicius
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package yamlfiles
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AudriusButkevicius/recli"
+	"github.com/urfave/cli"
+)
+
+type Backend struct {
+	Name string `recli:"id"`
+	Port int
+}
+
+type Inner struct {
+	Enabled bool
+	Ratio   float64 `json:"ratio"`
+}
+
+type Config struct {
+	Name     string
+	Inner    Inner
+	Backends []Backend
+	Labels   map[string]string
+}
+
+func run(cfg recli.Config, item interface{}, args ...string) error {
+	cmds, err := recli.New(cfg).Construct(item)
+	if err != nil {
+		return err
+	}
+	app := cli.NewApp()
+	app.Commands = cmds
+	app.Writer = ioutil.Discard
+	return app.Run(append([]string{"test"}, args...))
+}
+
+func TestExportImportYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := recli.DefaultConfig
+	cfg.FileCommands = true
+
+	x := &Config{
+		Name:     "a",
+		Inner:    Inner{true, 0.5},
+		Backends: []Backend{{"b1", 1}, {"b2", 2}},
+		Labels:   map[string]string{"k": "v"},
+	}
+
+	for _, ext := range []string{".yaml", ".yml"} {
+		path := filepath.Join(dir, "config"+ext)
+		if err := run(cfg, x, "export", path); err != nil {
+			t.Fatal(ext, err)
+		}
+		y := &Config{Name: "other"}
+		if err := run(cfg, y, "import", path); err != nil {
+			t.Fatal(ext, err)
+		}
+		if !reflect.DeepEqual(x, y) {
+			t.Errorf("%s: unexpected round trip: %#v", ext, y)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Inner:\n  Enabled: true\n  ratio: 0.5\n") {
+		t.Errorf("unexpected yaml: %s", data)
+	}
+
+	backendsPath := filepath.Join(dir, "backends.yml")
+	if err := ioutil.WriteFile(backendsPath, []byte("- Name: b3\n  Port: 3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(cfg, x, "backends", "import", "--append", backendsPath); err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Backends) != 3 || x.Backends[2] != (Backend{"b3", 3}) {
+		t.Errorf("unexpected appended backends: %v", x.Backends)
+	}
+
+	innerPath := filepath.Join(dir, "inner.yaml")
+	if err := ioutil.WriteFile(innerPath, []byte("Enabled: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(cfg, x, "inner", "import", innerPath); err == nil {
+		t.Error("expected error for invalid yaml")
+	}
+	if x.Inner != (Inner{true, 0.5}) {
+		t.Errorf("inner changed by a failed import: %v", x.Inner)
+	}
+
+	err = run(cfg, x, "export", filepath.Join(dir, "config.toml"))
+	if err == nil || !strings.Contains(err.Error(), ".json, .yaml, .yml") {
+		t.Errorf("expected error listing the supported extensions, got %v", err)
+	}
+}